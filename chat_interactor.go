@@ -1,16 +1,66 @@
 package chatty
 
 import (
+	"errors"
+	"fmt"
+	"strings"
+
 	"github.com/pborman/uuid"
 	"github.com/ryan-berger/chatty/connection"
+	"github.com/ryan-berger/chatty/operators"
 
 	"github.com/ryan-berger/chatty/repositories"
 )
 
+var (
+	errNotConversant      = errors.New("conversant is not in the conversation")
+	errDirectConversation = errors.New("direct conversations can't change conversants")
+	errAlreadyConversant  = errors.New("conversant is already in the conversation")
+	errRemoveSelf         = errors.New("use leaveConversation to remove yourself")
+	errSetOwnRole         = errors.New("can't change your own role")
+	errBlockSelf          = errors.New("can't block yourself")
+	errBlockUnsupported   = errors.New("blocking isn't supported")
+)
+
+var (
+	errCantStartConversation = &ForbiddenError{Reason: "not allowed to start this conversation"}
+	errReadOnly              = &ForbiddenError{Reason: "read-only conversants can't send messages"}
+	errNotManager            = &ForbiddenError{Reason: "only owners and admins can manage the conversation"}
+	errNotOwner              = &ForbiddenError{Reason: "only the owner can do that"}
+	errOwnerLeave            = &ForbiddenError{Reason: "the owner has to make someone else the owner before leaving"}
+	errBlocked               = &ForbiddenError{Reason: "can't start a direct conversation with a blocked conversant"}
+)
+
+// ForbiddenError is returned when the sender isn't allowed to make a request. Unlike
+// other errors, its reason is sent back to the client, with connection.CodeForbidden
+type ForbiddenError struct {
+	Reason string
+}
+
+func (err *ForbiddenError) Error() string {
+	return err.Reason
+}
+
+// conversationUpdate is a change to a conversation's conversants, their roles or its
+// name. Conversants is everyone in the conversation after the change, and message is
+// the system message recording it. Name is only set when the conversation was renamed
+type conversationUpdate struct {
+	message     repositories.Message
+	name        string
+	conversants []repositories.Conversant
+	added       []string
+	removed     []string
+}
+
+// chatInteractor holds the chat logic. auther is asked before conversations are
+// created or grow, and a nil auther lets anyone start any conversation. A nil
+// blockRepo means conversants can't block each other
 type chatInteractor struct {
 	conversationRepo repositories.ConversationRepo
 	messageRepo      repositories.MessageRepo
 	conversantRepo   repositories.ConversantRepo
+	blockRepo        repositories.BlockRepo
+	auther           operators.Auther
 }
 
 func (chat *chatInteractor) CreateConversation(request connection.CreateConversationRequest) (*repositories.Conversation, error) {
@@ -29,6 +79,30 @@ func (chat *chatInteractor) CreateConversation(request connection.CreateConversa
 	newConversation.Name = request.Name
 	newConversation.Direct = len(newConversation.Conversants) == 2
 
+	// whoever starts a group owns it. Both sides of a direct conversation are just members
+	if !newConversation.Direct {
+		for i := range newConversation.Conversants {
+			if newConversation.Conversants[i].ID == request.SenderID {
+				newConversation.Conversants[i].Role = repositories.RoleOwner
+			}
+		}
+	}
+
+	if !chat.canStartConversation(request.SenderID, newConversation) {
+		return nil, errCantStartConversation
+	}
+
+	if newConversation.Direct {
+		blocked, err := chat.isBlocked(newConversation.Conversants[0].ID, newConversation.Conversants[1].ID)
+		if err != nil {
+			return nil, err
+		}
+
+		if blocked {
+			return nil, errBlocked
+		}
+	}
+
 	convo, err := chat.conversationRepo.CreateConversation(newConversation)
 	if err != nil {
 		return nil, err
@@ -37,27 +111,97 @@ func (chat *chatInteractor) CreateConversation(request connection.CreateConversa
 	return convo, nil
 }
 
-func (chat *chatInteractor) GetConversation(request connection.RetrieveConversationRequest) (*repositories.Conversation, error) {
+// GetConversation returns a page of the conversation with cursors for the pages around it.
+// One more message than the limit is fetched to tell whether there is another page
+func (chat *chatInteractor) GetConversation(request connection.RetrieveConversationRequest) (*connection.ReturnConversationResponse, error) {
 	err := request.Validate()
 	if err != nil {
 		return nil, err
 	}
 
-	conversation, err := chat.conversationRepo.RetrieveConversation(request.ConversationID, request.Limit, request.Offset)
+	err = chat.authorize(request.ConversationID, request.SenderID)
+	if err != nil {
+		return nil, err
+	}
+
+	var conversation *repositories.Conversation
+	if request.Before == 0 && request.After == 0 {
+		conversation, err = chat.conversationRepo.RetrieveConversation(request.ConversationID, request.Limit+1, request.Offset)
+	} else {
+		cursor := repositories.Cursor{Before: request.Before, After: request.After}
+		conversation, err = chat.conversationRepo.RetrieveConversationPage(request.ConversationID, cursor, request.Limit+1)
+	}
 
 	if err != nil {
 		return nil, err
 	}
 
-	return conversation, nil
+	messages := conversation.Messages
+	more := len(messages) > request.Limit
+
+	var newer, older bool
+	if request.After > 0 {
+		// the page is read forwards from the cursor, so the extra message is the newest
+		if more {
+			messages = messages[1:]
+		}
+		newer, older = more, true
+	} else {
+		if more {
+			messages = messages[:request.Limit]
+		}
+		newer, older = request.Before > 0 || request.Offset > 0, more
+	}
+
+	response := &connection.ReturnConversationResponse{Conversation: *conversation}
+	response.Messages = messages
+
+	if len(messages) > 0 {
+		if newer {
+			response.NextCursor = messages[0].Sequence
+		}
+		if older {
+			response.PrevCursor = messages[len(messages)-1].Sequence
+		}
+	}
+
+	// reading up to the newest message marks the whole conversation as read
+	if len(messages) > 0 && !newer {
+		chat.markRead(request.ConversationID, request.SenderID, messages[0].Sequence)
+	}
+
+	// blocked senders are left out after the cursors are picked, so paging still moves past their messages
+	blocked, err := chat.GetBlocked(request.SenderID)
+	if err != nil {
+		return nil, err
+	}
+	response.Messages = withoutBlocked(messages, blocked)
+
+	return response, nil
 }
 
-func (chat *chatInteractor) SendMessage(message connection.SendMessageRequest) (*repositories.Message, error) {
+// SendMessage stores the message, and reports whether it is a duplicate of a
+// message already sent with the same idempotency key
+func (chat *chatInteractor) SendMessage(message connection.SendMessageRequest) (*repositories.Message, bool, error) {
 
 	err := message.Validate()
 
 	if err != nil {
-		return nil, err
+		return nil, false, err
+	}
+
+	err = chat.authorize(message.ConversationID, message.SenderID)
+	if err != nil {
+		return nil, false, err
+	}
+
+	readOnly, err := chat.readOnly(message.ConversationID, message.SenderID)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if readOnly {
+		return nil, false, errReadOnly
 	}
 
 	msg := repositories.Message{
@@ -65,15 +209,541 @@ func (chat *chatInteractor) SendMessage(message connection.SendMessageRequest) (
 		Message:        message.Message,
 		SenderID:       message.SenderID,
 		ConversationID: message.ConversationID,
+		IdempotencyKey: message.IdempotencyKey,
 	}
 
 	newMessage, err := chat.messageRepo.CreateMessage(msg)
 
+	if err != nil {
+		return nil, false, err
+	}
+
+	// the sender has read everything up to their own message
+	chat.markRead(newMessage.ConversationID, newMessage.SenderID, newMessage.Sequence)
+
+	// the repo hands back the original message when the key has been used before
+	return newMessage, newMessage.ID != msg.ID, nil
+}
+
+func (chat *chatInteractor) canStartConversation(creatorID string, conversation repositories.Conversation) bool {
+	return chat.auther == nil || chat.auther.CanStartConversation(creatorID, conversation)
+}
+
+// authorize makes sure the sender is in the conversation. Unknown conversations
+// are forbidden too, so that conversation IDs can't be probed
+func (chat *chatInteractor) authorize(conversationID, senderID string) error {
+	member, err := chat.conversationRepo.IsConversant(conversationID, senderID)
+	if err != nil {
+		return err
+	}
+
+	if !member {
+		return notConversant(conversationID)
+	}
+	return nil
+}
+
+// readOnly reports whether the sender is a read-only conversant of the conversation.
+// It doesn't check that they're in it at all, which authorize does. Like IsConversant,
+// GetConversants is cached by repositories.MembershipCache, so sending doesn't cost another lookup
+func (chat *chatInteractor) readOnly(conversationID, senderID string) (bool, error) {
+	conversants, err := chat.conversationRepo.GetConversants(conversationID)
+	if err != nil {
+		return false, err
+	}
+
+	conversant, _ := findConversant(conversants, senderID)
+	return !conversant.Role.OrMember().CanSend(), nil
+}
+
+func notConversant(conversationID string) *ForbiddenError {
+	return &ForbiddenError{Reason: "not a conversant of conversation " + conversationID}
+}
+
+// markRead moves the conversant's read position forward. It only affects unread
+// counts, so failing to store it doesn't fail the request that caused it
+func (chat *chatInteractor) markRead(conversationID, conversantID string, sequence int64) {
+	err := chat.conversationRepo.MarkRead(conversationID, conversantID, sequence)
+	if err != nil {
+		fmt.Println("markRead_MarkRead", err)
+	}
+}
+
+func (chat *chatInteractor) ListConversations(request connection.ListConversationsRequest) ([]repositories.ConversationSummary, error) {
+	err := request.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	conversations, err := chat.conversationRepo.ListConversations(request.SenderID, request.Limit, request.Offset)
+	if err != nil {
+		return nil, err
+	}
+
+	return conversations, nil
+}
+
+// AddConversants adds conversants to a group conversation the sender is in
+func (chat *chatInteractor) AddConversants(request connection.AddConversantsRequest) (*conversationUpdate, error) {
+	err := request.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	conversation, err := chat.managedConversation(request.ConversationID, request.SenderID)
+	if err != nil {
+		return nil, err
+	}
+
+	var added []repositories.Conversant
+	for _, conversantID := range request.Conversants {
+		if hasConversant(conversation.Conversants, conversantID) || hasConversant(added, conversantID) {
+			return nil, errAlreadyConversant
+		}
+		added = append(added, repositories.Conversant{ID: conversantID})
+	}
+
+	// the conversation has to be one that could have been started with everyone in it
+	grown := *conversation
+	grown.Conversants = append(append([]repositories.Conversant{}, conversation.Conversants...), added...)
+	if !chat.canStartConversation(request.SenderID, grown) {
+		return nil, errCantStartConversation
+	}
+
+	err = chat.conversationRepo.AddConversants(request.ConversationID, added)
+	if err != nil {
+		return nil, err
+	}
+
+	update, err := chat.updateConversants(conversation, request.SenderID, request.Conversants, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	chat.markRead(update.message.ConversationID, request.SenderID, update.message.Sequence)
+	return update, nil
+}
+
+// RemoveConversants removes other conversants from a group conversation the sender is in
+func (chat *chatInteractor) RemoveConversants(request connection.RemoveConversantsRequest) (*conversationUpdate, error) {
+	err := request.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	conversation, err := chat.managedConversation(request.ConversationID, request.SenderID)
+	if err != nil {
+		return nil, err
+	}
+
+	sender, _ := findConversant(conversation.Conversants, request.SenderID)
+	for _, conversantID := range request.Conversants {
+		if conversantID == request.SenderID {
+			return nil, errRemoveSelf
+		}
+
+		conversant, ok := findConversant(conversation.Conversants, conversantID)
+		if !ok {
+			return nil, errNotConversant
+		}
+
+		// admins can only remove members, the owner can remove anyone
+		if conversant.Role.CanManage() && sender.Role != repositories.RoleOwner {
+			return nil, errNotOwner
+		}
+	}
+
+	err = chat.conversationRepo.RemoveConversants(request.ConversationID, request.Conversants)
+	if err != nil {
+		return nil, err
+	}
+
+	update, err := chat.updateConversants(conversation, request.SenderID, nil, request.Conversants)
+	if err != nil {
+		return nil, err
+	}
+
+	chat.markRead(update.message.ConversationID, request.SenderID, update.message.Sequence)
+	return update, nil
+}
+
+// LeaveConversation removes the sender from a group conversation
+func (chat *chatInteractor) LeaveConversation(request connection.LeaveConversationRequest) (*conversationUpdate, error) {
+	err := request.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	conversation, err := chat.groupConversation(request.ConversationID, request.SenderID)
+	if err != nil {
+		return nil, err
+	}
+
+	// a conversation can't be left without an owner, unless there's no one left in it
+	sender, _ := findConversant(conversation.Conversants, request.SenderID)
+	if sender.Role == repositories.RoleOwner && len(conversation.Conversants) > 1 {
+		return nil, errOwnerLeave
+	}
+
+	err = chat.conversationRepo.RemoveConversants(request.ConversationID, []string{request.SenderID})
+	if err != nil {
+		return nil, err
+	}
+
+	return chat.updateConversants(conversation, request.SenderID, nil, []string{request.SenderID})
+}
+
+// groupConversation gets a conversation and its conversants, making sure it
+// isn't direct and that the sender is in it
+func (chat *chatInteractor) groupConversation(conversationID, senderID string) (*repositories.Conversation, error) {
+	conversation, err := chat.conversationRepo.RetrieveConversation(conversationID, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	if !hasConversant(conversation.Conversants, senderID) {
+		return nil, notConversant(conversationID)
+	}
+
+	if conversation.Direct {
+		return nil, errDirectConversation
+	}
+
+	return conversation, nil
+}
+
+// SetRole changes a conversant's role in a group conversation. Owners and admins can
+// change members' roles, but only the owner can make or unmake admins. Making someone
+// the owner hands the conversation over to them, and the old owner becomes an admin
+func (chat *chatInteractor) SetRole(request connection.SetRoleRequest) (*conversationUpdate, error) {
+	err := request.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	conversation, err := chat.managedConversation(request.ConversationID, request.SenderID)
+	if err != nil {
+		return nil, err
+	}
+
+	if request.ConversantID == request.SenderID {
+		return nil, errSetOwnRole
+	}
+
+	conversant, ok := findConversant(conversation.Conversants, request.ConversantID)
+	if !ok {
+		return nil, errNotConversant
+	}
+
+	sender, _ := findConversant(conversation.Conversants, request.SenderID)
+	if (conversant.Role.CanManage() || request.Role.CanManage()) && sender.Role != repositories.RoleOwner {
+		return nil, errNotOwner
+	}
+
+	err = chat.conversationRepo.SetRole(request.ConversationID, request.ConversantID, request.Role)
+	if err != nil {
+		return nil, err
+	}
+
+	if request.Role == repositories.RoleOwner {
+		err = chat.conversationRepo.SetRole(request.ConversationID, request.SenderID, repositories.RoleAdmin)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	update, err := chat.updateConversation(conversation, request.SenderID, func(displayName func(string) string) string {
+		return displayName(request.SenderID) + " made " + displayName(request.ConversantID) + " " + roleName(request.Role)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	chat.markRead(update.message.ConversationID, request.SenderID, update.message.Sequence)
+	return update, nil
+}
+
+func roleName(role repositories.Role) string {
+	switch role {
+	case repositories.RoleOwner:
+		return "the owner"
+	case repositories.RoleAdmin:
+		return "an admin"
+	case repositories.RoleReadOnly:
+		return "read-only"
+	default:
+		return "a member"
+	}
+}
+
+// RenameConversation renames a group conversation the sender manages
+func (chat *chatInteractor) RenameConversation(request connection.RenameConversationRequest) (*conversationUpdate, error) {
+	err := request.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	conversation, err := chat.managedConversation(request.ConversationID, request.SenderID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = chat.conversationRepo.RenameConversation(request.ConversationID, request.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	update, err := chat.updateConversation(conversation, request.SenderID, func(displayName func(string) string) string {
+		return displayName(request.SenderID) + " renamed the conversation to " + request.Name
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	update.name = request.Name
+	chat.markRead(update.message.ConversationID, request.SenderID, update.message.Sequence)
+	return update, nil
+}
+
+// DeleteConversation deletes a group conversation the sender owns, and
+// returns everyone who was in it
+func (chat *chatInteractor) DeleteConversation(request connection.DeleteConversationRequest) ([]repositories.Conversant, error) {
+	err := request.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	conversation, err := chat.groupConversation(request.ConversationID, request.SenderID)
+	if err != nil {
+		return nil, err
+	}
+
+	sender, _ := findConversant(conversation.Conversants, request.SenderID)
+	if sender.Role != repositories.RoleOwner {
+		return nil, errNotOwner
+	}
+
+	err = chat.conversationRepo.DeleteConversation(request.ConversationID)
+	if err != nil {
+		return nil, err
+	}
+
+	return conversation.Conversants, nil
+}
+
+// managedConversation is a groupConversation the sender is an owner or admin of
+func (chat *chatInteractor) managedConversation(conversationID, senderID string) (*repositories.Conversation, error) {
+	conversation, err := chat.groupConversation(conversationID, senderID)
+	if err != nil {
+		return nil, err
+	}
+
+	sender, _ := findConversant(conversation.Conversants, senderID)
+	if !sender.Role.CanManage() {
+		return nil, errNotManager
+	}
+
+	return conversation, nil
+}
+
+// updateConversants appends a system message describing the change to the conversation's conversants
+func (chat *chatInteractor) updateConversants(before *repositories.Conversation, senderID string, added, removed []string) (*conversationUpdate, error) {
+	update, err := chat.updateConversation(before, senderID, func(displayName func(string) string) string {
+		names := func(conversantIDs []string) string {
+			list := make([]string, 0, len(conversantIDs))
+			for _, conversantID := range conversantIDs {
+				list = append(list, displayName(conversantID))
+			}
+			return strings.Join(list, ", ")
+		}
+
+		switch {
+		case len(added) > 0:
+			return displayName(senderID) + " added " + names(added)
+		case len(removed) == 1 && removed[0] == senderID:
+			return displayName(senderID) + " left"
+		default:
+			return displayName(senderID) + " removed " + names(removed)
+		}
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	return newMessage, nil
+	update.added = added
+	update.removed = removed
+	return update, nil
+}
+
+// updateConversation appends the system message describe returns to the conversation. before
+// is the conversation as it was, which still has the display names of anyone removed
+func (chat *chatInteractor) updateConversation(before *repositories.Conversation, senderID string, describe func(displayName func(string) string) string) (*conversationUpdate, error) {
+	conversants, err := chat.conversationRepo.GetConversants(before.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	displayNames := make(map[string]string)
+	for _, list := range [][]repositories.Conversant{before.Conversants, conversants} {
+		for _, conversant := range list {
+			if conversant.DisplayName != "" {
+				displayNames[conversant.ID] = conversant.DisplayName
+			}
+		}
+	}
+
+	displayName := func(conversantID string) string {
+		if name, ok := displayNames[conversantID]; ok {
+			return name
+		}
+		return conversantID
+	}
+
+	message, err := chat.messageRepo.CreateMessage(repositories.Message{
+		ID:             uuid.New(),
+		Message:        describe(displayName),
+		SenderID:       senderID,
+		ConversationID: before.ID,
+		System:         true,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &conversationUpdate{
+		message:     *message,
+		conversants: conversants,
+	}, nil
+}
+
+func hasConversant(conversants []repositories.Conversant, conversantID string) bool {
+	_, ok := findConversant(conversants, conversantID)
+	return ok
+}
+
+func findConversant(conversants []repositories.Conversant, conversantID string) (repositories.Conversant, bool) {
+	for _, conversant := range conversants {
+		if conversant.ID == conversantID {
+			return conversant, true
+		}
+	}
+	return repositories.Conversant{}, false
+}
+
+// GetMessagesAfter returns the messages after sequence, oldest first, if the sender is in the conversation
+func (chat *chatInteractor) GetMessagesAfter(senderID, conversationID string, sequence int64, limit int) ([]repositories.Message, error) {
+	err := chat.authorize(conversationID, senderID)
+	if err != nil {
+		return nil, err
+	}
+
+	messages, err := chat.messageRepo.GetMessagesAfter(conversationID, sequence, limit)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return messages, nil
+}
+
+// Block blocks or mutes a conversant for the sender
+func (chat *chatInteractor) Block(request connection.BlockRequest) error {
+	err := request.Validate()
+	if err != nil {
+		return err
+	}
+
+	if request.ConversantID == request.SenderID {
+		return errBlockSelf
+	}
+
+	if chat.blockRepo == nil {
+		return errBlockUnsupported
+	}
+
+	return chat.blockRepo.Block(repositories.Block{
+		BlockerID: request.SenderID,
+		BlockedID: request.ConversantID,
+		Mute:      request.Mute,
+	})
+}
+
+// Unblock removes the sender's block or mute on a conversant
+func (chat *chatInteractor) Unblock(request connection.UnblockRequest) error {
+	err := request.Validate()
+	if err != nil {
+		return err
+	}
+
+	if chat.blockRepo == nil {
+		return errBlockUnsupported
+	}
+
+	return chat.blockRepo.Unblock(request.SenderID, request.ConversantID)
+}
+
+// isBlocked reports whether either conversant has blocked the other
+func (chat *chatInteractor) isBlocked(conversantID, otherID string) (bool, error) {
+	if chat.blockRepo == nil {
+		return false, nil
+	}
+
+	return chat.blockRepo.IsBlocked(conversantID, otherID)
+}
+
+// GetBlocked returns the blocks the conversant has made, keyed by who they blocked
+func (chat *chatInteractor) GetBlocked(conversantID string) (map[string]repositories.Block, error) {
+	if chat.blockRepo == nil {
+		return nil, nil
+	}
+
+	blocks, err := chat.blockRepo.GetBlocked(conversantID)
+	if err != nil {
+		return nil, err
+	}
+
+	blocked := make(map[string]repositories.Block, len(blocks))
+	for _, block := range blocks {
+		blocked[block.BlockedID] = block
+	}
+
+	return blocked, nil
+}
+
+// withoutBlocked drops the messages sent by conversants blocked according to blocked. Mutes
+// and system messages are kept, the same as when messages are delivered live
+func withoutBlocked(messages []repositories.Message, blocked map[string]repositories.Block) []repositories.Message {
+	if len(blocked) == 0 {
+		return messages
+	}
+
+	kept := make([]repositories.Message, 0, len(messages))
+	for _, message := range messages {
+		if block, ok := blocked[message.SenderID]; ok && !block.Mute && !message.System {
+			continue
+		}
+		kept = append(kept, message)
+	}
+	return kept
+}
+
+// GetBlockers returns the blocks on the sender, keyed by who blocked them
+func (chat *chatInteractor) GetBlockers(senderID string) (map[string]repositories.Block, error) {
+	if chat.blockRepo == nil {
+		return nil, nil
+	}
+
+	blocks, err := chat.blockRepo.GetBlockers(senderID)
+	if err != nil {
+		return nil, err
+	}
+
+	blockers := make(map[string]repositories.Block, len(blocks))
+	for _, block := range blocks {
+		blockers[block.BlockerID] = block
+	}
+
+	return blockers, nil
 }
 
 func (chat *chatInteractor) GetConversants(conversationID string) ([]repositories.Conversant, error) {
@@ -2,12 +2,17 @@ package chatty
 
 import (
 	"fmt"
+	"math"
 	"testing"
 
+	"github.com/pborman/uuid"
 	"github.com/ryan-berger/chatty/repositories"
+	"github.com/ryan-berger/chatty/repositories/memory"
 
 	"github.com/go-ozzo/ozzo-validation"
 	"github.com/ryan-berger/chatty/connection"
+	"github.com/ryan-berger/chatty/operators"
+	"github.com/ryan-berger/chatty/operators/policy"
 )
 
 var formError = map[string]map[string]string{
@@ -78,6 +83,46 @@ func TestChatInteractor_CreateConversation(t *testing.T) {
 	}
 }
 
+func TestChatInteractor_CreateConversationAuther(t *testing.T) {
+	created := false
+	convoRepo := &repositories.MockConversationRepo{
+		CreateConvo: func(conversation repositories.Conversation) (*repositories.Conversation, error) {
+			created = true
+			return &conversation, nil
+		},
+	}
+
+	senderID := uuid.New()
+	var creatorID string
+	interactor := &chatInteractor{
+		conversationRepo: convoRepo,
+		auther: &operators.MockAuther{
+			CanStartConvo: func(creator string, conversation repositories.Conversation) bool {
+				creatorID = creator
+				return false
+			},
+		},
+	}
+
+	_, err := interactor.CreateConversation(connection.CreateConversationRequest{
+		SenderID:    senderID,
+		Name:        "Test",
+		Conversants: []string{uuid.New()},
+	})
+
+	if _, ok := err.(*ForbiddenError); !ok {
+		t.Fatalf("expected a ForbiddenError, received %v", err)
+	}
+
+	if creatorID != senderID {
+		t.Fatalf("expected the auther to be asked about %s, received %s", senderID, creatorID)
+	}
+
+	if created {
+		t.Fatal("conversation shouldn't have been created")
+	}
+}
+
 func TestChatInteractor_GetConversation(t *testing.T) {
 	called := false
 	convoRepo := &repositories.MockConversationRepo{
@@ -99,3 +144,590 @@ func TestChatInteractor_GetConversation(t *testing.T) {
 		t.Fatalf("Retrieve Conversation shouldn't have been called")
 	}
 }
+
+func TestChatInteractor_GetConversationCursors(t *testing.T) {
+	store := memory.NewStore()
+	conversant := repositories.Conversant{ID: uuid.New()}
+	memory.NewConversantRepository(store).UpdateOrCreate(conversant)
+
+	conversationRepo := memory.NewConversationRepository(store)
+	conversation, err := conversationRepo.CreateConversation(repositories.Conversation{
+		Conversants: []repositories.Conversant{conversant},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	messageRepo := memory.NewMessageRepository(store)
+	for i := 0; i < 5; i++ {
+		messageRepo.CreateMessage(repositories.Message{SenderID: conversant.ID, ConversationID: conversation.ID})
+	}
+
+	interactor := newChatInteractor(messageRepo, conversationRepo, nil)
+
+	tests := []struct {
+		request    connection.RetrieveConversationRequest
+		sequences  []int64
+		prev, next int64
+	}{
+		{connection.RetrieveConversationRequest{Limit: 2}, []int64{5, 4}, 4, 0},
+		{connection.RetrieveConversationRequest{Limit: 2, Before: 4}, []int64{3, 2}, 2, 3},
+		{connection.RetrieveConversationRequest{Limit: 2, Before: 2}, []int64{1}, 0, 1},
+		{connection.RetrieveConversationRequest{Limit: 2, After: 1}, []int64{3, 2}, 2, 3},
+		{connection.RetrieveConversationRequest{Limit: 2, After: 3}, []int64{5, 4}, 4, 0},
+		{connection.RetrieveConversationRequest{Limit: 2, Offset: 2}, []int64{3, 2}, 2, 3},
+	}
+
+	for _, test := range tests {
+		test.request.ConversationID = conversation.ID
+		test.request.SenderID = conversant.ID
+
+		response, err := interactor.GetConversation(test.request)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var sequences []int64
+		for _, message := range response.Messages {
+			sequences = append(sequences, message.Sequence)
+		}
+
+		if fmt.Sprint(sequences) != fmt.Sprint(test.sequences) || response.PrevCursor != test.prev || response.NextCursor != test.next {
+			t.Fatalf("%+v: expected %v prev %d next %d, received %v prev %d next %d", test.request,
+				test.sequences, test.prev, test.next, sequences, response.PrevCursor, response.NextCursor)
+		}
+	}
+
+	_, err = interactor.GetConversation(connection.RetrieveConversationRequest{
+		SenderID:       conversant.ID,
+		ConversationID: conversation.ID,
+		Limit:          2,
+		Before:         4,
+		After:          1,
+	})
+	if err == nil {
+		t.Fatal("expected an error setting both before and after")
+	}
+
+	_, err = interactor.GetConversation(connection.RetrieveConversationRequest{
+		SenderID:       conversant.ID,
+		ConversationID: conversation.ID,
+		Limit:          math.MaxInt,
+	})
+	if err == nil {
+		t.Fatal("expected an error for a limit over 100")
+	}
+
+	outsider := repositories.Conversant{ID: uuid.New()}
+	memory.NewConversantRepository(store).UpdateOrCreate(outsider)
+
+	_, err = interactor.GetConversation(connection.RetrieveConversationRequest{
+		SenderID:       outsider.ID,
+		ConversationID: conversation.ID,
+		Limit:          2,
+	})
+	if _, ok := err.(*ForbiddenError); !ok {
+		t.Fatalf("expected a ForbiddenError for a conversant outside the conversation, received %v", err)
+	}
+
+	_, _, err = interactor.SendMessage(connection.SendMessageRequest{
+		SenderID:       outsider.ID,
+		ConversationID: conversation.ID,
+		Message:        "test",
+	})
+	if _, ok := err.(*ForbiddenError); !ok {
+		t.Fatalf("expected a ForbiddenError sending to another conversation, received %v", err)
+	}
+}
+
+func TestChatInteractor_ListConversationsUnread(t *testing.T) {
+	store := memory.NewStore()
+	conversants := []repositories.Conversant{{ID: uuid.New()}, {ID: uuid.New()}}
+	for _, conversant := range conversants {
+		memory.NewConversantRepository(store).UpdateOrCreate(conversant)
+	}
+
+	conversationRepo := memory.NewConversationRepository(store)
+	conversation, err := conversationRepo.CreateConversation(repositories.Conversation{Conversants: conversants})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	interactor := newChatInteractor(memory.NewMessageRepository(store), conversationRepo, nil)
+
+	unread := func(conversant repositories.Conversant) int64 {
+		summaries, err := interactor.ListConversations(connection.ListConversationsRequest{SenderID: conversant.ID, Limit: 10})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return summaries[0].UnreadCount
+	}
+
+	for i := 0; i < 3; i++ {
+		_, _, err = interactor.SendMessage(connection.SendMessageRequest{
+			SenderID:       conversants[0].ID,
+			ConversationID: conversation.ID,
+			Message:        "test",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if count := unread(conversants[0]); count != 0 {
+		t.Fatalf("expected the sender to have read their own messages, received %d unread", count)
+	}
+
+	if count := unread(conversants[1]); count != 3 {
+		t.Fatalf("expected 3 unread messages, received %d", count)
+	}
+
+	request := connection.RetrieveConversationRequest{SenderID: conversants[1].ID, ConversationID: conversation.ID, Limit: 1, Offset: 1}
+	if _, err = interactor.GetConversation(request); err != nil {
+		t.Fatal(err)
+	}
+
+	if count := unread(conversants[1]); count != 3 {
+		t.Fatalf("expected an older page not to mark messages read, received %d unread", count)
+	}
+
+	request.Offset = 0
+	if _, err = interactor.GetConversation(request); err != nil {
+		t.Fatal(err)
+	}
+
+	if count := unread(conversants[1]); count != 0 {
+		t.Fatalf("expected the newest page to mark the conversation read, received %d unread", count)
+	}
+}
+
+func TestChatInteractor_SendMessageDuplicate(t *testing.T) {
+	original := repositories.Message{ID: "original", IdempotencyKey: "key"}
+	messageRepo := &repositories.MockMessageRepo{
+		Create: func(message repositories.Message) (*repositories.Message, error) {
+			if message.IdempotencyKey == original.IdempotencyKey {
+				return &original, nil
+			}
+			return &message, nil
+		},
+	}
+
+	conversationRepo := repositories.DefaultMockConversationRepo().(*repositories.MockConversationRepo)
+	conversationRepo.GetConvo = func(conversationID string) ([]repositories.Conversant, error) {
+		return []repositories.Conversant{{ID: "d8ece527-a0e9-4513-8972-5a7b0f97785d"}}, nil
+	}
+
+	interactor := &chatInteractor{
+		messageRepo:      messageRepo,
+		conversationRepo: conversationRepo,
+	}
+
+	request := connection.SendMessageRequest{
+		SenderID:       "d8ece527-a0e9-4513-8972-5a7b0f97785d",
+		Message:        "Test",
+		ConversationID: "d8ece527-a0e9-4513-8972-5a7b0f97785d",
+	}
+
+	_, duplicate, err := interactor.SendMessage(request)
+	if err != nil {
+		t.Fatalf("Send message shouldn't have failed: %s", err)
+	}
+
+	if duplicate {
+		t.Fatalf("Message without a key shouldn't be a duplicate")
+	}
+
+	request.IdempotencyKey = "key"
+	message, duplicate, err := interactor.SendMessage(request)
+	if err != nil {
+		t.Fatalf("Send message shouldn't have failed: %s", err)
+	}
+
+	if !duplicate || message.ID != original.ID {
+		t.Fatalf("Resent message should return the original")
+	}
+}
+
+func TestChatInteractor_UpdateConversants(t *testing.T) {
+	store := memory.NewStore()
+	conversants := []repositories.Conversant{
+		{ID: uuid.New(), DisplayName: "alice"},
+		{ID: uuid.New(), DisplayName: "bob"},
+		{ID: uuid.New(), DisplayName: "carol"},
+		{ID: uuid.New()},
+	}
+	for _, conversant := range conversants {
+		memory.NewConversantRepository(store).UpdateOrCreate(conversant)
+	}
+
+	conversationRepo := memory.NewConversationRepository(store)
+	interactor := newChatInteractor(memory.NewMessageRepository(store), conversationRepo, nil)
+
+	direct, err := conversationRepo.CreateConversation(repositories.Conversation{Direct: true, Conversants: conversants[:2]})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = interactor.AddConversants(connection.AddConversantsRequest{
+		SenderID:       conversants[0].ID,
+		ConversationID: direct.ID,
+		Conversants:    []string{conversants[2].ID},
+	})
+	if err != errDirectConversation {
+		t.Fatalf("expected errDirectConversation, received %v", err)
+	}
+
+	owner := conversants[0]
+	owner.Role = repositories.RoleOwner
+	group, err := conversationRepo.CreateConversation(repositories.Conversation{Name: "group", Conversants: []repositories.Conversant{owner, conversants[1]}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = interactor.AddConversants(connection.AddConversantsRequest{
+		SenderID:       conversants[2].ID,
+		ConversationID: group.ID,
+		Conversants:    []string{conversants[3].ID},
+	})
+	if _, ok := err.(*ForbiddenError); !ok {
+		t.Fatalf("expected a ForbiddenError, received %v", err)
+	}
+
+	_, err = interactor.AddConversants(connection.AddConversantsRequest{
+		SenderID:       conversants[0].ID,
+		ConversationID: group.ID,
+		Conversants:    []string{conversants[1].ID},
+	})
+	if err != errAlreadyConversant {
+		t.Fatalf("expected errAlreadyConversant, received %v", err)
+	}
+
+	interactor.auther = policy.MaxGroupSize(3)
+	_, err = interactor.AddConversants(connection.AddConversantsRequest{
+		SenderID:       conversants[0].ID,
+		ConversationID: group.ID,
+		Conversants:    []string{conversants[2].ID, conversants[3].ID},
+	})
+	if err != errCantStartConversation {
+		t.Fatalf("expected the group size policy to apply to added conversants, received %v", err)
+	}
+	interactor.auther = nil
+
+	update, err := interactor.AddConversants(connection.AddConversantsRequest{
+		SenderID:       conversants[0].ID,
+		ConversationID: group.ID,
+		Conversants:    []string{conversants[2].ID, conversants[3].ID},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "alice added carol, " + conversants[3].ID
+	if !update.message.System || update.message.Message != expected {
+		t.Fatalf("expected system message %q, received %+v", expected, update.message)
+	}
+
+	if len(update.conversants) != 4 {
+		t.Fatalf("expected 4 conversants, received %+v", update.conversants)
+	}
+
+	_, err = interactor.RemoveConversants(connection.RemoveConversantsRequest{
+		SenderID:       conversants[0].ID,
+		ConversationID: group.ID,
+		Conversants:    []string{conversants[0].ID},
+	})
+	if err != errRemoveSelf {
+		t.Fatalf("expected errRemoveSelf, received %v", err)
+	}
+
+	update, err = interactor.RemoveConversants(connection.RemoveConversantsRequest{
+		SenderID:       conversants[0].ID,
+		ConversationID: group.ID,
+		Conversants:    []string{conversants[1].ID},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if update.message.Message != "alice removed bob" || len(update.conversants) != 3 {
+		t.Fatalf("expected bob to be removed, received %+v", update)
+	}
+
+	update, err = interactor.LeaveConversation(connection.LeaveConversationRequest{
+		SenderID:       conversants[2].ID,
+		ConversationID: group.ID,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if update.message.Message != "carol left" || len(update.conversants) != 2 {
+		t.Fatalf("expected carol to have left, received %+v", update)
+	}
+
+	if update.removed[0] != conversants[2].ID {
+		t.Fatalf("expected carol in removed, received %+v", update.removed)
+	}
+}
+
+func TestChatInteractor_Roles(t *testing.T) {
+	store := memory.NewStore()
+	conversants := []repositories.Conversant{
+		{ID: uuid.New(), DisplayName: "alice"},
+		{ID: uuid.New(), DisplayName: "bob"},
+		{ID: uuid.New(), DisplayName: "carol"},
+		{ID: uuid.New(), DisplayName: "dave"},
+	}
+	for _, conversant := range conversants {
+		memory.NewConversantRepository(store).UpdateOrCreate(conversant)
+	}
+	alice, bob, carol, dave := conversants[0].ID, conversants[1].ID, conversants[2].ID, conversants[3].ID
+
+	conversationRepo := memory.NewConversationRepository(store)
+	interactor := newChatInteractor(memory.NewMessageRepository(store), conversationRepo, nil)
+
+	group, err := interactor.CreateConversation(connection.CreateConversationRequest{
+		SenderID:    alice,
+		Name:        "group",
+		Conversants: []string{bob, carol, dave},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectErr := func(expected error, err error) {
+		t.Helper()
+		if err != expected {
+			t.Fatalf("expected %v, received %v", expected, err)
+		}
+	}
+
+	role := func(conversantID string) repositories.Role {
+		t.Helper()
+		received, err := conversationRepo.GetConversants(group.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		conversant, _ := findConversant(received, conversantID)
+		return conversant.Role
+	}
+
+	if role(alice) != repositories.RoleOwner || role(bob) != repositories.RoleMember {
+		t.Fatalf("expected the creator to be the owner and everyone else a member")
+	}
+
+	_, err = interactor.RenameConversation(connection.RenameConversationRequest{SenderID: bob, ConversationID: group.ID, Name: "bob's"})
+	expectErr(errNotManager, err)
+
+	_, err = interactor.SetRole(connection.SetRoleRequest{SenderID: alice, ConversationID: group.ID, ConversantID: dave, Role: repositories.RoleReadOnly})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, _, err = interactor.SendMessage(connection.SendMessageRequest{SenderID: dave, ConversationID: group.ID, Message: "hi"})
+	expectErr(errReadOnly, err)
+
+	update, err := interactor.SetRole(connection.SetRoleRequest{SenderID: alice, ConversationID: group.ID, ConversantID: bob, Role: repositories.RoleAdmin})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if update.message.Message != "alice made bob an admin" {
+		t.Fatalf("expected a system message for the role change, received %+v", update.message)
+	}
+
+	_, err = interactor.SetRole(connection.SetRoleRequest{SenderID: bob, ConversationID: group.ID, ConversantID: carol, Role: repositories.RoleAdmin})
+	expectErr(errNotOwner, err)
+
+	_, err = interactor.RemoveConversants(connection.RemoveConversantsRequest{SenderID: bob, ConversationID: group.ID, Conversants: []string{alice}})
+	expectErr(errNotOwner, err)
+
+	update, err = interactor.RenameConversation(connection.RenameConversationRequest{SenderID: bob, ConversationID: group.ID, Name: "renamed"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if update.name != "renamed" || update.message.Message != "bob renamed the conversation to renamed" {
+		t.Fatalf("expected the conversation to be renamed, received %+v", update)
+	}
+
+	_, err = interactor.DeleteConversation(connection.DeleteConversationRequest{SenderID: bob, ConversationID: group.ID})
+	expectErr(errNotOwner, err)
+
+	_, err = interactor.LeaveConversation(connection.LeaveConversationRequest{SenderID: alice, ConversationID: group.ID})
+	expectErr(errOwnerLeave, err)
+
+	_, err = interactor.SetRole(connection.SetRoleRequest{SenderID: alice, ConversationID: group.ID, ConversantID: carol, Role: repositories.RoleOwner})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if role(carol) != repositories.RoleOwner || role(alice) != repositories.RoleAdmin {
+		t.Fatalf("expected ownership to move to carol, and alice to become an admin")
+	}
+
+	if _, err = interactor.LeaveConversation(connection.LeaveConversationRequest{SenderID: alice, ConversationID: group.ID}); err != nil {
+		t.Fatal(err)
+	}
+
+	deleted, err := interactor.DeleteConversation(connection.DeleteConversationRequest{SenderID: carol, ConversationID: group.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(deleted) != 3 {
+		t.Fatalf("expected the 3 remaining conversants, received %+v", deleted)
+	}
+}
+
+func TestChatInteractor_RolesWithoutOwner(t *testing.T) {
+	store := memory.NewStore()
+	conversants := []repositories.Conversant{
+		{ID: uuid.New(), Role: repositories.RoleAdmin},
+		{ID: uuid.New(), Role: repositories.RoleAdmin},
+	}
+	for _, conversant := range conversants {
+		memory.NewConversantRepository(store).UpdateOrCreate(conversant)
+	}
+
+	// groups from before roles can be left without an owner, and their admins don't get the owner's rights
+	conversationRepo := memory.NewConversationRepository(store)
+	group, err := conversationRepo.CreateConversation(repositories.Conversation{Name: "group", Conversants: conversants})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	interactor := newChatInteractor(memory.NewMessageRepository(store), conversationRepo, nil)
+	_, err = interactor.RemoveConversants(connection.RemoveConversantsRequest{
+		SenderID:       conversants[0].ID,
+		ConversationID: group.ID,
+		Conversants:    []string{conversants[1].ID},
+	})
+	if err != errNotOwner {
+		t.Fatalf("expected errNotOwner removing an admin, received %v", err)
+	}
+
+	_, err = interactor.DeleteConversation(connection.DeleteConversationRequest{
+		SenderID:       conversants[0].ID,
+		ConversationID: group.ID,
+	})
+	if err != errNotOwner {
+		t.Fatalf("expected errNotOwner deleting the conversation, received %v", err)
+	}
+}
+
+func TestChatInteractor_Block(t *testing.T) {
+	store := memory.NewStore()
+	interactor := newChatInteractor(memory.NewMessageRepository(store), memory.NewConversationRepository(store), nil)
+	interactor.blockRepo = memory.NewBlockRepository(store)
+
+	a, b := uuid.New(), uuid.New()
+	for _, id := range []string{a, b} {
+		memory.NewConversantRepository(store).UpdateOrCreate(repositories.Conversant{ID: id})
+	}
+
+	if err := interactor.Block(connection.BlockRequest{SenderID: a, ConversantID: a}); err != errBlockSelf {
+		t.Fatalf("expected errBlockSelf, received %v", err)
+	}
+
+	start := func(senderID, conversantID string) error {
+		_, err := interactor.CreateConversation(connection.CreateConversationRequest{
+			SenderID:    senderID,
+			Name:        "direct",
+			Conversants: []string{conversantID},
+		})
+		return err
+	}
+
+	if err := interactor.Block(connection.BlockRequest{SenderID: a, ConversantID: b}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the blocked conversant can't start one either
+	for _, err := range []error{start(a, b), start(b, a)} {
+		if err != errBlocked {
+			t.Fatalf("expected errBlocked, received %v", err)
+		}
+	}
+
+	if err := interactor.Block(connection.BlockRequest{SenderID: a, ConversantID: b, Mute: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := start(b, a); err != nil {
+		t.Fatalf("expected muting not to stop direct conversations, received %v", err)
+	}
+
+	if err := interactor.Unblock(connection.UnblockRequest{SenderID: a, ConversantID: b}); err != nil {
+		t.Fatal(err)
+	}
+
+	blockers, err := interactor.GetBlockers(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(blockers) != 0 {
+		t.Fatalf("expected no blocks after unblocking, received %+v", blockers)
+	}
+}
+
+func TestChatInteractor_BlockHistory(t *testing.T) {
+	store := memory.NewStore()
+	conversants := []repositories.Conversant{{ID: uuid.New()}, {ID: uuid.New()}, {ID: uuid.New()}}
+	for _, conversant := range conversants {
+		memory.NewConversantRepository(store).UpdateOrCreate(conversant)
+	}
+	a, b, c := conversants[0].ID, conversants[1].ID, conversants[2].ID
+
+	conversationRepo := memory.NewConversationRepository(store)
+	conversation, err := conversationRepo.CreateConversation(repositories.Conversation{Conversants: conversants})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	messageRepo := memory.NewMessageRepository(store)
+	for _, message := range []repositories.Message{
+		{SenderID: b, Message: "blocked"},
+		{SenderID: c, Message: "sent"},
+		{SenderID: b, Message: "added c", System: true},
+		{SenderID: b, Message: "blocked"},
+	} {
+		message.ConversationID = conversation.ID
+		if _, err := messageRepo.CreateMessage(message); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	interactor := newChatInteractor(messageRepo, conversationRepo, nil)
+	interactor.blockRepo = memory.NewBlockRepository(store)
+
+	if err := interactor.Block(connection.BlockRequest{SenderID: a, ConversantID: b}); err != nil {
+		t.Fatal(err)
+	}
+
+	request := connection.RetrieveConversationRequest{SenderID: a, ConversationID: conversation.ID, Limit: 2}
+	response, err := interactor.GetConversation(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the page still covers the blocked message, so the cursor moves past it
+	if len(response.Messages) != 1 || response.Messages[0].Sequence != 3 || response.PrevCursor != 3 {
+		t.Fatalf("expected only the system message with prev cursor 3, received %+v prev %d", response.Messages, response.PrevCursor)
+	}
+
+	if err := interactor.Block(connection.BlockRequest{SenderID: a, ConversantID: b, Mute: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	request.Limit = 10
+	response, err = interactor.GetConversation(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(response.Messages) != 4 {
+		t.Fatalf("expected muted conversants' messages to be kept, received %+v", response.Messages)
+	}
+}
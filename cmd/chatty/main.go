@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/lib/pq"
+	"github.com/ryan-berger/chatty/cmd/internal/setup"
+	"github.com/ryan-berger/chatty/repositories/postgres"
+)
+
+const usage = `usage: chatty migrate up|down [steps]|baseline <version>|status
+
+up                  applies every migration that hasn't been applied
+down [steps]        rolls back the most recently applied migration, or the last steps of them
+baseline <version>  records migrations up to version as applied without running them,
+                    for databases that were migrated by hand
+status              lists the migrations and whether they have been applied
+
+Databases migrated with golang-migrate are adopted from its schema_migrations table
+
+The database is configured with POSTGRES_HOST, POSTGRES_DB, POSTGRES_USER and POSTGRES_PASSWORD`
+
+func main() {
+	if len(os.Args) < 3 || len(os.Args) > 4 || os.Args[1] != "migrate" {
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	db, err := sqlx.Open("postgres", setup.DBString())
+	if err != nil {
+		fail(err)
+	}
+	defer db.Close()
+
+	switch command, args := os.Args[2], os.Args[3:]; {
+	case command == "up" && len(args) == 0:
+		err = postgres.Migrate(db, postgres.Up)
+	case command == "down" && len(args) == 0:
+		err = postgres.Migrate(db, postgres.Down)
+	case command == "down":
+		steps, parseErr := strconv.Atoi(args[0])
+		if parseErr != nil || steps < 1 {
+			fmt.Fprintln(os.Stderr, usage)
+			os.Exit(2)
+		}
+		err = postgres.Rollback(db, steps)
+	case command == "baseline" && len(args) == 1:
+		version, parseErr := strconv.ParseInt(args[0], 10, 64)
+		if parseErr != nil {
+			fmt.Fprintln(os.Stderr, usage)
+			os.Exit(2)
+		}
+		err = postgres.Baseline(db, version)
+	case command == "status" && len(args) == 0:
+		err = status(db)
+	default:
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	if err != nil {
+		fail(err)
+	}
+}
+
+func status(db *sqlx.DB) error {
+	migrations, err := postgres.MigrationStatus(db)
+	if err != nil {
+		return err
+	}
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(writer, "VERSION\tNAME\tAPPLIED")
+	for _, migration := range migrations {
+		fmt.Fprintf(writer, "%d\t%s\t%t\n", migration.Version, migration.Name, migration.Applied)
+	}
+	return writer.Flush()
+}
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, err)
+	os.Exit(1)
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"net"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/ryan-berger/chatty/cmd/internal/setup"
+	"github.com/ryan-berger/chatty/connection/implementations"
+	"github.com/ryan-berger/chatty/connection/jwtauth"
+	"github.com/ryan-berger/chatty/repositories"
+)
+
+var addr = flag.String("addr", ":8081", "address to listen on")
+
+// metadataAuth authenticates calls with a bearer token in their authorization metadata. Clients
+// have to send a reauthenticate request with {"authorization": "Bearer ..."} before it expires
+func metadataAuth(authenticator *jwtauth.Authenticator) implementations.ExpiringMetadataAuth {
+	return func(md metadata.MD) (repositories.Conversant, time.Time, error) {
+		values := md.Get("authorization")
+		if len(values) == 0 {
+			return repositories.Conversant{}, time.Time{}, jwtauth.ErrNoToken
+		}
+
+		return authenticator.ExpiringAuth(jwtauth.BearerCredentials(values[0]))
+	}
+}
+
+func main() {
+	flag.Parse()
+
+	man, err := setup.NewManager()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	authenticator, err := setup.NewAuthenticator()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	lis, err := net.Listen("tcp", *addr)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	server := grpc.NewServer()
+	implementations.RegisterChattyServer(server, implementations.NewExpiringGRPCServer(man.Join, metadataAuth(authenticator)))
+	log.Fatal(server.Serve(lis))
+}
@@ -0,0 +1,163 @@
+// Package setup holds the flags and wiring the chatty servers share, so that
+// the websocket, TCP and gRPC servers are configured the same way
+package setup
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/lib/pq"
+
+	"github.com/ryan-berger/chatty"
+	"github.com/ryan-berger/chatty/connection/jwtauth"
+	"github.com/ryan-berger/chatty/operators/noop"
+	"github.com/ryan-berger/chatty/operators/policy"
+	"github.com/ryan-berger/chatty/repositories"
+	"github.com/ryan-berger/chatty/repositories/bolt"
+	"github.com/ryan-berger/chatty/repositories/memory"
+	"github.com/ryan-berger/chatty/repositories/mysql"
+	"github.com/ryan-berger/chatty/repositories/postgres"
+	"github.com/ryan-berger/chatty/repositories/sqlite"
+)
+
+var (
+	inMemory   = flag.Bool("memory", false, "keep everything in memory instead of postgres, for development")
+	boltPath   = flag.String("bolt", "", "store everything in the bbolt database at this path instead of postgres")
+	sqlitePath = flag.String("sqlite", "", "store everything in the SQLite database at this path instead of postgres")
+	mysqlDSN   = flag.String("mysql", "", "store everything in the MySQL database with this DSN instead of postgres")
+	migrate    = flag.Bool("migrate", false, "apply any postgres, SQLite or MySQL migrations that haven't been applied before starting")
+
+	maxGroupSize = flag.Int("max-group-size", 20, "the most conversants a conversation can have")
+
+	jwksPath    = flag.String("jwks", "", "JWKS file with the keys tokens are signed with. Without it, JWT_SECRET is used as an HS256 secret")
+	jwtAudience = flag.String("jwt-audience", "", "audience tokens must be for, if set")
+	jwtIssuer   = flag.String("jwt-issuer", "", "issuer tokens must be from, if set")
+	jwtSkew     = flag.Duration("jwt-clock-skew", 30*time.Second, "how far token times can be off by")
+)
+
+// membershipTTL is how long membership lookups are cached. Conversants removed
+// by another server can keep sending to the conversation for up to this long
+const membershipTTL = time.Minute
+
+// DBString is the postgres connection string, from POSTGRES_HOST,
+// POSTGRES_DB, POSTGRES_USER and POSTGRES_PASSWORD
+func DBString() string {
+	return fmt.Sprintf(
+		"host=%s database=%s user=%s password=%s sslmode=disable",
+		os.Getenv("POSTGRES_HOST"),
+		os.Getenv("POSTGRES_DB"),
+		os.Getenv("POSTGRES_USER"),
+		os.Getenv("POSTGRES_PASSWORD"))
+}
+
+// NewAuthenticator verifies tokens with the keys in -jwks, or the JWT_SECRET environment variable
+func NewAuthenticator() (*jwtauth.Authenticator, error) {
+	var keys []jwtauth.Key
+	if *jwksPath != "" {
+		var err error
+		keys, err = jwtauth.LoadJWKS(*jwksPath)
+		if err != nil {
+			return nil, err
+		}
+	} else if secret := os.Getenv("JWT_SECRET"); secret != "" {
+		keys = []jwtauth.Key{jwtauth.HMACKey("", []byte(secret))}
+	} else {
+		return nil, errors.New("either -jwks or JWT_SECRET must be set")
+	}
+
+	return jwtauth.New(jwtauth.Config{
+		Keys:      keys,
+		Audience:  *jwtAudience,
+		Issuer:    *jwtIssuer,
+		ClockSkew: *jwtSkew,
+	}), nil
+}
+
+// NewManager creates a manager storing everything where the flags say to, in postgres
+// unless -memory, -bolt, -sqlite or -mysql is set. The SQL backends are only migrated
+// with -migrate, while bolt brings its buckets up to date whenever it's opened
+func NewManager() (*chatty.ConnectionManager, error) {
+	var (
+		conversationRepo repositories.ConversationRepo
+		messageRepo      repositories.MessageRepo
+		conversantRepo   repositories.ConversantRepo
+		blockRepo        repositories.BlockRepo
+	)
+
+	if *inMemory {
+		store := memory.NewStore()
+		conversationRepo = memory.NewConversationRepository(store)
+		messageRepo = memory.NewMessageRepository(store)
+		conversantRepo = memory.NewConversantRepository(store)
+		blockRepo = memory.NewBlockRepository(store)
+	} else if *boltPath != "" {
+		db, err := bolt.Open(*boltPath)
+		if err != nil {
+			return nil, err
+		}
+
+		conversationRepo = bolt.NewConversationRepository(db)
+		messageRepo = bolt.NewMessageRepository(db)
+		conversantRepo = bolt.NewConversantRepository(db)
+		blockRepo = bolt.NewBlockRepository(db)
+	} else if *sqlitePath != "" {
+		db, err := sqlite.Open(*sqlitePath)
+		if err != nil {
+			return nil, err
+		}
+
+		if *migrate {
+			if err = sqlite.Migrate(db, sqlite.Up); err != nil {
+				return nil, err
+			}
+		}
+
+		conversationRepo = sqlite.NewConversationRepository(db)
+		messageRepo = sqlite.NewMessageRepository(db)
+		conversantRepo = sqlite.NewConversantRepository(db)
+		blockRepo = sqlite.NewBlockRepository(db)
+	} else if *mysqlDSN != "" {
+		db, err := mysql.Open(*mysqlDSN)
+		if err != nil {
+			return nil, err
+		}
+
+		if *migrate {
+			if err = mysql.Migrate(db, mysql.Up); err != nil {
+				return nil, err
+			}
+		}
+
+		conversationRepo = mysql.NewConversationRepository(db)
+		messageRepo = mysql.NewMessageRepository(db)
+		conversantRepo = mysql.NewConversantRepository(db)
+		blockRepo = mysql.NewBlockRepository(db)
+	} else {
+		db, err := sqlx.Open("postgres", DBString())
+		if err != nil {
+			return nil, err
+		}
+
+		if *migrate {
+			if err = postgres.Migrate(db, postgres.Up); err != nil {
+				return nil, err
+			}
+		}
+
+		conversationRepo = postgres.NewConversationRepository(db)
+		messageRepo = postgres.NewMessageRepository(db)
+		conversantRepo = postgres.NewConversantRepository(db)
+		blockRepo = postgres.NewBlockRepository(db)
+	}
+
+	// membership is checked on every message, so don't go to the database for it every time
+	conversationRepo = repositories.NewMembershipCache(conversationRepo, membershipTTL)
+
+	notifier := noop.NewNotifier()
+	auther := policy.MaxGroupSize(*maxGroupSize)
+	return chatty.NewManager(messageRepo, conversationRepo, conversantRepo, blockRepo, auther, notifier), nil
+}
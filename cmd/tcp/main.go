@@ -0,0 +1,48 @@
+package main
+
+import (
+	"crypto/tls"
+	"flag"
+	"log"
+
+	"github.com/ryan-berger/chatty/cmd/internal/setup"
+	"github.com/ryan-berger/chatty/connection/implementations"
+)
+
+var (
+	addr     = flag.String("addr", ":8082", "address to listen on")
+	certFile = flag.String("cert", "", "TLS certificate file, serves plain TCP when empty")
+	keyFile  = flag.String("key", "", "TLS key file")
+)
+
+func main() {
+	flag.Parse()
+
+	man, err := setup.NewManager()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// clients send {"access_token": "..."} as their credentials line, and have to send a
+	// reauthenticate request with a fresh token before it expires
+	authenticator, err := setup.NewAuthenticator()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var config *tls.Config
+	if *certFile != "" {
+		cert, err := tls.LoadX509KeyPair(*certFile, *keyFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		config = &tls.Config{Certificates: []tls.Certificate{cert}}
+	}
+
+	listener, err := implementations.ListenTCP(*addr, config)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	log.Fatal(implementations.ServeExpiringTCP(listener, man.Join, authenticator.ExpiringAuth))
+}
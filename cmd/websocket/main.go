@@ -1,30 +1,22 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"log"
 	"net/http"
 	"net/http/pprof"
-	"os"
+	"time"
 
 	"github.com/gorilla/websocket"
 	ws "github.com/ryan-berger/chatty/connection/implementations"
+	"github.com/ryan-berger/chatty/connection/jwtauth"
 
-	"github.com/jmoiron/sqlx"
-	_ "github.com/lib/pq"
 	"github.com/ryan-berger/chatty"
-	"github.com/ryan-berger/chatty/operators/noop"
-	"github.com/ryan-berger/chatty/repositories/postgres"
+	"github.com/ryan-berger/chatty/cmd/internal/setup"
 )
 
-func getDBString() string {
-	return fmt.Sprintf(
-		"host=%s database=%s user=%s password=%s sslmode=disable",
-		os.Getenv("POSTGRES_HOST"),
-		os.Getenv("POSTGRES_DB"),
-		os.Getenv("POSTGRES_USER"),
-		os.Getenv("POSTGRES_PASSWORD"))
-}
+var addr = flag.String("addr", ":8080", "address to listen on")
 
 var upgrader = websocket.Upgrader{
 	ReadBufferSize:  1024,
@@ -32,29 +24,36 @@ var upgrader = websocket.Upgrader{
 	CheckOrigin: func(r *http.Request) bool {
 		return true
 	},
+	Subprotocols: ws.Subprotocols(),
 }
 
 func main() {
-	db, err := sqlx.Open("postgres", getDBString())
+	flag.Parse()
 
+	man, err := setup.NewManager()
 	if err != nil {
-		panic(err)
+		log.Fatal(err)
 	}
 
-	conversationRepo := postgres.NewConversationRepository(db)
-	messageRepo := postgres.NewMessageRepository(db)
-
-	notifier := noop.NewNotifier()
-	man := chatty.NewManager(messageRepo, conversationRepo, nil, nil, notifier)
+	authenticator, err := setup.NewAuthenticator()
+	if err != nil {
+		log.Fatal(err)
+	}
 
 	http.HandleFunc("/", pprof.Index)
 	http.HandleFunc("/ws", func(writer http.ResponseWriter, request *http.Request) {
-		serveWs(man, writer, request)
+		serveWs(man, authenticator, writer, request)
 	})
-	log.Fatal(http.ListenAndServe(":8080", nil))
+	http.Handle("/sse", ws.NewExpiringSSEHandler(man.Join, authenticator.ExpiringAuth))
+	http.Handle("/poll", ws.NewExpiringLongPollHandler(man.Join, authenticator.ExpiringAuth, time.Minute))
+	log.Fatal(http.ListenAndServe(*addr, nil))
 }
 
-func serveWs(manager *chatty.ConnectionManager, writer http.ResponseWriter, request *http.Request) {
+// serveWs upgrades the request, taking the token from it if there is one. Otherwise
+// the client sends {"access_token": "..."} as its first frame. Either way, it has
+// to send a reauthenticate request with a fresh token before the token expires
+func serveWs(manager *chatty.ConnectionManager, authenticator *jwtauth.Authenticator, writer http.ResponseWriter, request *http.Request) {
+	creds := jwtauth.RequestCredentials(request)
 	conn, err := upgrader.Upgrade(writer, request, nil)
 
 	fmt.Println("upgrade")
@@ -64,5 +63,5 @@ func serveWs(manager *chatty.ConnectionManager, writer http.ResponseWriter, requ
 		return
 	}
 
-	manager.Join(ws.NewWebsocketConn(conn, nil))
+	manager.Join(ws.NewExpiringWebsocketConn(conn, authenticator.ExpiringAuth, creds))
 }
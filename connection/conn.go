@@ -1,18 +1,30 @@
 package connection
 
 import (
+	"time"
+
 	"github.com/ryan-berger/chatty/repositories"
 )
 
 // Conn is the generic connection interface that allows
 // multiple connections to talk to each other over any
-// protocol
+// protocol. Close hangs up on the client once the responses
+// already sent have been written, and then sends on Leave
 type Conn interface {
 	Authorize() error
 	GetConversant() repositories.Conversant
 	Requests() chan Request
 	Response() chan Response
 	Leave() chan struct{}
+	Close()
+}
+
+// Expiring is implemented by Conns whose credentials expire, such as tokens. Expiry is
+// when the current credentials expire, or the zero time if they never do. Reauthenticate
+// replaces them with fresh credentials for the same conversant, moving Expiry
+type Expiring interface {
+	Expiry() time.Time
+	Reauthenticate(creds map[string]string) error
 }
 
 type MockConn struct {
@@ -21,6 +33,7 @@ type MockConn struct {
 	Request    func() chan Request
 	Resp       func() chan Response
 	Leaver     func() chan struct{}
+	Closer     func()
 }
 
 func (mock *MockConn) Authorize() error {
@@ -42,3 +55,22 @@ func (mock *MockConn) Leave() chan struct{} {
 func (mock *MockConn) GetConversant() repositories.Conversant {
 	return mock.Conversant()
 }
+
+func (mock *MockConn) Close() {
+	mock.Closer()
+}
+
+// MockExpiringConn is a MockConn with expiring credentials
+type MockExpiringConn struct {
+	*MockConn
+	ExpiresAt func() time.Time
+	Reauth    func(creds map[string]string) error
+}
+
+func (mock *MockExpiringConn) Expiry() time.Time {
+	return mock.ExpiresAt()
+}
+
+func (mock *MockExpiringConn) Reauthenticate(creds map[string]string) error {
+	return mock.Reauth(creds)
+}
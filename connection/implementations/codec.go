@@ -0,0 +1,160 @@
+package implementations
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/gorilla/websocket"
+	"github.com/vmihailenco/msgpack/v5"
+
+	"github.com/ryan-berger/chatty/connection"
+)
+
+// Subprotocols the websocket Conn understands, in order of preference. Pass these
+// as websocket.Upgrader.Subprotocols so that clients can negotiate a codec
+const (
+	JSONSubprotocol     = "chatty.json"
+	MsgpackSubprotocol  = "chatty.msgpack"
+	CBORSubprotocol     = "chatty.cbor"
+	ProtobufSubprotocol = "chatty.protobuf"
+)
+
+// Codec decodes requests and encodes responses for the websocket Conn. Every codec
+// uses the same {type, data} envelope and type strings, only the encoding differs
+type Codec interface {
+	Subprotocol() string
+	MessageType() int
+	DecodeCredentials(data []byte) map[string]string
+	DecodeRequest(data []byte) connection.Request
+	EncodeResponse(response connection.Response) ([]byte, error)
+}
+
+var codecs = map[string]Codec{
+	JSONSubprotocol:     jsonCodec{},
+	MsgpackSubprotocol:  msgpackCodec{},
+	CBORSubprotocol:     cborCodec{},
+	ProtobufSubprotocol: protobufCodec{},
+}
+
+// Subprotocols returns every codec subprotocol, in order of preference
+func Subprotocols() []string {
+	return []string{ProtobufSubprotocol, CBORSubprotocol, MsgpackSubprotocol, JSONSubprotocol}
+}
+
+// CodecFor returns the codec for a negotiated subprotocol,
+// falling back to JSON when there isn't one
+func CodecFor(subprotocol string) Codec {
+	if codec, ok := codecs[subprotocol]; ok {
+		return codec
+	}
+	return jsonCodec{}
+}
+
+func newWsResponse(response connection.Response) wsResponse {
+	return wsResponse{ResponseType: typeToString[response.Type], Data: response.Data, RequestID: response.RequestID}
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Subprotocol() string {
+	return JSONSubprotocol
+}
+
+func (jsonCodec) MessageType() int {
+	return websocket.TextMessage
+}
+
+func (jsonCodec) DecodeCredentials(data []byte) map[string]string {
+	var creds map[string]string
+	json.Unmarshal(data, &creds)
+	return creds
+}
+
+func (jsonCodec) DecodeRequest(data []byte) connection.Request {
+	return wsRequestData(data)
+}
+
+func (jsonCodec) EncodeResponse(response connection.Response) ([]byte, error) {
+	return json.Marshal(newWsResponse(response))
+}
+
+// msgpackCodec uses the json struct tags so that field names match the JSON codec
+type msgpackCodec struct{}
+
+type msgpackRequest struct {
+	RequestType requestType        `msgpack:"type"`
+	RequestID   string             `msgpack:"requestId"`
+	Data        msgpack.RawMessage `msgpack:"data"`
+}
+
+func msgpackUnmarshal(data []byte, v interface{}) error {
+	decoder := msgpack.NewDecoder(bytes.NewReader(data))
+	decoder.SetCustomStructTag("json")
+	return decoder.Decode(v)
+}
+
+func (msgpackCodec) Subprotocol() string {
+	return MsgpackSubprotocol
+}
+
+func (msgpackCodec) MessageType() int {
+	return websocket.BinaryMessage
+}
+
+func (msgpackCodec) DecodeCredentials(data []byte) map[string]string {
+	var creds map[string]string
+	msgpackUnmarshal(data, &creds)
+	return creds
+}
+
+func (msgpackCodec) DecodeRequest(data []byte) connection.Request {
+	var request msgpackRequest
+	msgpackUnmarshal(data, &request)
+	req := decodeRequestData(request.RequestType, request.Data, msgpackUnmarshal)
+	req.RequestID = request.RequestID
+	return req
+}
+
+func (msgpackCodec) EncodeResponse(response connection.Response) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := msgpack.NewEncoder(&buf)
+	encoder.SetCustomStructTag("json")
+	err := encoder.Encode(newWsResponse(response))
+	return buf.Bytes(), err
+}
+
+// cborCodec falls back to the json struct tags so that field names match the JSON codec
+type cborCodec struct{}
+
+type cborRequest struct {
+	RequestType requestType     `cbor:"type"`
+	RequestID   string          `cbor:"requestId"`
+	Data        cbor.RawMessage `cbor:"data"`
+}
+
+func (cborCodec) Subprotocol() string {
+	return CBORSubprotocol
+}
+
+func (cborCodec) MessageType() int {
+	return websocket.BinaryMessage
+}
+
+func (cborCodec) DecodeCredentials(data []byte) map[string]string {
+	var creds map[string]string
+	cbor.Unmarshal(data, &creds)
+	return creds
+}
+
+func (cborCodec) DecodeRequest(data []byte) connection.Request {
+	var request cborRequest
+	cbor.Unmarshal(data, &request)
+	req := decodeRequestData(request.RequestType, request.Data, cbor.Unmarshal)
+	req.RequestID = request.RequestID
+	return req
+}
+
+func (cborCodec) EncodeResponse(response connection.Response) ([]byte, error) {
+	return cbor.Marshal(newWsResponse(response))
+}
@@ -0,0 +1,137 @@
+package implementations
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/vmihailenco/msgpack/v5"
+
+	"github.com/ryan-berger/chatty/connection"
+	"github.com/ryan-berger/chatty/repositories"
+)
+
+type testEnvelope struct {
+	Type string                 `json:"type" msgpack:"type" cbor:"type"`
+	Data map[string]interface{} `json:"data" msgpack:"data" cbor:"data"`
+}
+
+var codecTests = []struct {
+	subprotocol string
+	marshal     func(interface{}) ([]byte, error)
+	unmarshal   func([]byte, interface{}) error
+}{
+	{
+		subprotocol: JSONSubprotocol,
+		marshal:     json.Marshal,
+		unmarshal:   json.Unmarshal,
+	},
+	{
+		subprotocol: MsgpackSubprotocol,
+		marshal:     msgpack.Marshal,
+		unmarshal:   msgpack.Unmarshal,
+	},
+	{
+		subprotocol: CBORSubprotocol,
+		marshal:     cbor.Marshal,
+		unmarshal:   cbor.Unmarshal,
+	},
+}
+
+func TestCodecFor(t *testing.T) {
+	for _, test := range codecTests {
+		if codec := CodecFor(test.subprotocol); codec.Subprotocol() != test.subprotocol {
+			t.Fatalf("expected %s codec, received %s", test.subprotocol, codec.Subprotocol())
+		}
+	}
+
+	if codec := CodecFor("asdf"); codec.Subprotocol() != JSONSubprotocol {
+		t.Fatalf("expected fallback to %s, received %s", JSONSubprotocol, codec.Subprotocol())
+	}
+}
+
+func TestCodec_DecodeRequest(t *testing.T) {
+	for _, test := range codecTests {
+		codec := CodecFor(test.subprotocol)
+
+		b, err := test.marshal(testEnvelope{
+			Type: string(sendMessage),
+			Data: map[string]interface{}{"message": "test", "conversationId": "testID"},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req := codec.DecodeRequest(b)
+		if req.Type != connection.SendMessage {
+			t.Fatalf("%s: expected %d, type was actually: %d", test.subprotocol, connection.SendMessage, req.Type)
+		}
+
+		data := req.Data.(connection.SendMessageRequest)
+		if data.Message != "test" || data.ConversationID != "testID" {
+			t.Fatalf("%s: request decoded incorrectly: %+v", test.subprotocol, data)
+		}
+	}
+}
+
+func TestCodec_EncodeResponse(t *testing.T) {
+	for _, test := range codecTests {
+		codec := CodecFor(test.subprotocol)
+
+		b, err := codec.EncodeResponse(connection.Response{
+			Type: connection.NewMessage,
+			Data: repositories.Message{ID: "testID", Message: "test"},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var envelope testEnvelope
+		if err := test.unmarshal(b, &envelope); err != nil {
+			t.Fatal(err)
+		}
+
+		if envelope.Type != string(newMessage) {
+			t.Fatalf("%s: expected %s, received %s", test.subprotocol, newMessage, envelope.Type)
+		}
+
+		if envelope.Data["id"] != "testID" || envelope.Data["message"] != "test" {
+			t.Fatalf("%s: response encoded incorrectly: %v", test.subprotocol, envelope.Data)
+		}
+	}
+}
+
+func TestCodec_DecodeCredentials(t *testing.T) {
+	for _, test := range codecTests {
+		b, _ := test.marshal(map[string]string{"id": "testID"})
+
+		creds := CodecFor(test.subprotocol).DecodeCredentials(b)
+		if creds["id"] != "testID" {
+			t.Fatalf("%s: expected testID, received %s", test.subprotocol, creds["id"])
+		}
+	}
+}
+
+func TestConn_BinaryCodec(t *testing.T) {
+	writeChan := make(chan []byte)
+	conn := NewWebsocketConn(&testConn{
+		writeChan: writeChan,
+		writeErr: func() error {
+			return nil
+		},
+		subprotocol: MsgpackSubprotocol,
+	}, nil)
+
+	go conn.pumpOut()
+
+	conn.Response() <- connection.Response{Type: connection.NewConversation}
+	b := <-writeChan
+
+	expected, _ := msgpackCodec{}.EncodeResponse(connection.Response{Type: connection.NewConversation})
+	if !bytes.Equal(b, expected) {
+		t.Fatalf("expected %v, received %v", expected, b)
+	}
+
+	conn.Close()
+}
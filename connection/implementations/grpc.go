@@ -0,0 +1,318 @@
+package implementations
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/ryan-berger/chatty/connection"
+	"github.com/ryan-berger/chatty/repositories"
+)
+
+// Frame is the message sent in both directions over the Chat stream. Type uses
+// the same strings as the websocket implementation, and Data holds the same JSON
+// body that would be found in a websocket frame's data field. See chatty.proto
+type Frame struct {
+	Type      string `protobuf:"bytes,1,opt,name=type,proto3" json:"type,omitempty"`
+	Data      []byte `protobuf:"bytes,2,opt,name=data,proto3" json:"data,omitempty"`
+	RequestId string `protobuf:"bytes,3,opt,name=request_id,json=requestId,proto3" json:"request_id,omitempty"`
+}
+
+// Reset satisfies proto.Message
+func (m *Frame) Reset() { *m = Frame{} }
+
+// String satisfies proto.Message
+func (m *Frame) String() string { return proto.CompactTextString(m) }
+
+// ProtoMessage satisfies proto.Message
+func (*Frame) ProtoMessage() {}
+
+func newFrame(response connection.Response) (*Frame, error) {
+	data, err := json.Marshal(response.Data)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Frame{Type: string(typeToString[response.Type]), Data: data, RequestId: response.RequestID}, nil
+}
+
+func (m *Frame) request() connection.Request {
+	req := requestData(requestType(m.Type), m.Data)
+	req.RequestID = m.RequestId
+	return req
+}
+
+// ChatStream is the server side of the bidirectional Chat stream
+type ChatStream interface {
+	Send(*Frame) error
+	Recv() (*Frame, error)
+	Context() context.Context
+}
+
+// ChattyServer is the server API for the chatty.Chatty service
+type ChattyServer interface {
+	Chat(ChatStream) error
+}
+
+type chatStream struct {
+	grpc.ServerStream
+}
+
+func (stream *chatStream) Send(frame *Frame) error {
+	return stream.ServerStream.SendMsg(frame)
+}
+
+func (stream *chatStream) Recv() (*Frame, error) {
+	frame := new(Frame)
+	if err := stream.ServerStream.RecvMsg(frame); err != nil {
+		return nil, err
+	}
+	return frame, nil
+}
+
+func chatHandler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(ChattyServer).Chat(&chatStream{stream})
+}
+
+var chattyServiceDesc = grpc.ServiceDesc{
+	ServiceName: "chatty.Chatty",
+	HandlerType: (*ChattyServer)(nil),
+	Methods:     []grpc.MethodDesc{},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Chat",
+			Handler:       chatHandler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "chatty.proto",
+}
+
+// RegisterChattyServer registers a ChattyServer with a grpc.Server
+func RegisterChattyServer(s *grpc.Server, srv ChattyServer) {
+	s.RegisterService(&chattyServiceDesc, srv)
+}
+
+// MetadataAuth authorizes a gRPC stream using the metadata sent with the call
+type MetadataAuth func(metadata.MD) (repositories.Conversant, error)
+
+// ExpiringMetadataAuth is a MetadataAuth for credentials that expire, like tokens,
+// that also returns when they do
+type ExpiringMetadataAuth func(metadata.MD) (repositories.Conversant, time.Time, error)
+
+// metadataNeverExpires adapts auth to an ExpiringMetadataAuth with credentials that never expire
+func metadataNeverExpires(auth MetadataAuth) ExpiringMetadataAuth {
+	return func(md metadata.MD) (repositories.Conversant, time.Time, error) {
+		conversant, err := auth(md)
+		return conversant, time.Time{}, err
+	}
+}
+
+// GRPCServer is a ChattyServer that hands each new stream to join as a GRPCConn,
+// and holds the stream open until the connection is finished
+type GRPCServer struct {
+	join func(connection.Conn)
+	auth ExpiringMetadataAuth
+}
+
+// NewGRPCServer is a factory for a GRPCServer. join will usually be ConnectionManager.Join
+func NewGRPCServer(join func(connection.Conn), auth MetadataAuth) *GRPCServer {
+	return NewExpiringGRPCServer(join, metadataNeverExpires(auth))
+}
+
+// NewExpiringGRPCServer is a GRPCServer for credentials that expire. Clients have to send
+// a reauthenticate request with fresh credentials before theirs do
+func NewExpiringGRPCServer(join func(connection.Conn), auth ExpiringMetadataAuth) *GRPCServer {
+	return &GRPCServer{
+		join: join,
+		auth: auth,
+	}
+}
+
+// Chat satisfies the ChattyServer interface
+func (server *GRPCServer) Chat(stream ChatStream) error {
+	conn := NewExpiringGRPCConn(stream, server.auth)
+	server.join(conn)
+
+	select {
+	case <-conn.done:
+	case <-stream.Context().Done():
+	}
+
+	select {
+	case <-conn.authorized:
+		return nil
+	default:
+		return status.Error(codes.Unauthenticated, "not authorized")
+	}
+}
+
+// GRPCConn is a gRPC bidirectional stream implementation of the Conn interface
+type GRPCConn struct {
+	stream     ChatStream
+	conversant repositories.Conversant
+	authorized chan struct{}
+	leave      chan struct{}
+	closing    chan struct{}
+	done       chan struct{}
+	closeOnce  *sync.Once
+	requests   chan connection.Request
+	responses  chan connection.Response
+	auth       ExpiringMetadataAuth
+	expiry
+}
+
+// NewGRPCConn is a factory for a gRPC connection
+func NewGRPCConn(stream ChatStream, auth MetadataAuth) *GRPCConn {
+	return NewExpiringGRPCConn(stream, metadataNeverExpires(auth))
+}
+
+// NewExpiringGRPCConn is a gRPC connection whose credentials expire
+func NewExpiringGRPCConn(stream ChatStream, auth ExpiringMetadataAuth) *GRPCConn {
+	return &GRPCConn{
+		stream:     stream,
+		authorized: make(chan struct{}),
+		leave:      make(chan struct{}, 1),
+		closing:    make(chan struct{}, 1),
+		done:       make(chan struct{}),
+		closeOnce:  &sync.Once{},
+		requests:   make(chan connection.Request),
+		responses:  make(chan connection.Response),
+		auth:       auth,
+		expiry:     newExpiry(),
+	}
+}
+
+// close stops both pumps and tells the manager that the stream is gone
+func (conn *GRPCConn) close() {
+	conn.closeOnce.Do(func() {
+		close(conn.done)
+		select {
+		case conn.leave <- struct{}{}:
+		default:
+		}
+		go discardResponses(conn.responses)
+	})
+}
+
+func (conn *GRPCConn) pumpIn() {
+	for {
+		frame, err := conn.stream.Recv()
+		if err != nil {
+			conn.close()
+			return
+		}
+
+		select {
+		case conn.requests <- frame.request():
+		case <-conn.done:
+			return
+		}
+	}
+}
+
+func (conn *GRPCConn) pumpOut() {
+	for {
+		select {
+		case <-conn.done:
+			return
+		case <-conn.stream.Context().Done():
+			conn.close()
+			return
+		case <-conn.closing:
+			conn.close()
+			return
+		case response := <-conn.responses:
+			conn.send(response)
+		}
+	}
+}
+
+func (conn *GRPCConn) send(response connection.Response) {
+	frame, err := newFrame(response)
+	if err != nil {
+		return
+	}
+
+	err = conn.stream.Send(frame)
+	if err != nil {
+		conn.close()
+	}
+}
+
+// Authorize satisfies the Conn interface
+func (conn *GRPCConn) Authorize() error {
+	md, ok := metadata.FromIncomingContext(conn.stream.Context())
+	if !ok {
+		md = metadata.MD{}
+	}
+
+	conversant, expiresAt, err := conn.auth(md)
+	if err != nil {
+		conn.close()
+		return errors.New("not authorized")
+	}
+
+	// closing authorized tells Chat, which may not be on the goroutine join ran on
+	conn.conversant = conversant
+	conn.setExpiry(expiresAt)
+	close(conn.authorized)
+
+	go conn.pumpIn()
+	go conn.pumpOut()
+	return nil
+}
+
+// Reauthenticate satisfies the connection.Expiring interface. The credentials are
+// read as call metadata, so fresh tokens are sent as {"authorization": "Bearer ..."},
+// and have to be for the conversant the connection was authorized as
+func (conn *GRPCConn) Reauthenticate(creds map[string]string) error {
+	conversant, expiresAt, err := conn.auth(metadata.New(creds))
+	if err != nil {
+		return err
+	}
+
+	if conversant.ID != conn.conversant.ID {
+		return errors.New("credentials are for a different conversant")
+	}
+
+	conn.setExpiry(expiresAt)
+	return nil
+}
+
+// GetConversant satisfies the Conn interface
+func (conn *GRPCConn) GetConversant() repositories.Conversant {
+	return conn.conversant
+}
+
+// Requests satisfies the Conn interface
+func (conn *GRPCConn) Requests() chan connection.Request {
+	return conn.requests
+}
+
+// Response satisfies the Conn interface
+func (conn *GRPCConn) Response() chan connection.Response {
+	return conn.responses
+}
+
+// Leave satisfies the Conn interface
+func (conn *GRPCConn) Leave() chan struct{} {
+	return conn.leave
+}
+
+// Close satisfies the Conn interface. Chat returns once the connection is closed, ending the stream
+func (conn *GRPCConn) Close() {
+	select {
+	case conn.closing <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,255 @@
+package implementations
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/metadata"
+
+	"github.com/ryan-berger/chatty/connection"
+	"github.com/ryan-berger/chatty/repositories"
+)
+
+type testStream struct {
+	ctx      context.Context
+	recvChan chan *Frame
+	sendChan chan *Frame
+	sendErr  func() error
+}
+
+func (stream *testStream) Send(frame *Frame) error {
+	if stream.sendErr != nil && stream.sendErr() != nil {
+		return stream.sendErr()
+	}
+	stream.sendChan <- frame
+	return nil
+}
+
+func (stream *testStream) Recv() (*Frame, error) {
+	frame, ok := <-stream.recvChan
+	if !ok {
+		return nil, io.EOF
+	}
+	return frame, nil
+}
+
+func (stream *testStream) Context() context.Context {
+	return stream.ctx
+}
+
+func newTestStream(md metadata.MD) *testStream {
+	return &testStream{
+		ctx:      metadata.NewIncomingContext(context.Background(), md),
+		recvChan: make(chan *Frame),
+		sendChan: make(chan *Frame),
+	}
+}
+
+func testMetadataAuth(md metadata.MD) (repositories.Conversant, error) {
+	if ids := md.Get("id"); len(ids) > 0 {
+		return repositories.Conversant{ID: ids[0]}, nil
+	}
+	return repositories.Conversant{}, errors.New("test")
+}
+
+func TestGRPCConn_Authorize(t *testing.T) {
+	conn := NewGRPCConn(newTestStream(metadata.Pairs("id", "testID")), testMetadataAuth)
+
+	if err := conn.Authorize(); err != nil {
+		t.Fatalf("authorize shouldn't have failed: %s", err)
+	}
+
+	if conn.GetConversant().ID != "testID" {
+		t.Fatalf("expected that %s would be testID", conn.GetConversant().ID)
+	}
+
+	conn = NewGRPCConn(newTestStream(metadata.MD{}), testMetadataAuth)
+
+	if err := conn.Authorize(); err == nil {
+		t.Fatalf("authorize should have failed")
+	}
+
+	select {
+	case <-conn.done:
+	default:
+		t.Fatalf("connection should have closed")
+	}
+}
+
+func TestGRPCConn_Requests(t *testing.T) {
+	stream := newTestStream(metadata.Pairs("id", "testID"))
+	conn := NewGRPCConn(stream, testMetadataAuth)
+	conn.Authorize()
+
+	for _, request := range requests {
+		var wire wsRequest
+		if err := json.Unmarshal(request.req, &wire); err != nil {
+			t.Fatal(err)
+		}
+
+		stream.recvChan <- &Frame{Type: string(wire.RequestType), Data: wire.Data}
+		req := <-conn.Requests()
+
+		if req.Type != request.reqType {
+			t.Fatalf("expected %d, type was actually: %d", request.reqType, req.Type)
+		}
+	}
+
+	close(stream.recvChan)
+
+	select {
+	case <-conn.Leave():
+	case <-time.After(10 * time.Millisecond):
+		t.Fatalf("didn't leave")
+	}
+}
+
+func TestGRPCConn_Responses(t *testing.T) {
+	stream := newTestStream(metadata.Pairs("id", "testID"))
+	conn := NewGRPCConn(stream, testMetadataAuth)
+	conn.Authorize()
+
+	for _, response := range responses {
+		conn.Response() <- connection.Response{Type: response.respType}
+
+		frame := <-stream.sendChan
+		res := `{"type":"` + frame.Type + `","data":` + string(frame.Data) + `}`
+
+		if res != string(response.resp) {
+			t.Fatalf("expected %s, received %s", string(response.resp), res)
+		}
+	}
+}
+
+func TestGRPCConn_LeaveSendErr(t *testing.T) {
+	stream := newTestStream(metadata.Pairs("id", "testID"))
+	stream.sendErr = func() error {
+		return errors.New("test err")
+	}
+
+	conn := NewGRPCConn(stream, testMetadataAuth)
+	conn.Authorize()
+
+	conn.Response() <- connection.Response{Type: connection.NewConversation}
+
+	select {
+	case <-conn.Leave():
+	case <-time.After(10 * time.Millisecond):
+		t.Fatalf("didn't leave")
+	}
+
+	// the manager can still be sending to the connection until it has removed it
+	select {
+	case conn.Response() <- connection.Response{Type: connection.NewMessage}:
+	case <-time.After(time.Second):
+		t.Fatal("sending to a closed connection blocked")
+	}
+}
+
+func TestGRPCServer_Chat(t *testing.T) {
+	joined := make(chan connection.Conn, 1)
+	server := NewGRPCServer(func(conn connection.Conn) {
+		conn.Authorize()
+		joined <- conn
+	}, testMetadataAuth)
+
+	stream := newTestStream(metadata.Pairs("id", "testID"))
+	result := make(chan error, 1)
+	go func() {
+		result <- server.Chat(stream)
+	}()
+
+	<-joined
+	close(stream.recvChan)
+
+	select {
+	case err := <-result:
+		if err != nil {
+			t.Fatalf("chat shouldn't have failed: %s", err)
+		}
+	case <-time.After(10 * time.Millisecond):
+		t.Fatalf("chat didn't return")
+	}
+
+	stream = newTestStream(metadata.MD{})
+	if err := server.Chat(stream); err == nil {
+		t.Fatalf("unauthorized chat should have failed")
+	}
+}
+
+func TestGRPCServer_JoinErr(t *testing.T) {
+	// join can fail after authorizing, like when the conversant can't be stored
+	server := NewGRPCServer(func(conn connection.Conn) {
+		conn.Authorize()
+		conn.Close()
+	}, testMetadataAuth)
+
+	stream := newTestStream(metadata.Pairs("id", "testID"))
+	defer close(stream.recvChan)
+
+	result := make(chan error, 1)
+	go func() {
+		result <- server.Chat(stream)
+	}()
+
+	select {
+	case <-result:
+	case <-time.After(time.Second):
+		t.Fatalf("chat didn't return")
+	}
+}
+
+func TestGRPCConn_Reauthenticate(t *testing.T) {
+	expiry := time.Now().Add(time.Minute)
+	auth := func(md metadata.MD) (repositories.Conversant, time.Time, error) {
+		conversant, err := testMetadataAuth(md)
+		return conversant, expiry, err
+	}
+
+	stream := newTestStream(metadata.Pairs("id", "testID"))
+	conn := NewExpiringGRPCConn(stream, auth)
+	if err := conn.Authorize(); err != nil {
+		t.Fatal(err)
+	}
+	defer close(stream.recvChan)
+
+	testReauthenticate(t, conn, &expiry)
+}
+
+func TestGRPCServer_Close(t *testing.T) {
+	joined := make(chan connection.Conn, 1)
+	server := NewGRPCServer(func(conn connection.Conn) {
+		conn.Authorize()
+		joined <- conn
+	}, testMetadataAuth)
+
+	stream := newTestStream(metadata.Pairs("id", "testID"))
+	defer close(stream.recvChan)
+
+	result := make(chan error, 1)
+	go func() {
+		result <- server.Chat(stream)
+	}()
+
+	// the response sent before closing is sent before the stream ends
+	conn := <-joined
+	conn.Response() <- connection.NewAuthExpiredError()
+	conn.Close()
+
+	if frame := <-stream.sendChan; frame.Type != string(responseError) {
+		t.Fatalf("expected an error frame, received %s", frame.Type)
+	}
+
+	select {
+	case err := <-result:
+		if err != nil {
+			t.Fatalf("chat shouldn't have failed: %s", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("chat didn't return")
+	}
+}
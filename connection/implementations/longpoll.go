@@ -0,0 +1,378 @@
+package implementations
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pborman/uuid"
+
+	"github.com/ryan-berger/chatty/connection"
+	"github.com/ryan-berger/chatty/repositories"
+)
+
+const maxPollWait = 25 * time.Second
+
+// maxPollBuffer is how many responses a session holds waiting to be polled. Sessions
+// that fall further behind are closed, and have to open a new one and resume
+const maxPollBuffer = 1000
+
+// longPollEvent is a buffered response with the id that clients
+// pass back as after to acknowledge everything up to and including it
+type longPollEvent struct {
+	ID uint64 `json:"id"`
+	wsResponse
+}
+
+// LongPollHandler serves chat sessions over HTTP long polling. A GET without a
+// session authorizes using the query parameters and returns a new session ID.
+// GETs with the session query parameter wait for buffered responses, and POSTs
+// with it carry requests. Sessions that are not polled within the idle timeout
+// are closed, and until then a client can resume by polling with the same session
+type LongPollHandler struct {
+	join        func(connection.Conn)
+	auth        ExpiringAuth
+	idleTimeout time.Duration
+	sessionsMu  *sync.RWMutex
+	sessions    map[string]*LongPollConn
+}
+
+// NewLongPollHandler is a factory for a LongPollHandler. join will usually be ConnectionManager.Join
+func NewLongPollHandler(join func(connection.Conn), auth Auth, idleTimeout time.Duration) *LongPollHandler {
+	return NewExpiringLongPollHandler(join, neverExpires(auth), idleTimeout)
+}
+
+// NewExpiringLongPollHandler is a LongPollHandler for credentials that expire. Clients have
+// to POST a reauthenticate request with fresh credentials before theirs do
+func NewExpiringLongPollHandler(join func(connection.Conn), auth ExpiringAuth, idleTimeout time.Duration) *LongPollHandler {
+	return &LongPollHandler{
+		join:        join,
+		auth:        auth,
+		idleTimeout: idleTimeout,
+		sessionsMu:  &sync.RWMutex{},
+		sessions:    make(map[string]*LongPollConn),
+	}
+}
+
+// ServeHTTP satisfies http.Handler
+func (handler *LongPollHandler) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	sessionID := request.URL.Query().Get("session")
+
+	switch {
+	case request.Method == http.MethodGet && sessionID == "":
+		handler.open(writer, request)
+	case request.Method == http.MethodGet:
+		handler.poll(writer, request, sessionID)
+	case request.Method == http.MethodPost:
+		handler.receive(writer, request, sessionID)
+	default:
+		http.Error(writer, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (handler *LongPollHandler) session(sessionID string) (*LongPollConn, bool) {
+	handler.sessionsMu.RLock()
+	defer handler.sessionsMu.RUnlock()
+	conn, ok := handler.sessions[sessionID]
+	return conn, ok
+}
+
+func (handler *LongPollHandler) removeSession(sessionID string) {
+	handler.sessionsMu.Lock()
+	delete(handler.sessions, sessionID)
+	handler.sessionsMu.Unlock()
+}
+
+func (handler *LongPollHandler) open(writer http.ResponseWriter, request *http.Request) {
+	creds := make(map[string]string)
+	for k, v := range request.URL.Query() {
+		creds[k] = v[0]
+	}
+
+	conn := newLongPollConn(uuid.New(), creds, handler.auth, handler.idleTimeout)
+	handler.join(conn)
+
+	if !conn.authorized {
+		http.Error(writer, "not authorized", http.StatusUnauthorized)
+		return
+	}
+
+	handler.sessionsMu.Lock()
+	handler.sessions[conn.sessionID] = conn
+	handler.sessionsMu.Unlock()
+
+	go func() {
+		<-conn.done
+		handler.removeSession(conn.sessionID)
+	}()
+
+	writeJSON(writer, http.StatusOK, sseSession{SessionID: conn.sessionID})
+}
+
+func (handler *LongPollHandler) poll(writer http.ResponseWriter, request *http.Request, sessionID string) {
+	conn, ok := handler.session(sessionID)
+	if !ok {
+		http.Error(writer, "unknown session", http.StatusNotFound)
+		return
+	}
+
+	after, _ := strconv.ParseUint(request.URL.Query().Get("after"), 10, 64)
+
+	wait := maxPollWait
+	if handler.idleTimeout/2 < wait {
+		wait = handler.idleTimeout / 2
+	}
+
+	events, err := conn.poll(after, wait, request.Context().Done())
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusGone)
+		return
+	}
+
+	writeJSON(writer, http.StatusOK, events)
+}
+
+func (handler *LongPollHandler) receive(writer http.ResponseWriter, request *http.Request, sessionID string) {
+	conn, ok := handler.session(sessionID)
+	if !ok {
+		http.Error(writer, "unknown session", http.StatusNotFound)
+		return
+	}
+
+	body, err := ioutil.ReadAll(request.Body)
+	if err != nil {
+		http.Error(writer, "unable to read body", http.StatusBadRequest)
+		return
+	}
+
+	conn.touch()
+
+	select {
+	case conn.requests <- wsRequestData(body):
+		writer.WriteHeader(http.StatusAccepted)
+	case <-conn.done:
+		http.Error(writer, "session closed", http.StatusGone)
+	case <-request.Context().Done():
+	}
+}
+
+func writeJSON(writer http.ResponseWriter, status int, data interface{}) {
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(status)
+	json.NewEncoder(writer).Encode(data)
+}
+
+// LongPollConn is an HTTP long polling implementation of the Conn interface
+type LongPollConn struct {
+	sessionID   string
+	creds       map[string]string
+	conversant  repositories.Conversant
+	authorized  bool
+	bufferMu    *sync.Mutex
+	buffer      []longPollEvent
+	lastID      uint64
+	hangingUp   bool
+	ready       chan struct{}
+	idleTimeout time.Duration
+	idle        *time.Timer
+	leave       chan struct{}
+	closing     chan struct{}
+	done        chan struct{}
+	closeOnce   *sync.Once
+	requests    chan connection.Request
+	responses   chan connection.Response
+	auth        ExpiringAuth
+	expiry
+}
+
+func newLongPollConn(sessionID string, creds map[string]string, auth ExpiringAuth, idleTimeout time.Duration) *LongPollConn {
+	conn := &LongPollConn{
+		sessionID:   sessionID,
+		creds:       creds,
+		bufferMu:    &sync.Mutex{},
+		ready:       make(chan struct{}, 1),
+		idleTimeout: idleTimeout,
+		leave:       make(chan struct{}, 1),
+		closing:     make(chan struct{}, 1),
+		done:        make(chan struct{}),
+		closeOnce:   &sync.Once{},
+		requests:    make(chan connection.Request),
+		responses:   make(chan connection.Response),
+		auth:        auth,
+		expiry:      newExpiry(),
+	}
+	conn.idle = time.AfterFunc(idleTimeout, conn.close)
+	conn.idle.Stop()
+	return conn
+}
+
+// touch pushes back the idle timeout
+func (conn *LongPollConn) touch() {
+	conn.idle.Reset(conn.idleTimeout)
+}
+
+// close ends the session and tells the manager that the client is gone
+func (conn *LongPollConn) close() {
+	conn.closeOnce.Do(func() {
+		conn.idle.Stop()
+		close(conn.done)
+		select {
+		case conn.leave <- struct{}{}:
+		default:
+		}
+		go discardResponses(conn.responses)
+	})
+}
+
+// pumpOut moves responses from the manager into the buffer until they are polled,
+// closing the session if the buffer fills up. Once the connection is told to close,
+// the session ends straight away if nothing is waiting to be polled, or else after
+// the next poll hands over what is
+func (conn *LongPollConn) pumpOut() {
+	for {
+		select {
+		case <-conn.done:
+			return
+		case <-conn.closing:
+			conn.bufferMu.Lock()
+			conn.hangingUp = true
+			empty := len(conn.buffer) == 0
+			conn.bufferMu.Unlock()
+
+			if empty {
+				conn.close()
+				return
+			}
+		case response := <-conn.responses:
+			conn.bufferMu.Lock()
+			full := len(conn.buffer) >= maxPollBuffer
+			if !full {
+				conn.lastID++
+				conn.buffer = append(conn.buffer, longPollEvent{
+					ID:         conn.lastID,
+					wsResponse: newWsResponse(response),
+				})
+			}
+			conn.bufferMu.Unlock()
+
+			if full {
+				conn.close()
+				return
+			}
+
+			select {
+			case conn.ready <- struct{}{}:
+			default:
+			}
+		}
+	}
+}
+
+// take drops every event the client has acknowledged, and returns the rest along
+// with whether the connection is hanging up, see pumpOut
+func (conn *LongPollConn) take(after uint64) ([]longPollEvent, bool) {
+	conn.bufferMu.Lock()
+	defer conn.bufferMu.Unlock()
+
+	i := 0
+	for i < len(conn.buffer) && conn.buffer[i].ID <= after {
+		i++
+	}
+	conn.buffer = conn.buffer[i:]
+
+	events := make([]longPollEvent, len(conn.buffer))
+	copy(events, conn.buffer)
+	return events, conn.hangingUp
+}
+
+// poll waits up to wait for events after the given id
+func (conn *LongPollConn) poll(after uint64, wait time.Duration, hangup <-chan struct{}) ([]longPollEvent, error) {
+	conn.touch()
+	defer conn.touch()
+
+	timeout := time.NewTimer(wait)
+	defer timeout.Stop()
+
+	for {
+		if events, hangingUp := conn.take(after); len(events) > 0 {
+			if hangingUp {
+				conn.close()
+			}
+			return events, nil
+		}
+
+		select {
+		case <-conn.ready:
+		case <-timeout.C:
+			return []longPollEvent{}, nil
+		case <-hangup:
+			return []longPollEvent{}, nil
+		case <-conn.done:
+			return nil, errors.New("session closed")
+		}
+	}
+}
+
+// Authorize satisfies the Conn interface
+func (conn *LongPollConn) Authorize() error {
+	conversant, expiresAt, err := conn.auth(conn.creds)
+
+	if err != nil {
+		conn.closeOnce.Do(func() {
+			close(conn.done)
+		})
+		return errors.New("not authorized")
+	}
+
+	conn.conversant = conversant
+	conn.authorized = true
+	conn.setExpiry(expiresAt)
+	conn.touch()
+
+	go conn.pumpOut()
+	return nil
+}
+
+// Reauthenticate satisfies the connection.Expiring interface. The credentials
+// have to be for the conversant the connection was authorized as
+func (conn *LongPollConn) Reauthenticate(creds map[string]string) error {
+	expiresAt, err := checkReauthentication(conn.auth, conn.conversant, creds)
+	if err != nil {
+		return err
+	}
+
+	conn.setExpiry(expiresAt)
+	return nil
+}
+
+// GetConversant satisfies the Conn interface
+func (conn *LongPollConn) GetConversant() repositories.Conversant {
+	return conn.conversant
+}
+
+// Requests satisfies the Conn interface
+func (conn *LongPollConn) Requests() chan connection.Request {
+	return conn.requests
+}
+
+// Response satisfies the Conn interface
+func (conn *LongPollConn) Response() chan connection.Response {
+	return conn.responses
+}
+
+// Leave satisfies the Conn interface
+func (conn *LongPollConn) Leave() chan struct{} {
+	return conn.leave
+}
+
+// Close satisfies the Conn interface. Polls for the session fail once it is closed
+func (conn *LongPollConn) Close() {
+	select {
+	case conn.closing <- struct{}{}:
+	default:
+	}
+}
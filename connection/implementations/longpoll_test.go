@@ -0,0 +1,231 @@
+package implementations
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ryan-berger/chatty/connection"
+)
+
+func openLongPoll(t *testing.T, url string) string {
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected %d, received %d", http.StatusOK, resp.StatusCode)
+	}
+
+	var session sseSession
+	if err := json.NewDecoder(resp.Body).Decode(&session); err != nil {
+		t.Fatal(err)
+	}
+
+	return session.SessionID
+}
+
+func pollEvents(t *testing.T, url string) []json.RawMessage {
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	var events []json.RawMessage
+	if err := json.NewDecoder(resp.Body).Decode(&events); err != nil {
+		t.Fatal(err)
+	}
+
+	return events
+}
+
+func TestLongPollHandler_Unauthorized(t *testing.T) {
+	handler := NewLongPollHandler(func(conn connection.Conn) {
+		conn.Authorize()
+	}, testAuth, time.Second)
+
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expected %d, received %d", http.StatusUnauthorized, resp.StatusCode)
+	}
+}
+
+func TestLongPollHandler_Poll(t *testing.T) {
+	joined := make(chan connection.Conn, 1)
+	handler := NewLongPollHandler(func(conn connection.Conn) {
+		conn.Authorize()
+		joined <- conn
+	}, testAuth, time.Second)
+
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	sessionID := openLongPoll(t, server.URL+"?id=testID")
+	conn := <-joined
+
+	for _, response := range responses {
+		conn.Response() <- connection.Response{Type: response.respType}
+	}
+
+	events := pollEvents(t, server.URL+"?session="+sessionID)
+	if len(events) != len(responses) {
+		t.Fatalf("expected %d events, received %d", len(responses), len(events))
+	}
+
+	for i, response := range responses {
+		expected := `{"id":` + strconv.Itoa(i+1) + `,` + strings.TrimPrefix(string(response.resp), "{")
+		if string(events[i]) != expected {
+			t.Fatalf("expected %s, received %s", expected, string(events[i]))
+		}
+	}
+
+	// polling without acknowledging resumes with the same events
+	events = pollEvents(t, server.URL+"?session="+sessionID+"&after=2")
+	if len(events) != len(responses)-2 {
+		t.Fatalf("expected %d events, received %d", len(responses)-2, len(events))
+	}
+
+	for _, request := range requests {
+		go func(body string) {
+			resp, err := http.Post(server.URL+"?session="+sessionID, "application/json", strings.NewReader(body))
+			if err == nil {
+				resp.Body.Close()
+			}
+		}(string(request.req))
+
+		req := <-conn.Requests()
+		if req.Type != request.reqType {
+			t.Fatalf("expected %d, type was actually: %d", request.reqType, req.Type)
+		}
+	}
+}
+
+func TestLongPollHandler_IdleTimeout(t *testing.T) {
+	joined := make(chan connection.Conn, 1)
+	handler := NewLongPollHandler(func(conn connection.Conn) {
+		conn.Authorize()
+		joined <- conn
+	}, testAuth, 10*time.Millisecond)
+
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	sessionID := openLongPoll(t, server.URL+"?id=testID")
+	conn := <-joined
+
+	select {
+	case <-conn.Leave():
+	case <-time.After(time.Second):
+		t.Fatalf("didn't leave")
+	}
+
+	time.Sleep(10 * time.Millisecond)
+
+	resp, err := http.Get(server.URL + "?session=" + sessionID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	// the session is gone, or is closed if it hasn't been removed yet
+	if resp.StatusCode != http.StatusNotFound && resp.StatusCode != http.StatusGone {
+		t.Fatalf("expected the session to be closed, received %d", resp.StatusCode)
+	}
+}
+
+func TestLongPollHandler_BufferFull(t *testing.T) {
+	joined := make(chan connection.Conn, 1)
+	handler := NewLongPollHandler(func(conn connection.Conn) {
+		conn.Authorize()
+		joined <- conn
+	}, testAuth, time.Minute)
+
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	openLongPoll(t, server.URL+"?id=testID")
+	conn := <-joined
+
+	// a session that is never polled is closed once its buffer fills, and the
+	// responses sent after that are dropped rather than blocking the sender
+	for i := 0; i <= maxPollBuffer+10; i++ {
+		select {
+		case conn.Response() <- connection.Response{Type: connection.NewMessage}:
+		case <-time.After(time.Second):
+			t.Fatalf("sending response %d blocked", i)
+		}
+	}
+
+	select {
+	case <-conn.Leave():
+	case <-time.After(time.Second):
+		t.Fatalf("didn't leave")
+	}
+}
+
+func TestLongPollConn_Reauthenticate(t *testing.T) {
+	expiry := time.Now().Add(time.Minute)
+
+	conn := newLongPollConn("session", map[string]string{"id": "testID"}, expiringTestAuth(&expiry), time.Minute)
+	if err := conn.Authorize(); err != nil {
+		t.Fatal(err)
+	}
+	defer conn.close()
+
+	testReauthenticate(t, conn, &expiry)
+}
+
+func TestLongPollConn_Close(t *testing.T) {
+	joined := make(chan connection.Conn, 1)
+	handler := NewLongPollHandler(func(conn connection.Conn) {
+		conn.Authorize()
+		joined <- conn
+	}, testAuth, time.Minute)
+
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	sessionID := openLongPoll(t, server.URL+"?id=testID")
+	conn := <-joined
+
+	// the response sent before closing is polled before the session ends
+	conn.Response() <- connection.NewAuthExpiredError()
+	conn.Close()
+
+	events := pollEvents(t, server.URL+"?session="+sessionID)
+	if len(events) != 1 || !strings.Contains(string(events[0]), `"type":"error"`) {
+		t.Fatalf("expected an error response, received %s", events)
+	}
+
+	select {
+	case <-conn.Leave():
+	case <-time.After(time.Second):
+		t.Fatal("didn't leave")
+	}
+
+	resp, err := http.Get(server.URL + "?session=" + sessionID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	// the session is gone, or is closed if it hasn't been removed yet
+	if resp.StatusCode != http.StatusNotFound && resp.StatusCode != http.StatusGone {
+		t.Fatalf("expected the session to be closed, received %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,468 @@
+package implementations
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"github.com/gorilla/websocket"
+
+	"github.com/ryan-berger/chatty/connection"
+	"github.com/ryan-berger/chatty/repositories"
+)
+
+// protobufCodec sends a Frame per request or response, like the gRPC Conn, except
+// that data holds the body as the protobuf message for its type. See chatty.proto
+type protobufCodec struct{}
+
+func (protobufCodec) Subprotocol() string {
+	return ProtobufSubprotocol
+}
+
+func (protobufCodec) MessageType() int {
+	return websocket.BinaryMessage
+}
+
+func (protobufCodec) DecodeCredentials(data []byte) map[string]string {
+	var creds pbCredentials
+	proto.Unmarshal(data, &creds)
+	return creds.Values
+}
+
+func (protobufCodec) DecodeRequest(data []byte) connection.Request {
+	var frame Frame
+	proto.Unmarshal(data, &frame)
+
+	req := connection.Request{Type: wsRequestType(requestType(frame.Type)), RequestID: frame.RequestId}
+	switch req.Type {
+	case connection.SendMessage:
+		var body pbSendMessageRequest
+		proto.Unmarshal(frame.Data, &body)
+		req.Data = connection.SendMessageRequest{
+			Message:        body.Message,
+			ConversationID: body.ConversationId,
+			IdempotencyKey: body.IdempotencyKey,
+		}
+	case connection.CreateConversation:
+		var body pbCreateConversationRequest
+		proto.Unmarshal(frame.Data, &body)
+		req.Data = connection.CreateConversationRequest{Name: body.Name, Conversants: body.Conversants}
+	case connection.RetrieveConversation:
+		var body pbRetrieveConversationRequest
+		proto.Unmarshal(frame.Data, &body)
+		req.Data = connection.RetrieveConversationRequest{
+			ConversationID: body.ConversationId,
+			Limit:          int(body.Limit),
+			Offset:         int(body.Offset),
+			Before:         body.Before,
+			After:          body.After,
+		}
+	case connection.Resume:
+		var body pbResumeRequest
+		proto.Unmarshal(frame.Data, &body)
+		req.Data = connection.ResumeRequest{Cursors: body.Cursors}
+	case connection.ListConversations:
+		var body pbListConversationsRequest
+		proto.Unmarshal(frame.Data, &body)
+		req.Data = connection.ListConversationsRequest{Limit: int(body.Limit), Offset: int(body.Offset)}
+	case connection.AddConversants:
+		var body pbConversantsRequest
+		proto.Unmarshal(frame.Data, &body)
+		req.Data = connection.AddConversantsRequest{ConversationID: body.ConversationId, Conversants: body.Conversants}
+	case connection.RemoveConversants:
+		var body pbConversantsRequest
+		proto.Unmarshal(frame.Data, &body)
+		req.Data = connection.RemoveConversantsRequest{ConversationID: body.ConversationId, Conversants: body.Conversants}
+	case connection.LeaveConversation:
+		var body pbConversationRequest
+		proto.Unmarshal(frame.Data, &body)
+		req.Data = connection.LeaveConversationRequest{ConversationID: body.ConversationId}
+	case connection.Reauthenticate:
+		var body pbCredentials
+		proto.Unmarshal(frame.Data, &body)
+		req.Data = connection.ReauthenticateRequest{Credentials: body.Values}
+	case connection.SetRole:
+		var body pbSetRoleRequest
+		proto.Unmarshal(frame.Data, &body)
+		req.Data = connection.SetRoleRequest{
+			ConversationID: body.ConversationId,
+			ConversantID:   body.ConversantId,
+			Role:           repositories.Role(body.Role),
+		}
+	case connection.RenameConversation:
+		var body pbRenameConversationRequest
+		proto.Unmarshal(frame.Data, &body)
+		req.Data = connection.RenameConversationRequest{ConversationID: body.ConversationId, Name: body.Name}
+	case connection.DeleteConversation:
+		var body pbConversationRequest
+		proto.Unmarshal(frame.Data, &body)
+		req.Data = connection.DeleteConversationRequest{ConversationID: body.ConversationId}
+	case connection.Block:
+		var body pbBlockRequest
+		proto.Unmarshal(frame.Data, &body)
+		req.Data = connection.BlockRequest{ConversantID: body.ConversantId, Mute: body.Mute}
+	case connection.Unblock:
+		var body pbBlockRequest
+		proto.Unmarshal(frame.Data, &body)
+		req.Data = connection.UnblockRequest{ConversantID: body.ConversantId}
+	case connection.RequestError:
+		req.Data = nil
+	}
+
+	return req
+}
+
+func (protobufCodec) EncodeResponse(response connection.Response) ([]byte, error) {
+	frame := &Frame{Type: string(typeToString[response.Type]), RequestId: response.RequestID}
+
+	if response.Data != nil {
+		body, err := pbResponse(response.Data)
+		if err != nil {
+			return nil, err
+		}
+
+		frame.Data, err = proto.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return proto.Marshal(frame)
+}
+
+// pbResponse converts a response body to its protobuf message
+func pbResponse(data interface{}) (proto.Message, error) {
+	switch data := data.(type) {
+	case repositories.Message:
+		return pbNewMessage(data), nil
+	case repositories.Conversation:
+		return pbNewConversation(data, 0, 0), nil
+	case connection.ReturnConversationResponse:
+		return pbNewConversation(data.Conversation, data.PrevCursor, data.NextCursor), nil
+	case connection.MessageAcceptedResponse:
+		return &pbMessageAccepted{MessageId: data.MessageID, ConversationId: data.ConversationID}, nil
+	case connection.ResumedResponse:
+		return &pbResumed{Cursors: data.Cursors}, nil
+	case connection.ListConversationsResponse:
+		list := &pbConversationList{Conversations: make([]*pbConversationSummary, len(data.Conversations))}
+		for i, summary := range data.Conversations {
+			lastActivity, err := pbTimestamp(summary.LastActivity)
+			if err != nil {
+				return nil, err
+			}
+
+			list.Conversations[i] = &pbConversationSummary{
+				Id:           summary.ID,
+				Name:         summary.Name,
+				Direct:       summary.Direct,
+				UnreadCount:  summary.UnreadCount,
+				LastActivity: lastActivity,
+			}
+			if summary.LastMessage != nil {
+				list.Conversations[i].LastMessage = pbNewMessage(*summary.LastMessage)
+			}
+		}
+		return list, nil
+	case connection.ConversationUpdatedResponse:
+		return &pbConversationUpdated{
+			ConversationId: data.ConversationID,
+			Name:           data.Name,
+			Conversants:    pbConversants(data.Conversants),
+			Added:          data.Added,
+			Removed:        data.Removed,
+		}, nil
+	case connection.ConversationDeletedResponse:
+		return &pbConversationDeleted{ConversationId: data.ConversationID}, nil
+	case connection.BlockUpdatedResponse:
+		return &pbBlockUpdated{ConversantId: data.ConversantID, Blocked: data.Blocked, Mute: data.Mute}, nil
+	case connection.AuthExpiringResponse:
+		expiresAt, err := pbTimestamp(data.ExpiresAt)
+		return &pbExpiry{ExpiresAt: expiresAt}, err
+	case connection.ReauthenticatedResponse:
+		expiresAt, err := pbTimestamp(data.ExpiresAt)
+		return &pbExpiry{ExpiresAt: expiresAt}, err
+	case connection.ResponseError:
+		return &pbError{Error: data.Error, Code: data.Code}, nil
+	default:
+		return nil, fmt.Errorf("no protobuf message for %T", data)
+	}
+}
+
+func pbTimestamp(t time.Time) (*timestamp.Timestamp, error) {
+	if t.IsZero() {
+		return nil, nil
+	}
+	return ptypes.TimestampProto(t)
+}
+
+func pbNewMessage(message repositories.Message) *pbMessage {
+	return &pbMessage{
+		Id:             message.ID,
+		SenderId:       message.SenderID,
+		Message:        message.Message,
+		ConversationId: message.ConversationID,
+		IdempotencyKey: message.IdempotencyKey,
+		Sequence:       message.Sequence,
+		System:         message.System,
+	}
+}
+
+func pbConversants(conversants []repositories.Conversant) []*pbConversant {
+	converted := make([]*pbConversant, len(conversants))
+	for i, conversant := range conversants {
+		converted[i] = &pbConversant{Id: conversant.ID, Name: conversant.DisplayName, Role: string(conversant.Role)}
+	}
+	return converted
+}
+
+func pbNewConversation(conversation repositories.Conversation, prevCursor, nextCursor int64) *pbConversation {
+	messages := make([]*pbMessage, len(conversation.Messages))
+	for i, message := range conversation.Messages {
+		messages[i] = pbNewMessage(message)
+	}
+
+	return &pbConversation{
+		Id:          conversation.ID,
+		Name:        conversation.Name,
+		Conversants: pbConversants(conversation.Conversants),
+		Messages:    messages,
+		Direct:      conversation.Direct,
+		PrevCursor:  prevCursor,
+		NextCursor:  nextCursor,
+	}
+}
+
+// The messages below are the request and response bodies in chatty.proto, written by
+// hand in the same shape protoc-gen-go would give them
+
+type pbCredentials struct {
+	Values map[string]string `protobuf:"bytes,1,rep,name=values,proto3" protobuf_key:"bytes,1,opt,name=key,proto3" protobuf_val:"bytes,2,opt,name=value,proto3"`
+}
+
+func (m *pbCredentials) Reset()         { *m = pbCredentials{} }
+func (m *pbCredentials) String() string { return proto.CompactTextString(m) }
+func (*pbCredentials) ProtoMessage()    {}
+
+type pbSendMessageRequest struct {
+	Message        string `protobuf:"bytes,1,opt,name=message,proto3"`
+	ConversationId string `protobuf:"bytes,2,opt,name=conversation_id,json=conversationId,proto3"`
+	IdempotencyKey string `protobuf:"bytes,3,opt,name=idempotency_key,json=idempotencyKey,proto3"`
+}
+
+func (m *pbSendMessageRequest) Reset()         { *m = pbSendMessageRequest{} }
+func (m *pbSendMessageRequest) String() string { return proto.CompactTextString(m) }
+func (*pbSendMessageRequest) ProtoMessage()    {}
+
+type pbCreateConversationRequest struct {
+	Name        string   `protobuf:"bytes,1,opt,name=name,proto3"`
+	Conversants []string `protobuf:"bytes,2,rep,name=conversants,proto3"`
+}
+
+func (m *pbCreateConversationRequest) Reset()         { *m = pbCreateConversationRequest{} }
+func (m *pbCreateConversationRequest) String() string { return proto.CompactTextString(m) }
+func (*pbCreateConversationRequest) ProtoMessage()    {}
+
+type pbRetrieveConversationRequest struct {
+	ConversationId string `protobuf:"bytes,1,opt,name=conversation_id,json=conversationId,proto3"`
+	Limit          int64  `protobuf:"varint,2,opt,name=limit,proto3"`
+	Offset         int64  `protobuf:"varint,3,opt,name=offset,proto3"`
+	Before         int64  `protobuf:"varint,4,opt,name=before,proto3"`
+	After          int64  `protobuf:"varint,5,opt,name=after,proto3"`
+}
+
+func (m *pbRetrieveConversationRequest) Reset()         { *m = pbRetrieveConversationRequest{} }
+func (m *pbRetrieveConversationRequest) String() string { return proto.CompactTextString(m) }
+func (*pbRetrieveConversationRequest) ProtoMessage()    {}
+
+type pbResumeRequest struct {
+	Cursors map[string]int64 `protobuf:"bytes,1,rep,name=cursors,proto3" protobuf_key:"bytes,1,opt,name=key,proto3" protobuf_val:"varint,2,opt,name=value,proto3"`
+}
+
+func (m *pbResumeRequest) Reset()         { *m = pbResumeRequest{} }
+func (m *pbResumeRequest) String() string { return proto.CompactTextString(m) }
+func (*pbResumeRequest) ProtoMessage()    {}
+
+type pbListConversationsRequest struct {
+	Limit  int64 `protobuf:"varint,1,opt,name=limit,proto3"`
+	Offset int64 `protobuf:"varint,2,opt,name=offset,proto3"`
+}
+
+func (m *pbListConversationsRequest) Reset()         { *m = pbListConversationsRequest{} }
+func (m *pbListConversationsRequest) String() string { return proto.CompactTextString(m) }
+func (*pbListConversationsRequest) ProtoMessage()    {}
+
+// pbConversantsRequest is the body of both addConversants and removeConversants
+type pbConversantsRequest struct {
+	ConversationId string   `protobuf:"bytes,1,opt,name=conversation_id,json=conversationId,proto3"`
+	Conversants    []string `protobuf:"bytes,2,rep,name=conversants,proto3"`
+}
+
+func (m *pbConversantsRequest) Reset()         { *m = pbConversantsRequest{} }
+func (m *pbConversantsRequest) String() string { return proto.CompactTextString(m) }
+func (*pbConversantsRequest) ProtoMessage()    {}
+
+// pbConversationRequest is the body of both leaveConversation and deleteConversation
+type pbConversationRequest struct {
+	ConversationId string `protobuf:"bytes,1,opt,name=conversation_id,json=conversationId,proto3"`
+}
+
+func (m *pbConversationRequest) Reset()         { *m = pbConversationRequest{} }
+func (m *pbConversationRequest) String() string { return proto.CompactTextString(m) }
+func (*pbConversationRequest) ProtoMessage()    {}
+
+type pbSetRoleRequest struct {
+	ConversationId string `protobuf:"bytes,1,opt,name=conversation_id,json=conversationId,proto3"`
+	ConversantId   string `protobuf:"bytes,2,opt,name=conversant_id,json=conversantId,proto3"`
+	Role           string `protobuf:"bytes,3,opt,name=role,proto3"`
+}
+
+func (m *pbSetRoleRequest) Reset()         { *m = pbSetRoleRequest{} }
+func (m *pbSetRoleRequest) String() string { return proto.CompactTextString(m) }
+func (*pbSetRoleRequest) ProtoMessage()    {}
+
+type pbRenameConversationRequest struct {
+	ConversationId string `protobuf:"bytes,1,opt,name=conversation_id,json=conversationId,proto3"`
+	Name           string `protobuf:"bytes,2,opt,name=name,proto3"`
+}
+
+func (m *pbRenameConversationRequest) Reset()         { *m = pbRenameConversationRequest{} }
+func (m *pbRenameConversationRequest) String() string { return proto.CompactTextString(m) }
+func (*pbRenameConversationRequest) ProtoMessage()    {}
+
+// pbBlockRequest is the body of both block and unblock, which ignores mute
+type pbBlockRequest struct {
+	ConversantId string `protobuf:"bytes,1,opt,name=conversant_id,json=conversantId,proto3"`
+	Mute         bool   `protobuf:"varint,2,opt,name=mute,proto3"`
+}
+
+func (m *pbBlockRequest) Reset()         { *m = pbBlockRequest{} }
+func (m *pbBlockRequest) String() string { return proto.CompactTextString(m) }
+func (*pbBlockRequest) ProtoMessage()    {}
+
+type pbConversant struct {
+	Id   string `protobuf:"bytes,1,opt,name=id,proto3"`
+	Name string `protobuf:"bytes,2,opt,name=name,proto3"`
+	Role string `protobuf:"bytes,3,opt,name=role,proto3"`
+}
+
+func (m *pbConversant) Reset()         { *m = pbConversant{} }
+func (m *pbConversant) String() string { return proto.CompactTextString(m) }
+func (*pbConversant) ProtoMessage()    {}
+
+type pbMessage struct {
+	Id             string `protobuf:"bytes,1,opt,name=id,proto3"`
+	SenderId       string `protobuf:"bytes,2,opt,name=sender_id,json=senderId,proto3"`
+	Message        string `protobuf:"bytes,3,opt,name=message,proto3"`
+	ConversationId string `protobuf:"bytes,4,opt,name=conversation_id,json=conversationId,proto3"`
+	IdempotencyKey string `protobuf:"bytes,5,opt,name=idempotency_key,json=idempotencyKey,proto3"`
+	Sequence       int64  `protobuf:"varint,6,opt,name=sequence,proto3"`
+	System         bool   `protobuf:"varint,7,opt,name=system,proto3"`
+}
+
+func (m *pbMessage) Reset()         { *m = pbMessage{} }
+func (m *pbMessage) String() string { return proto.CompactTextString(m) }
+func (*pbMessage) ProtoMessage()    {}
+
+// pbConversation is the body of both newConversation and returnConversation,
+// which is the only one with cursors
+type pbConversation struct {
+	Id          string          `protobuf:"bytes,1,opt,name=id,proto3"`
+	Name        string          `protobuf:"bytes,2,opt,name=name,proto3"`
+	Conversants []*pbConversant `protobuf:"bytes,3,rep,name=conversants,proto3"`
+	Messages    []*pbMessage    `protobuf:"bytes,4,rep,name=messages,proto3"`
+	Direct      bool            `protobuf:"varint,5,opt,name=direct,proto3"`
+	PrevCursor  int64           `protobuf:"varint,6,opt,name=prev_cursor,json=prevCursor,proto3"`
+	NextCursor  int64           `protobuf:"varint,7,opt,name=next_cursor,json=nextCursor,proto3"`
+}
+
+func (m *pbConversation) Reset()         { *m = pbConversation{} }
+func (m *pbConversation) String() string { return proto.CompactTextString(m) }
+func (*pbConversation) ProtoMessage()    {}
+
+type pbMessageAccepted struct {
+	MessageId      string `protobuf:"bytes,1,opt,name=message_id,json=messageId,proto3"`
+	ConversationId string `protobuf:"bytes,2,opt,name=conversation_id,json=conversationId,proto3"`
+}
+
+func (m *pbMessageAccepted) Reset()         { *m = pbMessageAccepted{} }
+func (m *pbMessageAccepted) String() string { return proto.CompactTextString(m) }
+func (*pbMessageAccepted) ProtoMessage()    {}
+
+type pbResumed struct {
+	Cursors map[string]int64 `protobuf:"bytes,1,rep,name=cursors,proto3" protobuf_key:"bytes,1,opt,name=key,proto3" protobuf_val:"varint,2,opt,name=value,proto3"`
+}
+
+func (m *pbResumed) Reset()         { *m = pbResumed{} }
+func (m *pbResumed) String() string { return proto.CompactTextString(m) }
+func (*pbResumed) ProtoMessage()    {}
+
+type pbConversationSummary struct {
+	Id           string               `protobuf:"bytes,1,opt,name=id,proto3"`
+	Name         string               `protobuf:"bytes,2,opt,name=name,proto3"`
+	Direct       bool                 `protobuf:"varint,3,opt,name=direct,proto3"`
+	LastMessage  *pbMessage           `protobuf:"bytes,4,opt,name=last_message,json=lastMessage,proto3"`
+	UnreadCount  int64                `protobuf:"varint,5,opt,name=unread_count,json=unreadCount,proto3"`
+	LastActivity *timestamp.Timestamp `protobuf:"bytes,6,opt,name=last_activity,json=lastActivity,proto3"`
+}
+
+func (m *pbConversationSummary) Reset()         { *m = pbConversationSummary{} }
+func (m *pbConversationSummary) String() string { return proto.CompactTextString(m) }
+func (*pbConversationSummary) ProtoMessage()    {}
+
+type pbConversationList struct {
+	Conversations []*pbConversationSummary `protobuf:"bytes,1,rep,name=conversations,proto3"`
+}
+
+func (m *pbConversationList) Reset()         { *m = pbConversationList{} }
+func (m *pbConversationList) String() string { return proto.CompactTextString(m) }
+func (*pbConversationList) ProtoMessage()    {}
+
+type pbConversationUpdated struct {
+	ConversationId string          `protobuf:"bytes,1,opt,name=conversation_id,json=conversationId,proto3"`
+	Name           string          `protobuf:"bytes,2,opt,name=name,proto3"`
+	Conversants    []*pbConversant `protobuf:"bytes,3,rep,name=conversants,proto3"`
+	Added          []string        `protobuf:"bytes,4,rep,name=added,proto3"`
+	Removed        []string        `protobuf:"bytes,5,rep,name=removed,proto3"`
+}
+
+func (m *pbConversationUpdated) Reset()         { *m = pbConversationUpdated{} }
+func (m *pbConversationUpdated) String() string { return proto.CompactTextString(m) }
+func (*pbConversationUpdated) ProtoMessage()    {}
+
+type pbConversationDeleted struct {
+	ConversationId string `protobuf:"bytes,1,opt,name=conversation_id,json=conversationId,proto3"`
+}
+
+func (m *pbConversationDeleted) Reset()         { *m = pbConversationDeleted{} }
+func (m *pbConversationDeleted) String() string { return proto.CompactTextString(m) }
+func (*pbConversationDeleted) ProtoMessage()    {}
+
+type pbBlockUpdated struct {
+	ConversantId string `protobuf:"bytes,1,opt,name=conversant_id,json=conversantId,proto3"`
+	Blocked      bool   `protobuf:"varint,2,opt,name=blocked,proto3"`
+	Mute         bool   `protobuf:"varint,3,opt,name=mute,proto3"`
+}
+
+func (m *pbBlockUpdated) Reset()         { *m = pbBlockUpdated{} }
+func (m *pbBlockUpdated) String() string { return proto.CompactTextString(m) }
+func (*pbBlockUpdated) ProtoMessage()    {}
+
+// pbExpiry is the body of both authExpiring and reauthenticated
+type pbExpiry struct {
+	ExpiresAt *timestamp.Timestamp `protobuf:"bytes,1,opt,name=expires_at,json=expiresAt,proto3"`
+}
+
+func (m *pbExpiry) Reset()         { *m = pbExpiry{} }
+func (m *pbExpiry) String() string { return proto.CompactTextString(m) }
+func (*pbExpiry) ProtoMessage()    {}
+
+type pbError struct {
+	Error string `protobuf:"bytes,1,opt,name=error,proto3"`
+	Code  string `protobuf:"bytes,2,opt,name=code,proto3"`
+}
+
+func (m *pbError) Reset()         { *m = pbError{} }
+func (m *pbError) String() string { return proto.CompactTextString(m) }
+func (*pbError) ProtoMessage()    {}
@@ -0,0 +1,303 @@
+package implementations
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes/timestamp"
+
+	"github.com/ryan-berger/chatty/connection"
+	"github.com/ryan-berger/chatty/repositories"
+)
+
+func TestProtobufCodec_DecodeCredentials(t *testing.T) {
+	b, _ := proto.Marshal(&pbCredentials{Values: map[string]string{"id": "testID"}})
+
+	creds := CodecFor(ProtobufSubprotocol).DecodeCredentials(b)
+	if creds["id"] != "testID" {
+		t.Fatalf("expected testID, received %s", creds["id"])
+	}
+}
+
+func TestProtobufCodec_DecodeRequest(t *testing.T) {
+	tests := []struct {
+		reqType  requestType
+		body     proto.Message
+		expected connection.Request
+	}{
+		{
+			reqType: sendMessage,
+			body:    &pbSendMessageRequest{Message: "test", ConversationId: "convID", IdempotencyKey: "key"},
+			expected: connection.Request{Type: connection.SendMessage, Data: connection.SendMessageRequest{
+				Message: "test", ConversationID: "convID", IdempotencyKey: "key",
+			}},
+		},
+		{
+			reqType: createConversation,
+			body:    &pbCreateConversationRequest{Name: "test", Conversants: []string{"a", "b"}},
+			expected: connection.Request{Type: connection.CreateConversation, Data: connection.CreateConversationRequest{
+				Name: "test", Conversants: []string{"a", "b"},
+			}},
+		},
+		{
+			reqType: retrieveConversation,
+			body:    &pbRetrieveConversationRequest{ConversationId: "convID", Limit: 10, Offset: 5, Before: 20, After: 3},
+			expected: connection.Request{Type: connection.RetrieveConversation, Data: connection.RetrieveConversationRequest{
+				ConversationID: "convID", Limit: 10, Offset: 5, Before: 20, After: 3,
+			}},
+		},
+		{
+			reqType: resume,
+			body:    &pbResumeRequest{Cursors: map[string]int64{"convID": 7}},
+			expected: connection.Request{Type: connection.Resume, Data: connection.ResumeRequest{
+				Cursors: map[string]int64{"convID": 7},
+			}},
+		},
+		{
+			reqType:  listConversations,
+			body:     &pbListConversationsRequest{Limit: 10, Offset: 5},
+			expected: connection.Request{Type: connection.ListConversations, Data: connection.ListConversationsRequest{Limit: 10, Offset: 5}},
+		},
+		{
+			reqType: addConversants,
+			body:    &pbConversantsRequest{ConversationId: "convID", Conversants: []string{"a"}},
+			expected: connection.Request{Type: connection.AddConversants, Data: connection.AddConversantsRequest{
+				ConversationID: "convID", Conversants: []string{"a"},
+			}},
+		},
+		{
+			reqType: removeConversants,
+			body:    &pbConversantsRequest{ConversationId: "convID", Conversants: []string{"a"}},
+			expected: connection.Request{Type: connection.RemoveConversants, Data: connection.RemoveConversantsRequest{
+				ConversationID: "convID", Conversants: []string{"a"},
+			}},
+		},
+		{
+			reqType:  leaveConversation,
+			body:     &pbConversationRequest{ConversationId: "convID"},
+			expected: connection.Request{Type: connection.LeaveConversation, Data: connection.LeaveConversationRequest{ConversationID: "convID"}},
+		},
+		{
+			reqType: reauthenticate,
+			body:    &pbCredentials{Values: map[string]string{"token": "test"}},
+			expected: connection.Request{Type: connection.Reauthenticate, Data: connection.ReauthenticateRequest{
+				Credentials: map[string]string{"token": "test"},
+			}},
+		},
+		{
+			reqType: setRole,
+			body:    &pbSetRoleRequest{ConversationId: "convID", ConversantId: "a", Role: string(repositories.RoleAdmin)},
+			expected: connection.Request{Type: connection.SetRole, Data: connection.SetRoleRequest{
+				ConversationID: "convID", ConversantID: "a", Role: repositories.RoleAdmin,
+			}},
+		},
+		{
+			reqType: renameConversation,
+			body:    &pbRenameConversationRequest{ConversationId: "convID", Name: "test"},
+			expected: connection.Request{Type: connection.RenameConversation, Data: connection.RenameConversationRequest{
+				ConversationID: "convID", Name: "test",
+			}},
+		},
+		{
+			reqType:  deleteConversation,
+			body:     &pbConversationRequest{ConversationId: "convID"},
+			expected: connection.Request{Type: connection.DeleteConversation, Data: connection.DeleteConversationRequest{ConversationID: "convID"}},
+		},
+		{
+			reqType:  block,
+			body:     &pbBlockRequest{ConversantId: "a", Mute: true},
+			expected: connection.Request{Type: connection.Block, Data: connection.BlockRequest{ConversantID: "a", Mute: true}},
+		},
+		{
+			reqType:  unblock,
+			body:     &pbBlockRequest{ConversantId: "a"},
+			expected: connection.Request{Type: connection.Unblock, Data: connection.UnblockRequest{ConversantID: "a"}},
+		},
+		{
+			reqType:  "asdf",
+			body:     &pbConversationRequest{ConversationId: "convID"},
+			expected: connection.Request{Type: connection.RequestError},
+		},
+	}
+
+	for _, test := range tests {
+		data, err := proto.Marshal(test.body)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		b, err := proto.Marshal(&Frame{Type: string(test.reqType), Data: data, RequestId: "reqID"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		test.expected.RequestID = "reqID"
+		req := CodecFor(ProtobufSubprotocol).DecodeRequest(b)
+		if !reflect.DeepEqual(req, test.expected) {
+			t.Fatalf("%s: expected %+v, received %+v", test.reqType, test.expected, req)
+		}
+	}
+}
+
+func TestProtobufCodec_EncodeResponse(t *testing.T) {
+	now := time.Unix(1553774400, 0)
+	nowProto := &timestamp.Timestamp{Seconds: 1553774400}
+
+	message := repositories.Message{
+		ID: "msgID", SenderID: "a", Message: "test", ConversationID: "convID", IdempotencyKey: "key", Sequence: 4,
+	}
+	pbMsg := &pbMessage{
+		Id: "msgID", SenderId: "a", Message: "test", ConversationId: "convID", IdempotencyKey: "key", Sequence: 4,
+	}
+	conversation := repositories.Conversation{
+		ID:          "convID",
+		Name:        "test",
+		Conversants: []repositories.Conversant{{ID: "a", DisplayName: "A", Role: repositories.RoleOwner}},
+		Messages:    []repositories.Message{message},
+	}
+
+	tests := []struct {
+		respType connection.ResponseType
+		data     interface{}
+		expected proto.Message
+	}{
+		{
+			respType: connection.NewMessage,
+			data:     message,
+			expected: pbMsg,
+		},
+		{
+			respType: connection.NewConversation,
+			data:     conversation,
+			expected: &pbConversation{
+				Id:          "convID",
+				Name:        "test",
+				Conversants: []*pbConversant{{Id: "a", Name: "A", Role: string(repositories.RoleOwner)}},
+				Messages:    []*pbMessage{pbMsg},
+			},
+		},
+		{
+			respType: connection.ReturnConversation,
+			data:     connection.ReturnConversationResponse{Conversation: conversation, PrevCursor: 1, NextCursor: 5},
+			expected: &pbConversation{
+				Id:          "convID",
+				Name:        "test",
+				Conversants: []*pbConversant{{Id: "a", Name: "A", Role: string(repositories.RoleOwner)}},
+				Messages:    []*pbMessage{pbMsg},
+				PrevCursor:  1,
+				NextCursor:  5,
+			},
+		},
+		{
+			respType: connection.MessageAccepted,
+			data:     connection.MessageAcceptedResponse{MessageID: "msgID", ConversationID: "convID"},
+			expected: &pbMessageAccepted{MessageId: "msgID", ConversationId: "convID"},
+		},
+		{
+			respType: connection.Resumed,
+			data:     connection.ResumedResponse{Cursors: map[string]int64{"convID": 4}},
+			expected: &pbResumed{Cursors: map[string]int64{"convID": 4}},
+		},
+		{
+			respType: connection.ConversationList,
+			data: connection.ListConversationsResponse{Conversations: []repositories.ConversationSummary{
+				{ID: "convID", Name: "test", LastMessage: &message, UnreadCount: 2, LastActivity: now},
+				{ID: "directID", Direct: true},
+			}},
+			expected: &pbConversationList{Conversations: []*pbConversationSummary{
+				{Id: "convID", Name: "test", LastMessage: pbMsg, UnreadCount: 2, LastActivity: nowProto},
+				{Id: "directID", Direct: true},
+			}},
+		},
+		{
+			respType: connection.ConversationUpdated,
+			data: connection.ConversationUpdatedResponse{
+				ConversationID: "convID",
+				Name:           "test",
+				Conversants:    []repositories.Conversant{{ID: "a"}},
+				Added:          []string{"a"},
+				Removed:        []string{"b"},
+			},
+			expected: &pbConversationUpdated{
+				ConversationId: "convID",
+				Name:           "test",
+				Conversants:    []*pbConversant{{Id: "a"}},
+				Added:          []string{"a"},
+				Removed:        []string{"b"},
+			},
+		},
+		{
+			respType: connection.ConversationDeleted,
+			data:     connection.ConversationDeletedResponse{ConversationID: "convID"},
+			expected: &pbConversationDeleted{ConversationId: "convID"},
+		},
+		{
+			respType: connection.BlockUpdated,
+			data:     connection.BlockUpdatedResponse{ConversantID: "a", Blocked: true, Mute: true},
+			expected: &pbBlockUpdated{ConversantId: "a", Blocked: true, Mute: true},
+		},
+		{
+			respType: connection.AuthExpiring,
+			data:     connection.AuthExpiringResponse{ExpiresAt: now},
+			expected: &pbExpiry{ExpiresAt: nowProto},
+		},
+		{
+			respType: connection.Reauthenticated,
+			data:     connection.ReauthenticatedResponse{ExpiresAt: now},
+			expected: &pbExpiry{ExpiresAt: nowProto},
+		},
+		{
+			respType: connection.Error,
+			data:     connection.ResponseError{Error: "test", Code: "code"},
+			expected: &pbError{Error: "test", Code: "code"},
+		},
+	}
+
+	for _, test := range tests {
+		b, err := CodecFor(ProtobufSubprotocol).EncodeResponse(connection.Response{
+			Type: test.respType, Data: test.data, RequestID: "reqID",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var frame Frame
+		if err := proto.Unmarshal(b, &frame); err != nil {
+			t.Fatal(err)
+		}
+
+		if frame.Type != string(typeToString[test.respType]) || frame.RequestId != "reqID" {
+			t.Fatalf("expected %s frame for reqID, received %s for %s", typeToString[test.respType], frame.Type, frame.RequestId)
+		}
+
+		body := proto.Clone(test.expected)
+		body.Reset()
+		if err := proto.Unmarshal(frame.Data, body); err != nil {
+			t.Fatal(err)
+		}
+
+		if !proto.Equal(body, test.expected) {
+			t.Fatalf("%s: expected %v, received %v", frame.Type, test.expected, body)
+		}
+	}
+}
+
+func TestProtobufCodec_EncodeResponseNoData(t *testing.T) {
+	b, err := CodecFor(ProtobufSubprotocol).EncodeResponse(connection.Response{Type: connection.NewConversation})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var frame Frame
+	proto.Unmarshal(b, &frame)
+	if frame.Type != string(newConversation) || len(frame.Data) != 0 {
+		t.Fatalf("expected empty newConversation frame, received %v", frame)
+	}
+
+	_, err = CodecFor(ProtobufSubprotocol).EncodeResponse(connection.Response{Type: connection.NewMessage, Data: "asdf"})
+	if err == nil {
+		t.Fatal("expected error encoding data with no protobuf message")
+	}
+}
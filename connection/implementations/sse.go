@@ -0,0 +1,301 @@
+package implementations
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/pborman/uuid"
+
+	"github.com/ryan-berger/chatty/connection"
+	"github.com/ryan-berger/chatty/repositories"
+)
+
+const sessionEvent = "session"
+
+// discardTimeout is how long a closed connection keeps discarding responses after
+// the last one it was sent. By then the manager has removed the connection, and
+// finished sending anything it was already sending to it
+const discardTimeout = 30 * time.Second
+
+type sseSession struct {
+	SessionID string `json:"sessionId"`
+}
+
+// SSEHandler serves chat sessions over Server-Sent Events. A GET opens a
+// text/event-stream that carries responses, and POSTs with the session query
+// parameter carry requests. Both use the same JSON as the websocket Conn
+type SSEHandler struct {
+	join       func(connection.Conn)
+	auth       ExpiringAuth
+	sessionsMu *sync.RWMutex
+	sessions   map[string]*SSEConn
+}
+
+// NewSSEHandler is a factory for an SSEHandler. join will usually be ConnectionManager.Join
+func NewSSEHandler(join func(connection.Conn), auth Auth) *SSEHandler {
+	return NewExpiringSSEHandler(join, neverExpires(auth))
+}
+
+// NewExpiringSSEHandler is an SSEHandler for credentials that expire. Clients have to
+// POST a reauthenticate request with fresh credentials before theirs do
+func NewExpiringSSEHandler(join func(connection.Conn), auth ExpiringAuth) *SSEHandler {
+	return &SSEHandler{
+		join:       join,
+		auth:       auth,
+		sessionsMu: &sync.RWMutex{},
+		sessions:   make(map[string]*SSEConn),
+	}
+}
+
+// ServeHTTP satisfies http.Handler
+func (handler *SSEHandler) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	switch request.Method {
+	case http.MethodGet:
+		handler.stream(writer, request)
+	case http.MethodPost:
+		handler.receive(writer, request)
+	default:
+		http.Error(writer, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// stream authorizes the connection using the query parameters as credentials,
+// then holds the request open writing responses as events until the client goes away
+func (handler *SSEHandler) stream(writer http.ResponseWriter, request *http.Request) {
+	flusher, ok := writer.(http.Flusher)
+	if !ok {
+		http.Error(writer, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	creds := make(map[string]string)
+	for k, v := range request.URL.Query() {
+		creds[k] = v[0]
+	}
+
+	conn := newSSEConn(uuid.New(), creds, handler.auth)
+	handler.join(conn)
+
+	if !conn.authorized {
+		http.Error(writer, "not authorized", http.StatusUnauthorized)
+		return
+	}
+
+	handler.sessionsMu.Lock()
+	handler.sessions[conn.sessionID] = conn
+	handler.sessionsMu.Unlock()
+
+	defer func() {
+		handler.sessionsMu.Lock()
+		delete(handler.sessions, conn.sessionID)
+		handler.sessionsMu.Unlock()
+	}()
+
+	writer.Header().Set("Content-Type", "text/event-stream")
+	writer.Header().Set("Cache-Control", "no-cache")
+	writer.Header().Set("Connection", "keep-alive")
+	writer.WriteHeader(http.StatusOK)
+
+	conn.writer = writer
+	conn.flusher = flusher
+
+	err := conn.writeEvent(sessionEvent, sseSession{SessionID: conn.sessionID})
+	if err != nil {
+		conn.close()
+		return
+	}
+
+	conn.pumpOut(request.Context().Done())
+}
+
+// receive hands a POSTed request to the session's connection
+func (handler *SSEHandler) receive(writer http.ResponseWriter, request *http.Request) {
+	handler.sessionsMu.RLock()
+	conn, ok := handler.sessions[request.URL.Query().Get("session")]
+	handler.sessionsMu.RUnlock()
+
+	if !ok {
+		http.Error(writer, "unknown session", http.StatusNotFound)
+		return
+	}
+
+	body, err := ioutil.ReadAll(request.Body)
+	if err != nil {
+		http.Error(writer, "unable to read body", http.StatusBadRequest)
+		return
+	}
+
+	select {
+	case conn.requests <- wsRequestData(body):
+		writer.WriteHeader(http.StatusAccepted)
+	case <-conn.done:
+		http.Error(writer, "session closed", http.StatusGone)
+	case <-request.Context().Done():
+	}
+}
+
+// SSEConn is a Server-Sent Events implementation of the Conn interface
+type SSEConn struct {
+	sessionID  string
+	creds      map[string]string
+	conversant repositories.Conversant
+	authorized bool
+	writer     http.ResponseWriter
+	flusher    http.Flusher
+	leave      chan struct{}
+	closing    chan struct{}
+	done       chan struct{}
+	closeOnce  *sync.Once
+	requests   chan connection.Request
+	responses  chan connection.Response
+	auth       ExpiringAuth
+	expiry
+}
+
+func newSSEConn(sessionID string, creds map[string]string, auth ExpiringAuth) *SSEConn {
+	return &SSEConn{
+		sessionID: sessionID,
+		creds:     creds,
+		leave:     make(chan struct{}, 1),
+		closing:   make(chan struct{}, 1),
+		done:      make(chan struct{}),
+		closeOnce: &sync.Once{},
+		requests:  make(chan connection.Request),
+		responses: make(chan connection.Response),
+		auth:      auth,
+		expiry:    newExpiry(),
+	}
+}
+
+// close stops the event stream and tells the manager that the client is gone
+func (conn *SSEConn) close() {
+	conn.closeOnce.Do(func() {
+		close(conn.done)
+		select {
+		case conn.leave <- struct{}{}:
+		default:
+		}
+		go discardResponses(conn.responses)
+	})
+}
+
+// discardResponses drops whatever the manager sends to a closed connection, since it
+// sends while holding its connection lock and would otherwise block removing the
+// connection. It returns once nothing has been sent for discardTimeout
+func discardResponses(responses chan connection.Response) {
+	timer := time.NewTimer(discardTimeout)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-responses:
+			if !timer.Stop() {
+				<-timer.C
+			}
+			timer.Reset(discardTimeout)
+		case <-timer.C:
+			return
+		}
+	}
+}
+
+func (conn *SSEConn) pumpOut(hangup <-chan struct{}) {
+	for {
+		select {
+		case <-conn.done:
+			return
+		case <-hangup:
+			conn.close()
+			return
+		case <-conn.closing:
+			conn.close()
+			return
+		case response := <-conn.responses:
+			err := conn.writeEvent("", newWsResponse(response))
+			if err != nil {
+				conn.close()
+				return
+			}
+		}
+	}
+}
+
+func (conn *SSEConn) writeEvent(event string, data interface{}) error {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	if event != "" {
+		if _, err = fmt.Fprintf(conn.writer, "event: %s\n", event); err != nil {
+			return err
+		}
+	}
+
+	if _, err = fmt.Fprintf(conn.writer, "data: %s\n\n", b); err != nil {
+		return err
+	}
+
+	conn.flusher.Flush()
+	return nil
+}
+
+// Authorize satisfies the Conn interface
+func (conn *SSEConn) Authorize() error {
+	conversant, expiresAt, err := conn.auth(conn.creds)
+
+	if err != nil {
+		conn.close()
+		return errors.New("not authorized")
+	}
+
+	conn.conversant = conversant
+	conn.authorized = true
+	conn.setExpiry(expiresAt)
+	return nil
+}
+
+// Reauthenticate satisfies the connection.Expiring interface. The credentials
+// have to be for the conversant the connection was authorized as
+func (conn *SSEConn) Reauthenticate(creds map[string]string) error {
+	expiresAt, err := checkReauthentication(conn.auth, conn.conversant, creds)
+	if err != nil {
+		return err
+	}
+
+	conn.setExpiry(expiresAt)
+	return nil
+}
+
+// GetConversant satisfies the Conn interface
+func (conn *SSEConn) GetConversant() repositories.Conversant {
+	return conn.conversant
+}
+
+// Requests satisfies the Conn interface
+func (conn *SSEConn) Requests() chan connection.Request {
+	return conn.requests
+}
+
+// Response satisfies the Conn interface
+func (conn *SSEConn) Response() chan connection.Response {
+	return conn.responses
+}
+
+// Leave satisfies the Conn interface
+func (conn *SSEConn) Leave() chan struct{} {
+	return conn.leave
+}
+
+// Close satisfies the Conn interface. The event stream ends once the connection is closed
+func (conn *SSEConn) Close() {
+	select {
+	case conn.closing <- struct{}{}:
+	default:
+	}
+}
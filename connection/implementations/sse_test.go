@@ -0,0 +1,193 @@
+package implementations
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ryan-berger/chatty/connection"
+	"github.com/ryan-berger/chatty/repositories"
+)
+
+func testAuth(creds map[string]string) (repositories.Conversant, error) {
+	if id, ok := creds["id"]; ok {
+		return repositories.Conversant{ID: id}, nil
+	}
+	return repositories.Conversant{}, errors.New("test")
+}
+
+func readEvent(t *testing.T, reader *bufio.Reader) (string, string) {
+	var event, data string
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("couldn't read event: %s", err)
+		}
+
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case line == "":
+			return event, data
+		case strings.HasPrefix(line, "event: "):
+			event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			data = strings.TrimPrefix(line, "data: ")
+		}
+	}
+}
+
+func TestSSEHandler_Unauthorized(t *testing.T) {
+	handler := NewSSEHandler(func(conn connection.Conn) {
+		conn.Authorize()
+	}, testAuth)
+
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expected %d, received %d", http.StatusUnauthorized, resp.StatusCode)
+	}
+}
+
+func TestSSEHandler_Stream(t *testing.T) {
+	joined := make(chan connection.Conn, 1)
+	handler := NewSSEHandler(func(conn connection.Conn) {
+		conn.Authorize()
+		joined <- conn
+	}, testAuth)
+
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "?id=testID")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	conn := <-joined
+	if conn.GetConversant().ID != "testID" {
+		t.Fatalf("expected that %s would be testID", conn.GetConversant().ID)
+	}
+
+	reader := bufio.NewReader(resp.Body)
+	event, data := readEvent(t, reader)
+	if event != sessionEvent {
+		t.Fatalf("expected %s event, received %s", sessionEvent, event)
+	}
+
+	sessionID := conn.(*SSEConn).sessionID
+	if data != `{"sessionId":"`+sessionID+`"}` {
+		t.Fatalf("unexpected session data %s", data)
+	}
+
+	for _, response := range responses {
+		conn.Response() <- connection.Response{Type: response.respType}
+
+		_, data := readEvent(t, reader)
+		if data != string(response.resp) {
+			t.Fatalf("expected %s, received %s", string(response.resp), data)
+		}
+	}
+
+	for _, request := range requests {
+		go func(body string) {
+			resp, err := http.Post(server.URL+"?session="+sessionID, "application/json", strings.NewReader(body))
+			if err == nil {
+				resp.Body.Close()
+			}
+		}(string(request.req))
+
+		req := <-conn.Requests()
+		if req.Type != request.reqType {
+			t.Fatalf("expected %d, type was actually: %d", request.reqType, req.Type)
+		}
+	}
+
+	resp.Body.Close()
+
+	select {
+	case <-conn.Leave():
+	case <-time.After(time.Second):
+		t.Fatalf("didn't leave")
+	}
+
+	// the manager can still be sending to the connection until it has removed it
+	select {
+	case conn.Response() <- connection.Response{Type: connection.NewMessage}:
+	case <-time.After(time.Second):
+		t.Fatal("sending to a closed connection blocked")
+	}
+}
+
+func TestSSEHandler_UnknownSession(t *testing.T) {
+	handler := NewSSEHandler(func(conn connection.Conn) {}, testAuth)
+
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	resp, err := http.Post(server.URL+"?session=asdf", "application/json", strings.NewReader(`{"type":"sendMessage"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected %d, received %d", http.StatusNotFound, resp.StatusCode)
+	}
+}
+
+func TestSSEConn_Reauthenticate(t *testing.T) {
+	expiry := time.Now().Add(time.Minute)
+
+	conn := newSSEConn("session", map[string]string{"id": "testID"}, expiringTestAuth(&expiry))
+	if err := conn.Authorize(); err != nil {
+		t.Fatal(err)
+	}
+
+	testReauthenticate(t, conn, &expiry)
+}
+
+func TestSSEConn_Close(t *testing.T) {
+	joined := make(chan connection.Conn, 1)
+	handler := NewSSEHandler(func(conn connection.Conn) {
+		conn.Authorize()
+		joined <- conn
+	}, testAuth)
+
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "?id=testID")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	conn := <-joined
+	reader := bufio.NewReader(resp.Body)
+	readEvent(t, reader)
+
+	// the response sent before closing is written before the stream ends
+	conn.Response() <- connection.NewAuthExpiredError()
+	conn.Close()
+
+	if _, data := readEvent(t, reader); !strings.Contains(data, `"type":"error"`) {
+		t.Fatalf("expected an error response, received %s", data)
+	}
+
+	if _, err = reader.ReadString('\n'); err != io.EOF {
+		t.Fatalf("expected the stream to end, received %v", err)
+	}
+}
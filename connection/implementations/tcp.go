@@ -0,0 +1,222 @@
+package implementations
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/ryan-berger/chatty/connection"
+	"github.com/ryan-berger/chatty/repositories"
+)
+
+const maxLineSize = 1 << 20
+
+// ListenTCP listens on addr, wrapping the listener in TLS when config is not nil
+func ListenTCP(addr string, config *tls.Config) (net.Listener, error) {
+	if config != nil {
+		return tls.Listen("tcp", addr, config)
+	}
+	return net.Listen("tcp", addr)
+}
+
+// ServeTCP accepts connections from listener and hands each one to join as a TCPConn.
+// join will usually be ConnectionManager.Join
+func ServeTCP(listener net.Listener, join func(connection.Conn), auth Auth) error {
+	return ServeExpiringTCP(listener, join, neverExpires(auth))
+}
+
+// ServeExpiringTCP is ServeTCP for credentials that expire. Clients have to send
+// a reauthenticate request with fresh credentials before theirs do
+func ServeExpiringTCP(listener net.Listener, join func(connection.Conn), auth ExpiringAuth) error {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return err
+		}
+
+		go join(NewExpiringTCPConn(conn, auth))
+	}
+}
+
+// TCPConn is a newline delimited JSON implementation of the Conn interface. The first
+// line is the credentials object, and every line after is the same {type, data}
+// envelope the websocket Conn uses
+type TCPConn struct {
+	conn       net.Conn
+	scanner    *bufio.Scanner
+	conversant repositories.Conversant
+	leave      chan struct{}
+	closing    chan struct{}
+	done       chan struct{}
+	closeOnce  *sync.Once
+	requests   chan connection.Request
+	responses  chan connection.Response
+	auth       ExpiringAuth
+	expiry
+}
+
+// NewTCPConn is a factory for a TCP connection
+func NewTCPConn(conn net.Conn, auth Auth) *TCPConn {
+	return NewExpiringTCPConn(conn, neverExpires(auth))
+}
+
+// NewExpiringTCPConn is a TCP connection whose credentials expire
+func NewExpiringTCPConn(conn net.Conn, auth ExpiringAuth) *TCPConn {
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 4096), maxLineSize)
+
+	return &TCPConn{
+		conn:      conn,
+		scanner:   scanner,
+		leave:     make(chan struct{}, 1),
+		closing:   make(chan struct{}, 1),
+		done:      make(chan struct{}),
+		closeOnce: &sync.Once{},
+		requests:  make(chan connection.Request),
+		responses: make(chan connection.Response),
+		auth:      auth,
+		expiry:    newExpiry(),
+	}
+}
+
+// close hangs up the socket and tells the manager that the client is gone
+func (conn *TCPConn) close() {
+	conn.closeOnce.Do(func() {
+		close(conn.done)
+		conn.conn.Close()
+		select {
+		case conn.leave <- struct{}{}:
+		default:
+		}
+		go discardResponses(conn.responses)
+	})
+}
+
+func (conn *TCPConn) readLine() ([]byte, error) {
+	if !conn.scanner.Scan() {
+		if err := conn.scanner.Err(); err != nil {
+			return nil, err
+		}
+		return nil, errors.New("connection closed")
+	}
+	return conn.scanner.Bytes(), nil
+}
+
+func (conn *TCPConn) pumpIn() {
+	conn.conn.SetReadDeadline(time.Time{})
+	for {
+		line, err := conn.readLine()
+		if err != nil {
+			conn.close()
+			return
+		}
+
+		select {
+		case conn.requests <- wsRequestData(line):
+		case <-conn.done:
+			return
+		}
+	}
+}
+
+func (conn *TCPConn) pumpOut() {
+	for {
+		select {
+		case <-conn.done:
+			return
+		case <-conn.closing:
+			conn.close()
+			return
+		case response := <-conn.responses:
+			conn.send(newWsResponse(response))
+		}
+	}
+}
+
+func (conn *TCPConn) send(response wsResponse) {
+	b, err := json.Marshal(&response)
+	if err != nil {
+		return
+	}
+
+	conn.conn.SetWriteDeadline(time.Now().Add(5 * time.Second))
+	_, err = conn.conn.Write(append(b, '\n'))
+	if err != nil {
+		conn.close()
+	}
+}
+
+// Authorize satisfies the Conn interface
+func (conn *TCPConn) Authorize() error {
+	err := conn.conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+	if err != nil {
+		conn.close()
+		return err
+	}
+
+	line, err := conn.readLine()
+	if err != nil {
+		conn.close()
+		return err
+	}
+
+	var creds map[string]string
+	json.Unmarshal(line, &creds)
+
+	conversant, expiresAt, err := conn.auth(creds)
+	if err != nil {
+		conn.close()
+		return errors.New("not authorized")
+	}
+
+	conn.conversant = conversant
+	conn.setExpiry(expiresAt)
+
+	go conn.pumpIn()
+	go conn.pumpOut()
+	return nil
+}
+
+// Reauthenticate satisfies the connection.Expiring interface. The credentials
+// have to be for the conversant the connection was authorized as
+func (conn *TCPConn) Reauthenticate(creds map[string]string) error {
+	expiresAt, err := checkReauthentication(conn.auth, conn.conversant, creds)
+	if err != nil {
+		return err
+	}
+
+	conn.setExpiry(expiresAt)
+	return nil
+}
+
+// GetConversant satisfies the Conn interface
+func (conn *TCPConn) GetConversant() repositories.Conversant {
+	return conn.conversant
+}
+
+// Requests satisfies the Conn interface
+func (conn *TCPConn) Requests() chan connection.Request {
+	return conn.requests
+}
+
+// Response satisfies the Conn interface
+func (conn *TCPConn) Response() chan connection.Response {
+	return conn.responses
+}
+
+// Leave satisfies the Conn interface
+func (conn *TCPConn) Leave() chan struct{} {
+	return conn.leave
+}
+
+// Close satisfies the Conn interface
+func (conn *TCPConn) Close() {
+	select {
+	case conn.closing <- struct{}{}:
+	default:
+	}
+}
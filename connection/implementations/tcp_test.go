@@ -0,0 +1,172 @@
+package implementations
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ryan-berger/chatty/connection"
+)
+
+func TestTCPConn_Authorize(t *testing.T) {
+	server, client := net.Pipe()
+	conn := NewTCPConn(server, testAuth)
+
+	go client.Write([]byte(`{"test": "test"}` + "\n"))
+
+	if err := conn.Authorize(); err == nil {
+		t.Fatalf("authorize should have failed")
+	}
+
+	if _, err := client.Write([]byte("\n")); err == nil {
+		t.Fatalf("connection should have closed")
+	}
+}
+
+func TestTCPConn_GetConversant(t *testing.T) {
+	server, client := net.Pipe()
+	conn := NewTCPConn(server, testAuth)
+
+	go client.Write([]byte(`{"id": "testID"}` + "\n"))
+
+	if err := conn.Authorize(); err != nil {
+		t.Fatalf("authorize shouldn't have failed: %s", err)
+	}
+
+	if conn.GetConversant().ID != "testID" {
+		t.Fatalf("expected that %s would be testID", conn.GetConversant().ID)
+	}
+
+	client.Close()
+}
+
+func TestTCPConn_RequestsResponses(t *testing.T) {
+	server, client := net.Pipe()
+	conn := NewTCPConn(server, testAuth)
+
+	go client.Write([]byte(`{"id": "testID"}` + "\n"))
+	conn.Authorize()
+
+	for _, request := range requests {
+		go client.Write(append(request.req, '\n'))
+		req := <-conn.Requests()
+
+		if req.Type != request.reqType {
+			t.Fatalf("expected %d, type was actually: %d", request.reqType, req.Type)
+		}
+	}
+
+	reader := bufio.NewReader(client)
+	for _, response := range responses {
+		conn.Response() <- connection.Response{Type: response.respType}
+
+		line, err := reader.ReadBytes('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if string(line) != string(response.resp)+"\n" {
+			t.Fatalf("expected %s, received %s", string(response.resp), string(line))
+		}
+	}
+
+	client.Close()
+
+	select {
+	case <-conn.Leave():
+	case <-time.After(10 * time.Millisecond):
+		t.Fatalf("didn't leave")
+	}
+
+	// the manager can still be sending to the connection until it has removed it
+	select {
+	case conn.Response() <- connection.Response{Type: connection.NewMessage}:
+	case <-time.After(time.Second):
+		t.Fatal("sending to a closed connection blocked")
+	}
+}
+
+func TestServeTCP(t *testing.T) {
+	listener, err := ListenTCP("127.0.0.1:0", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	joined := make(chan connection.Conn, 1)
+	go ServeTCP(listener, func(conn connection.Conn) {
+		conn.Authorize()
+		joined <- conn
+	}, testAuth)
+
+	client, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	client.Write([]byte(`{"id": "testID"}` + "\n"))
+
+	select {
+	case conn := <-joined:
+		if conn.GetConversant().ID != "testID" {
+			t.Fatalf("expected that %s would be testID", conn.GetConversant().ID)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("didn't join")
+	}
+}
+
+func TestTCPConn_Reauthenticate(t *testing.T) {
+	expiry := time.Now().Add(time.Minute)
+
+	server, client := net.Pipe()
+	defer client.Close()
+	conn := NewExpiringTCPConn(server, expiringTestAuth(&expiry))
+
+	go client.Write([]byte(`{"id": "testID"}` + "\n"))
+
+	if err := conn.Authorize(); err != nil {
+		t.Fatal(err)
+	}
+
+	testReauthenticate(t, conn, &expiry)
+}
+
+func TestTCPConn_Close(t *testing.T) {
+	server, client := net.Pipe()
+	defer client.Close()
+	conn := NewTCPConn(server, testAuth)
+
+	go client.Write([]byte(`{"id": "testID"}` + "\n"))
+	if err := conn.Authorize(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the response sent before closing is written before the socket is hung up
+	conn.Response() <- connection.NewAuthExpiredError()
+	conn.Close()
+
+	reader := bufio.NewReader(client)
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(line, `"type":"error"`) {
+		t.Fatalf("expected an error response, received %s", line)
+	}
+
+	if _, err = reader.ReadString('\n'); err != io.EOF {
+		t.Fatalf("expected the connection to be hung up, received %v", err)
+	}
+
+	select {
+	case <-conn.Leave():
+	case <-time.After(time.Second):
+		t.Fatal("didn't leave")
+	}
+}
@@ -3,6 +3,7 @@ package implementations
 import (
 	"encoding/json"
 	"errors"
+	"sync"
 	"time"
 
 	"github.com/ryan-berger/chatty/repositories"
@@ -17,9 +18,28 @@ const (
 	sendMessage          requestType  = "sendMessage"
 	createConversation   requestType  = "createConversation"
 	retrieveConversation requestType  = "retrieveConversation"
+	resume               requestType  = "resume"
+	listConversations    requestType  = "listConversations"
+	addConversants       requestType  = "addConversants"
+	removeConversants    requestType  = "removeConversants"
+	leaveConversation    requestType  = "leaveConversation"
+	reauthenticate       requestType  = "reauthenticate"
+	setRole              requestType  = "setRole"
+	renameConversation   requestType  = "renameConversation"
+	deleteConversation   requestType  = "deleteConversation"
+	block                requestType  = "block"
+	unblock              requestType  = "unblock"
 	newMessage           responseType = "newMessage"
 	newConversation      responseType = "newConversation"
 	returnConversation   responseType = "returnConversation"
+	messageAccepted      responseType = "messageAccepted"
+	resumed              responseType = "resumed"
+	conversationList     responseType = "conversationList"
+	conversationUpdated  responseType = "conversationUpdated"
+	authExpiring         responseType = "authExpiring"
+	reauthenticated      responseType = "reauthenticated"
+	conversationDeleted  responseType = "conversationDeleted"
+	blockUpdated         responseType = "blockUpdated"
 	responseError        responseType = "error"
 )
 
@@ -27,43 +47,122 @@ var stringToType = map[requestType]connection.RequestType{
 	sendMessage:          connection.SendMessage,
 	createConversation:   connection.CreateConversation,
 	retrieveConversation: connection.RetrieveConversation,
+	resume:               connection.Resume,
+	listConversations:    connection.ListConversations,
+	addConversants:       connection.AddConversants,
+	removeConversants:    connection.RemoveConversants,
+	leaveConversation:    connection.LeaveConversation,
+	reauthenticate:       connection.Reauthenticate,
+	setRole:              connection.SetRole,
+	renameConversation:   connection.RenameConversation,
+	deleteConversation:   connection.DeleteConversation,
+	block:                connection.Block,
+	unblock:              connection.Unblock,
 }
 
 var typeToString = map[connection.ResponseType]responseType{
-	connection.NewMessage:         newMessage,
-	connection.NewConversation:    newConversation,
-	connection.Error:              responseError,
-	connection.ReturnConversation: returnConversation,
+	connection.NewMessage:          newMessage,
+	connection.NewConversation:     newConversation,
+	connection.Error:               responseError,
+	connection.ReturnConversation:  returnConversation,
+	connection.MessageAccepted:     messageAccepted,
+	connection.Resumed:             resumed,
+	connection.ConversationList:    conversationList,
+	connection.ConversationUpdated: conversationUpdated,
+	connection.AuthExpiring:        authExpiring,
+	connection.Reauthenticated:     reauthenticated,
+	connection.ConversationDeleted: conversationDeleted,
+	connection.BlockUpdated:        blockUpdated,
 }
 
 type Auth func(map[string]string) (repositories.Conversant, error)
 
+// ExpiringAuth is an Auth for credentials that expire, like tokens, that also returns
+// when they do. A Conn with an ExpiringAuth satisfies connection.Expiring
+type ExpiringAuth func(map[string]string) (repositories.Conversant, time.Time, error)
+
+// neverExpires adapts auth to an ExpiringAuth with credentials that never expire
+func neverExpires(auth Auth) ExpiringAuth {
+	return func(creds map[string]string) (repositories.Conversant, time.Time, error) {
+		conversant, err := auth(creds)
+		return conversant, time.Time{}, err
+	}
+}
+
+// expiry is when a Conn's credentials expire. Embedding it gives a Conn the
+// Expiry half of connection.Expiring, and it is safe for concurrent use
+type expiry struct {
+	mu        *sync.RWMutex
+	expiresAt time.Time
+}
+
+func newExpiry() expiry {
+	return expiry{mu: &sync.RWMutex{}}
+}
+
+// Expiry satisfies the connection.Expiring interface
+func (e *expiry) Expiry() time.Time {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.expiresAt
+}
+
+func (e *expiry) setExpiry(expiresAt time.Time) {
+	e.mu.Lock()
+	e.expiresAt = expiresAt
+	e.mu.Unlock()
+}
+
+// checkReauthentication checks fresh credentials with auth, returning when they expire.
+// They have to be for the conversant the connection was authorized as
+func checkReauthentication(auth ExpiringAuth, conversant repositories.Conversant, creds map[string]string) (time.Time, error) {
+	reauthenticated, expiresAt, err := auth(creds)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	if reauthenticated.ID != conversant.ID {
+		return time.Time{}, errors.New("credentials are for a different conversant")
+	}
+
+	return expiresAt, nil
+}
+
 // Conn is a websocket implementation of the Conn interface
 type Conn struct {
 	conn       WebsocketConn
 	conversant repositories.Conversant
 	leave      chan struct{}
+	closing    chan struct{}
+	done       chan struct{}
+	closeOnce  *sync.Once
 	requests   chan connection.Request
 	responses  chan connection.Response
-	auth       Auth
+	auth       ExpiringAuth
+	codec      Codec
+	creds      map[string]string
+	expiry
 }
 
 type WebsocketConn interface {
 	SetReadDeadline(time.Time) error
 	SetWriteDeadline(time.Time) error
 	ReadMessage() (int, []byte, error)
-	WriteJSON(interface{}) error
+	WriteMessage(int, []byte) error
+	Subprotocol() string
 	Close() error
 }
 
 type wsRequest struct {
 	RequestType requestType     `json:"type"`
+	RequestID   string          `json:"requestId"`
 	Data        json.RawMessage `json:"data"`
 }
 
 type wsResponse struct {
 	ResponseType responseType `json:"type"`
 	Data         interface{}  `json:"data"`
+	RequestID    string       `json:"requestId,omitempty"`
 }
 
 func wsRequestType(reqType requestType) connection.RequestType {
@@ -77,20 +176,78 @@ func wsRequestType(reqType requestType) connection.RequestType {
 func wsRequestData(data []byte) connection.Request {
 	var request wsRequest
 	json.Unmarshal(data, &request)
-	req := connection.Request{Type: wsRequestType(request.RequestType)}
+	req := requestData(request.RequestType, request.Data)
+	req.RequestID = request.RequestID
+	return req
+}
+
+// requestData decodes a JSON request body into the matching
+// connection request struct for the given request type
+func requestData(reqType requestType, data []byte) connection.Request {
+	return decodeRequestData(reqType, data, json.Unmarshal)
+}
+
+// decodeRequestData decodes a request body with unmarshal into the matching
+// connection request struct for the given request type
+func decodeRequestData(reqType requestType, data []byte, unmarshal func([]byte, interface{}) error) connection.Request {
+	req := connection.Request{Type: wsRequestType(reqType)}
 	switch req.Type {
 	case connection.SendMessage:
 		messageRequest := connection.SendMessageRequest{}
-		json.Unmarshal(request.Data, &messageRequest)
+		unmarshal(data, &messageRequest)
 		req.Data = messageRequest
 	case connection.CreateConversation:
 		conversationRequest := connection.CreateConversationRequest{}
-		json.Unmarshal(request.Data, &conversationRequest)
+		unmarshal(data, &conversationRequest)
 		req.Data = conversationRequest
 	case connection.RetrieveConversation:
 		retrieveConversationRequest := connection.RetrieveConversationRequest{}
-		json.Unmarshal(request.Data, &retrieveConversationRequest)
+		unmarshal(data, &retrieveConversationRequest)
 		req.Data = retrieveConversationRequest
+	case connection.Resume:
+		resumeRequest := connection.ResumeRequest{}
+		unmarshal(data, &resumeRequest)
+		req.Data = resumeRequest
+	case connection.ListConversations:
+		listConversationsRequest := connection.ListConversationsRequest{}
+		unmarshal(data, &listConversationsRequest)
+		req.Data = listConversationsRequest
+	case connection.AddConversants:
+		addConversantsRequest := connection.AddConversantsRequest{}
+		unmarshal(data, &addConversantsRequest)
+		req.Data = addConversantsRequest
+	case connection.RemoveConversants:
+		removeConversantsRequest := connection.RemoveConversantsRequest{}
+		unmarshal(data, &removeConversantsRequest)
+		req.Data = removeConversantsRequest
+	case connection.LeaveConversation:
+		leaveConversationRequest := connection.LeaveConversationRequest{}
+		unmarshal(data, &leaveConversationRequest)
+		req.Data = leaveConversationRequest
+	case connection.Reauthenticate:
+		reauthenticateRequest := connection.ReauthenticateRequest{}
+		unmarshal(data, &reauthenticateRequest)
+		req.Data = reauthenticateRequest
+	case connection.SetRole:
+		setRoleRequest := connection.SetRoleRequest{}
+		unmarshal(data, &setRoleRequest)
+		req.Data = setRoleRequest
+	case connection.RenameConversation:
+		renameConversationRequest := connection.RenameConversationRequest{}
+		unmarshal(data, &renameConversationRequest)
+		req.Data = renameConversationRequest
+	case connection.DeleteConversation:
+		deleteConversationRequest := connection.DeleteConversationRequest{}
+		unmarshal(data, &deleteConversationRequest)
+		req.Data = deleteConversationRequest
+	case connection.Block:
+		blockRequest := connection.BlockRequest{}
+		unmarshal(data, &blockRequest)
+		req.Data = blockRequest
+	case connection.Unblock:
+		unblockRequest := connection.UnblockRequest{}
+		unmarshal(data, &unblockRequest)
+		req.Data = unblockRequest
 	case connection.RequestError:
 		req.Data = nil
 	}
@@ -98,27 +255,63 @@ func wsRequestData(data []byte) connection.Request {
 	return req
 }
 
-// NewWebsocketConn is a factory for a websocket connection
+// NewWebsocketConn is a factory for a websocket connection. The codec is
+// picked from the subprotocol negotiated during the upgrade, see Subprotocols
 func NewWebsocketConn(conn WebsocketConn, auth Auth) *Conn {
-	wsConn := &Conn{
+	return NewExpiringWebsocketConn(conn, neverExpires(auth), nil)
+}
+
+// NewWebsocketConnWithCredentials is NewWebsocketConn for credentials that came with the
+// upgrade request, like an Authorization header. The client doesn't send a credentials frame
+func NewWebsocketConnWithCredentials(conn WebsocketConn, auth Auth, creds map[string]string) *Conn {
+	return NewExpiringWebsocketConn(conn, neverExpires(auth), creds)
+}
+
+// NewExpiringWebsocketConn is a websocket connection whose credentials expire, so it has to
+// send fresh ones before they do. creds are the credentials from the upgrade request, and
+// when they are nil the client sends them as its first frame
+func NewExpiringWebsocketConn(conn WebsocketConn, auth ExpiringAuth, creds map[string]string) *Conn {
+	return &Conn{
 		conn:      conn,
 		leave:     make(chan struct{}, 1),
+		closing:   make(chan struct{}, 1),
+		done:      make(chan struct{}),
+		closeOnce: &sync.Once{},
 		requests:  make(chan connection.Request),
 		responses: make(chan connection.Response),
 		auth:      auth,
+		codec:     CodecFor(conn.Subprotocol()),
+		creds:     creds,
+		expiry:    newExpiry(),
 	}
-	return wsConn
+}
+
+// close hangs up the websocket and tells the manager that the client is gone
+func (conn *Conn) close() {
+	conn.closeOnce.Do(func() {
+		close(conn.done)
+		conn.conn.Close()
+		select {
+		case conn.leave <- struct{}{}:
+		default:
+		}
+		go discardResponses(conn.responses)
+	})
 }
 
 func (conn *Conn) pumpIn() {
 	conn.conn.SetReadDeadline(time.Time{})
 	for {
+		_, message, err := conn.conn.ReadMessage()
+		if err != nil {
+			conn.close()
+			return
+		}
+
 		select {
-		case <-conn.leave:
-			conn.conn.Close()
+		case conn.requests <- conn.codec.DecodeRequest(message):
+		case <-conn.done:
 			return
-		default:
-			conn.receive()
 		}
 	}
 }
@@ -126,47 +319,49 @@ func (conn *Conn) pumpIn() {
 func (conn *Conn) pumpOut() {
 	for {
 		select {
-		case <-conn.leave:
-			conn.conn.Close()
+		case <-conn.done:
+			return
+		case <-conn.closing:
+			conn.close()
 			return
 		case response := <-conn.responses:
-			conn.send(wsResponse{ResponseType: typeToString[response.Type], Data: response.Data})
+			conn.send(response)
 		}
 	}
 }
 
-func (conn *Conn) send(response wsResponse) {
-	conn.conn.SetWriteDeadline(time.Now().Add(5 * time.Second))
-	err := conn.conn.WriteJSON(&response)
+func (conn *Conn) send(response connection.Response) {
+	b, err := conn.codec.EncodeResponse(response)
 	if err != nil {
-		conn.leave <- struct{}{}
+		return
 	}
-}
 
-func (conn *Conn) receive() {
-	_, message, err := conn.conn.ReadMessage()
+	conn.conn.SetWriteDeadline(time.Now().Add(5 * time.Second))
+	err = conn.conn.WriteMessage(conn.codec.MessageType(), b)
 	if err != nil {
-		conn.leave <- struct{}{}
+		conn.close()
 	}
-	conn.requests <- wsRequestData(message)
 }
 
-// Authorize satisfies the Conn interface
+// Authorize satisfies the Conn interface. The credentials are read from the first
+// frame, unless they were taken from the upgrade request, see NewWebsocketConnWithCredentials
 func (conn *Conn) Authorize() error {
-	err := conn.conn.SetReadDeadline(time.Now().Add(10 * time.Second))
-	if err != nil {
-		conn.conn.Close()
-		return err
-	}
-	var creds map[string]string
-	_, body, err := conn.conn.ReadMessage()
-	json.Unmarshal(body, &creds)
+	creds := conn.creds
+	if creds == nil {
+		err := conn.conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+		if err != nil {
+			conn.conn.Close()
+			return err
+		}
+		_, body, err := conn.conn.ReadMessage()
+		creds = conn.codec.DecodeCredentials(body)
 
-	if err != nil {
-		conn.conn.Close()
-		return err
+		if err != nil {
+			conn.conn.Close()
+			return err
+		}
 	}
-	conversant, err := conn.auth(creds)
+	conversant, expiresAt, err := conn.auth(creds)
 
 	if err != nil {
 		conn.conn.Close()
@@ -174,12 +369,25 @@ func (conn *Conn) Authorize() error {
 	}
 
 	conn.conversant = conversant
+	conn.setExpiry(expiresAt)
 
 	go conn.pumpIn()
 	go conn.pumpOut()
 	return nil
 }
 
+// Reauthenticate satisfies the connection.Expiring interface. The credentials
+// have to be for the conversant the connection was authorized as
+func (conn *Conn) Reauthenticate(creds map[string]string) error {
+	expiresAt, err := checkReauthentication(conn.auth, conn.conversant, creds)
+	if err != nil {
+		return err
+	}
+
+	conn.setExpiry(expiresAt)
+	return nil
+}
+
 // GetConversant satisfies the Conn interface
 func (conn *Conn) GetConversant() repositories.Conversant {
 	return conn.conversant
@@ -199,3 +407,11 @@ func (conn *Conn) Response() chan connection.Response {
 func (conn *Conn) Leave() chan struct{} {
 	return conn.leave
 }
+
+// Close satisfies the Conn interface
+func (conn *Conn) Close() {
+	select {
+	case conn.closing <- struct{}{}:
+	default:
+	}
+}
@@ -1,9 +1,10 @@
 package implementations
 
 import (
-	"encoding/json"
 	"errors"
 	"reflect"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -13,11 +14,12 @@ import (
 )
 
 type testConn struct {
-	readChan  chan []byte
-	writeChan chan []byte
-	isClosed  bool
-	readErr   func() error
-	writeErr  func() error
+	readChan    chan []byte
+	writeChan   chan []byte
+	isClosed    bool
+	readErr     func() error
+	writeErr    func() error
+	subprotocol string
 }
 
 func (conn *testConn) SetReadDeadline(time.Time) error {
@@ -36,16 +38,19 @@ func (conn *testConn) ReadMessage() (int, []byte, error) {
 	return 0, read, nil
 }
 
-func (conn *testConn) WriteJSON(in interface{}) error {
+func (conn *testConn) WriteMessage(messageType int, b []byte) error {
 	if conn.writeErr() != nil {
 		return conn.writeErr()
 	}
 
-	b, _ := json.Marshal(in)
 	conn.writeChan <- b
 	return nil
 }
 
+func (conn *testConn) Subprotocol() string {
+	return conn.subprotocol
+}
+
 func (conn *testConn) Close() error {
 	conn.isClosed = true
 	return nil
@@ -71,6 +76,61 @@ var requests = []struct {
 		reqData: connection.RetrieveConversationRequest{},
 		reqType: connection.RetrieveConversation,
 	},
+	{
+		req:     []byte(`{"type": "resume"}`),
+		reqData: connection.ResumeRequest{},
+		reqType: connection.Resume,
+	},
+	{
+		req:     []byte(`{"type": "listConversations"}`),
+		reqData: connection.ListConversationsRequest{},
+		reqType: connection.ListConversations,
+	},
+	{
+		req:     []byte(`{"type": "addConversants"}`),
+		reqData: connection.AddConversantsRequest{},
+		reqType: connection.AddConversants,
+	},
+	{
+		req:     []byte(`{"type": "removeConversants"}`),
+		reqData: connection.RemoveConversantsRequest{},
+		reqType: connection.RemoveConversants,
+	},
+	{
+		req:     []byte(`{"type": "leaveConversation"}`),
+		reqData: connection.LeaveConversationRequest{},
+		reqType: connection.LeaveConversation,
+	},
+	{
+		req:     []byte(`{"type": "reauthenticate"}`),
+		reqData: connection.ReauthenticateRequest{},
+		reqType: connection.Reauthenticate,
+	},
+	{
+		req:     []byte(`{"type": "setRole"}`),
+		reqData: connection.SetRoleRequest{},
+		reqType: connection.SetRole,
+	},
+	{
+		req:     []byte(`{"type": "renameConversation"}`),
+		reqData: connection.RenameConversationRequest{},
+		reqType: connection.RenameConversation,
+	},
+	{
+		req:     []byte(`{"type": "deleteConversation"}`),
+		reqData: connection.DeleteConversationRequest{},
+		reqType: connection.DeleteConversation,
+	},
+	{
+		req:     []byte(`{"type": "block"}`),
+		reqData: connection.BlockRequest{},
+		reqType: connection.Block,
+	},
+	{
+		req:     []byte(`{"type": "unblock"}`),
+		reqData: connection.UnblockRequest{},
+		reqType: connection.Unblock,
+	},
 	{
 		req:     []byte(`{"type": "asdfasdfasdf"}`),
 		reqData: nil,
@@ -94,6 +154,26 @@ var responses = []struct {
 		respType: connection.ReturnConversation,
 		resp:     []byte(`{"type":"returnConversation","data":null}`),
 	},
+	{
+		respType: connection.ConversationList,
+		resp:     []byte(`{"type":"conversationList","data":null}`),
+	},
+	{
+		respType: connection.ConversationUpdated,
+		resp:     []byte(`{"type":"conversationUpdated","data":null}`),
+	},
+	{
+		respType: connection.AuthExpiring,
+		resp:     []byte(`{"type":"authExpiring","data":null}`),
+	},
+	{
+		respType: connection.ConversationDeleted,
+		resp:     []byte(`{"type":"conversationDeleted","data":null}`),
+	},
+	{
+		respType: connection.BlockUpdated,
+		resp:     []byte(`{"type":"blockUpdated","data":null}`),
+	},
 	{
 		respType: connection.Error,
 		resp:     []byte(`{"type":"error","data":null}`),
@@ -111,8 +191,11 @@ func TestConn_Requests(t *testing.T) {
 				return nil
 			},
 		},
-		leave:    make(chan struct{}, 1),
-		requests: requestChan,
+		leave:     make(chan struct{}, 1),
+		done:      make(chan struct{}),
+		closeOnce: &sync.Once{},
+		requests:  requestChan,
+		codec:     CodecFor(""),
 	}
 
 	go conn.pumpIn()
@@ -141,7 +224,7 @@ func TestConn_Requests(t *testing.T) {
 		}
 	}
 
-	conn.Leave() <- struct{}{}
+	conn.close()
 }
 
 func TestConn_Responses(t *testing.T) {
@@ -156,7 +239,10 @@ func TestConn_Responses(t *testing.T) {
 			},
 		},
 		leave:     make(chan struct{}, 1),
+		done:      make(chan struct{}),
+		closeOnce: &sync.Once{},
 		responses: responseChan,
+		codec:     CodecFor(""),
 	}
 
 	go conn.pumpOut()
@@ -171,7 +257,7 @@ func TestConn_Responses(t *testing.T) {
 		}
 	}
 
-	conn.Leave() <- struct{}{}
+	conn.close()
 }
 
 func TestConn_Authorize(t *testing.T) {
@@ -217,6 +303,83 @@ func TestConn_GetConversant(t *testing.T) {
 	}
 }
 
+func TestConn_AuthorizeWithCredentials(t *testing.T) {
+	testConn := &testConn{
+		readChan: make(chan []byte),
+		readErr: func() error {
+			return nil
+		},
+	}
+
+	conn := NewWebsocketConnWithCredentials(testConn, func(creds map[string]string) (repositories.Conversant, error) {
+		return repositories.Conversant{ID: creds["access_token"]}, nil
+	}, map[string]string{"access_token": "testID"})
+
+	// Authorize would block reading a credentials frame that never comes if it didn't use the upgrade's
+	if err := conn.Authorize(); err != nil {
+		t.Fatal(err)
+	}
+
+	if conn.GetConversant().ID != "testID" {
+		t.Fatalf("expected that %s would be testID", conn.GetConversant().ID)
+	}
+}
+
+// expiringTestAuth is testAuth with credentials that expire at expiry
+func expiringTestAuth(expiry *time.Time) ExpiringAuth {
+	return func(creds map[string]string) (repositories.Conversant, time.Time, error) {
+		if creds["id"] == "" {
+			return repositories.Conversant{}, time.Time{}, errors.New("no id")
+		}
+		return repositories.Conversant{ID: creds["id"]}, *expiry, nil
+	}
+}
+
+// testReauthenticate checks that conn, authorized as testID with credentials that expire
+// at expiry, only accepts fresh credentials for testID, and takes their expiry
+func testReauthenticate(t *testing.T, conn connection.Expiring, expiry *time.Time) {
+	t.Helper()
+
+	if !conn.Expiry().Equal(*expiry) {
+		t.Fatalf("expected expiry %v, received %v", *expiry, conn.Expiry())
+	}
+
+	*expiry = expiry.Add(time.Hour)
+	if err := conn.Reauthenticate(map[string]string{"id": "otherID"}); err == nil {
+		t.Fatal("expected credentials for another conversant to be rejected")
+	}
+
+	if err := conn.Reauthenticate(map[string]string{}); err == nil {
+		t.Fatal("expected bad credentials to be rejected")
+	}
+
+	if err := conn.Reauthenticate(map[string]string{"id": "testID"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if !conn.Expiry().Equal(*expiry) {
+		t.Fatalf("expected reauthenticating to move the expiry to %v, received %v", *expiry, conn.Expiry())
+	}
+}
+
+func TestConn_Reauthenticate(t *testing.T) {
+	expiry := time.Now().Add(time.Minute)
+
+	testConn := &testConn{
+		readChan: make(chan []byte),
+		readErr: func() error {
+			return nil
+		},
+	}
+
+	conn := NewExpiringWebsocketConn(testConn, expiringTestAuth(&expiry), map[string]string{"id": "testID"})
+	if err := conn.Authorize(); err != nil {
+		t.Fatal(err)
+	}
+
+	testReauthenticate(t, conn, &expiry)
+}
+
 func TestConn_LeaveWriteErr(t *testing.T) {
 	responseChan := make(chan connection.Response)
 
@@ -230,6 +393,9 @@ func TestConn_LeaveWriteErr(t *testing.T) {
 		conn:      testConn,
 		responses: responseChan,
 		leave:     make(chan struct{}, 1),
+		done:      make(chan struct{}),
+		closeOnce: &sync.Once{},
+		codec:     CodecFor(""),
 	}
 
 	go conn.pumpOut()
@@ -253,8 +419,11 @@ func TestConn_LeaveReadErr(t *testing.T) {
 	}
 
 	conn := Conn{
-		conn:  testConn,
-		leave: make(chan struct{}, 1),
+		conn:      testConn,
+		leave:     make(chan struct{}, 1),
+		done:      make(chan struct{}),
+		closeOnce: &sync.Once{},
+		codec:     CodecFor(""),
 	}
 
 	go conn.pumpIn()
@@ -267,3 +436,58 @@ func TestConn_LeaveReadErr(t *testing.T) {
 		t.Fatalf("didn't close")
 	}
 }
+
+func TestConn_RequestID(t *testing.T) {
+	req := wsRequestData([]byte(`{"type": "sendMessage", "requestId": "test"}`))
+
+	if req.RequestID != "test" {
+		t.Fatalf("expected request id test, received %s", req.RequestID)
+	}
+
+	b, _ := CodecFor("").EncodeResponse(connection.NewResponseError("test", "err"))
+	expected := `{"type":"error","data":{"error":"err"},"requestId":"test"}`
+
+	if string(b) != expected {
+		t.Fatalf("expected %s, received %s", expected, string(b))
+	}
+}
+
+func TestConn_Close(t *testing.T) {
+	readChan := make(chan []byte, 1)
+	writeChan := make(chan []byte, 1)
+
+	testConn := &testConn{
+		readChan:  readChan,
+		writeChan: writeChan,
+		readErr: func() error {
+			return nil
+		},
+		writeErr: func() error {
+			return nil
+		},
+	}
+
+	conn := NewWebsocketConn(testConn, testAuth)
+	readChan <- []byte(`{"id": "testID"}`)
+	if err := conn.Authorize(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the response sent before closing is written before the websocket is hung up
+	conn.Response() <- connection.NewAuthExpiredError()
+	conn.Close()
+
+	if b := <-writeChan; !strings.Contains(string(b), `"type":"error"`) {
+		t.Fatalf("expected an error response, received %s", b)
+	}
+
+	select {
+	case <-conn.Leave():
+	case <-time.After(time.Second):
+		t.Fatal("didn't leave")
+	}
+
+	if !testConn.isClosed {
+		t.Fatal("should be closed")
+	}
+}
@@ -0,0 +1,309 @@
+// Package jwtauth authenticates connections with JSON Web Tokens. Tokens are taken
+// from the credentials a connection sends, or from the HTTP request it was opened
+// with, and their claims are mapped to a repositories.Conversant
+package jwtauth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/json"
+	"math"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/ryan-berger/chatty/repositories"
+)
+
+var (
+	// ErrNoToken is returned when there is no token in the credentials
+	ErrNoToken = errors.New("no token")
+	// ErrInvalidToken is returned for tokens that are malformed or aren't signed by a known key
+	ErrInvalidToken = errors.New("invalid token")
+	// ErrExpired is returned for tokens past their exp claim
+	ErrExpired = errors.New("token expired")
+)
+
+// Claims are a token's claims
+type Claims map[string]interface{}
+
+// String returns a string claim, or an empty string if it is missing or not a string
+func (claims Claims) String(name string) string {
+	value, _ := claims[name].(string)
+	return value
+}
+
+// Time returns a NumericDate claim, and whether it was set
+func (claims Claims) Time(name string) (time.Time, bool) {
+	value, ok := claims[name].(json.Number)
+	if !ok {
+		return time.Time{}, false
+	}
+
+	seconds, err := value.Float64()
+	if err != nil {
+		return time.Time{}, false
+	}
+	whole := math.Floor(seconds)
+	return time.Unix(int64(whole), int64((seconds-whole)*float64(time.Second))), true
+}
+
+// Audience returns the aud claim, which can be a string or a list of them
+func (claims Claims) Audience() []string {
+	switch aud := claims["aud"].(type) {
+	case string:
+		return []string{aud}
+	case []interface{}:
+		var audience []string
+		for _, value := range aud {
+			if s, ok := value.(string); ok {
+				audience = append(audience, s)
+			}
+		}
+		return audience
+	}
+	return nil
+}
+
+// Config configures an Authenticator. Audience and Issuer are only checked when
+// they are set. ClockSkew is how far exp and nbf can be off by to allow for clocks
+// that don't agree. Conversant maps a token's claims to the conversant it's for,
+// and defaults to DefaultConversant
+type Config struct {
+	Keys       []Key
+	Audience   string
+	Issuer     string
+	ClockSkew  time.Duration
+	Conversant func(Claims) (repositories.Conversant, error)
+}
+
+// Authenticator verifies tokens. It is safe for concurrent use
+type Authenticator struct {
+	keysMu     *sync.RWMutex
+	keys       []Key
+	audience   string
+	issuer     string
+	clockSkew  time.Duration
+	conversant func(Claims) (repositories.Conversant, error)
+	now        func() time.Time
+}
+
+// New creates an Authenticator
+func New(config Config) *Authenticator {
+	conversant := config.Conversant
+	if conversant == nil {
+		conversant = DefaultConversant
+	}
+
+	return &Authenticator{
+		keysMu:     &sync.RWMutex{},
+		keys:       config.Keys,
+		audience:   config.Audience,
+		issuer:     config.Issuer,
+		clockSkew:  config.ClockSkew,
+		conversant: conversant,
+		now:        time.Now,
+	}
+}
+
+// DefaultConversant uses the sub claim as the conversant's ID, and
+// the name claim, or failing that preferred_username, as their display name
+func DefaultConversant(claims Claims) (repositories.Conversant, error) {
+	id := claims.String("sub")
+	if id == "" {
+		return repositories.Conversant{}, errors.New("token has no sub")
+	}
+
+	name := claims.String("name")
+	if name == "" {
+		name = claims.String("preferred_username")
+	}
+
+	return repositories.Conversant{ID: id, DisplayName: name}, nil
+}
+
+// SetKeys replaces the keys tokens are verified with, for rotating keys without a restart
+func (auth *Authenticator) SetKeys(keys []Key) {
+	auth.keysMu.Lock()
+	auth.keys = keys
+	auth.keysMu.Unlock()
+}
+
+// Auth authenticates a connection's credentials. The token is read from access_token, or token,
+// so it can be used as the Auth for any of the connections in connection/implementations
+func (auth *Authenticator) Auth(creds map[string]string) (repositories.Conversant, error) {
+	conversant, _, err := auth.ExpiringAuth(creds)
+	return conversant, err
+}
+
+// ExpiringAuth is Auth that also returns when the token expires, for connections that
+// can be reauthenticated. The expiry has ClockSkew added, so it is when Verify stops accepting it
+func (auth *Authenticator) ExpiringAuth(creds map[string]string) (repositories.Conversant, time.Time, error) {
+	token := creds["access_token"]
+	if token == "" {
+		token = creds["token"]
+	}
+
+	if token == "" {
+		return repositories.Conversant{}, time.Time{}, ErrNoToken
+	}
+
+	claims, err := auth.Verify(token)
+	if err != nil {
+		return repositories.Conversant{}, time.Time{}, err
+	}
+
+	conversant, err := auth.conversant(claims)
+	if err != nil {
+		return repositories.Conversant{}, time.Time{}, err
+	}
+
+	// Verify makes sure there is an exp
+	expires, _ := claims.Time("exp")
+	return conversant, expires.Add(auth.clockSkew), nil
+}
+
+// RequestCredentials gets credentials from the HTTP request a connection is opened with, such as a
+// websocket upgrade. The token is taken from a bearer Authorization header, or the access_token
+// or token query parameters. It returns nil when the request has no token
+func RequestCredentials(request *http.Request) map[string]string {
+	if creds := BearerCredentials(request.Header.Get("Authorization")); creds != nil {
+		return creds
+	}
+
+	query := request.URL.Query()
+	for _, name := range []string{"access_token", "token"} {
+		if token := query.Get(name); token != "" {
+			return map[string]string{"access_token": token}
+		}
+	}
+
+	return nil
+}
+
+// BearerCredentials gets credentials from a bearer Authorization header, or the authorization
+// metadata of a gRPC call. It returns nil when the header isn't a bearer token
+func BearerCredentials(header string) map[string]string {
+	if len(header) > len("Bearer ") && strings.EqualFold(header[:len("Bearer ")], "Bearer ") {
+		return map[string]string{"access_token": strings.TrimSpace(header[len("Bearer "):])}
+	}
+	return nil
+}
+
+// Verify checks the token's signature and its exp, nbf, aud and iss claims, and returns its claims
+func (auth *Authenticator) Verify(token string) (Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrInvalidToken
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeJSON(parts[0], &header); err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	signature, err := decodeSegment(parts[2])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	if !auth.verifySignature(header.Alg, header.Kid, parts[0]+"."+parts[1], signature) {
+		return nil, ErrInvalidToken
+	}
+
+	var claims Claims
+	if err = decodeJSON(parts[1], &claims); err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	if err = auth.checkClaims(claims); err != nil {
+		return nil, err
+	}
+
+	return claims, nil
+}
+
+// verifySignature tries every key for the token's algorithm, or just the one
+// matching kid when the token has one. Unknown algorithms, including none, never verify
+func (auth *Authenticator) verifySignature(algorithm, kid, signed string, signature []byte) bool {
+	auth.keysMu.RLock()
+	defer auth.keysMu.RUnlock()
+
+	for _, key := range auth.keys {
+		if key.Algorithm != algorithm || (kid != "" && key.ID != kid) {
+			continue
+		}
+
+		if key.verify([]byte(signed), signature) {
+			return true
+		}
+	}
+	return false
+}
+
+func (key Key) verify(signed, signature []byte) bool {
+	switch key.Algorithm {
+	case HS256:
+		mac := hmac.New(sha256.New, key.key.([]byte))
+		mac.Write(signed)
+		return hmac.Equal(mac.Sum(nil), signature)
+	case RS256:
+		hash := sha256.Sum256(signed)
+		return rsa.VerifyPKCS1v15(key.key.(*rsa.PublicKey), crypto.SHA256, hash[:], signature) == nil
+	case EdDSA:
+		return ed25519.Verify(key.key.(ed25519.PublicKey), signed, signature)
+	}
+	return false
+}
+
+func (auth *Authenticator) checkClaims(claims Claims) error {
+	now := auth.now()
+
+	expires, ok := claims.Time("exp")
+	if !ok {
+		return errors.New("token has no exp")
+	}
+	if !now.Before(expires.Add(auth.clockSkew)) {
+		return ErrExpired
+	}
+
+	if notBefore, ok := claims.Time("nbf"); ok && now.Add(auth.clockSkew).Before(notBefore) {
+		return errors.New("token not valid yet")
+	}
+
+	if auth.issuer != "" && claims.String("iss") != auth.issuer {
+		return errors.New("token has the wrong issuer")
+	}
+
+	if auth.audience != "" {
+		for _, audience := range claims.Audience() {
+			if audience == auth.audience {
+				return nil
+			}
+		}
+		return errors.New("token has the wrong audience")
+	}
+
+	return nil
+}
+
+// decodeJSON decodes a base64url JSON segment, keeping numbers as json.Number so NumericDates aren't rounded
+func decodeJSON(segment string, v interface{}) error {
+	data, err := decodeSegment(segment)
+	if err != nil {
+		return err
+	}
+
+	decoder := json.NewDecoder(strings.NewReader(string(data)))
+	decoder.UseNumber()
+	return decoder.Decode(v)
+}
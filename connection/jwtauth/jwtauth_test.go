@@ -0,0 +1,260 @@
+package jwtauth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+var now = time.Unix(1553600000, 0)
+
+func encodeSegment(v interface{}) string {
+	data, _ := json.Marshal(v)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// sign makes a token, signing it with key, which is an HMAC secret, an *rsa.PrivateKey or an ed25519.PrivateKey
+func sign(t *testing.T, alg, kid string, claims map[string]interface{}, key interface{}) string {
+	header := map[string]string{"alg": alg, "typ": "JWT"}
+	if kid != "" {
+		header["kid"] = kid
+	}
+
+	signed := encodeSegment(header) + "." + encodeSegment(claims)
+
+	var signature []byte
+	switch k := key.(type) {
+	case []byte:
+		mac := hmac.New(sha256.New, k)
+		mac.Write([]byte(signed))
+		signature = mac.Sum(nil)
+	case *rsa.PrivateKey:
+		hash := sha256.Sum256([]byte(signed))
+		var err error
+		signature, err = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, hash[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+	case ed25519.PrivateKey:
+		signature = ed25519.Sign(k, []byte(signed))
+	}
+
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func claims(overrides map[string]interface{}) map[string]interface{} {
+	claims := map[string]interface{}{
+		"sub":  "d8ece527-a0e9-4513-8972-5a7b0f97785d",
+		"name": "alice",
+		"exp":  now.Add(time.Hour).Unix(),
+		"iss":  "chatty",
+		"aud":  []string{"other", "chat"},
+	}
+	for name, value := range overrides {
+		if value == nil {
+			delete(claims, name)
+			continue
+		}
+		claims[name] = value
+	}
+	return claims
+}
+
+func newTestAuthenticator(keys ...Key) *Authenticator {
+	auth := New(Config{Keys: keys, Audience: "chat", Issuer: "chatty", ClockSkew: time.Minute})
+	auth.now = func() time.Time {
+		return now
+	}
+	return auth
+}
+
+func TestAuthenticator_Algorithms(t *testing.T) {
+	secret := []byte("secret")
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edPublic, edPrivate, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	auth := newTestAuthenticator(HMACKey("hmac", secret), RSAKey("rsa", &rsaKey.PublicKey), Ed25519Key("ed", edPublic))
+
+	tokens := map[string]string{
+		HS256: sign(t, HS256, "hmac", claims(nil), secret),
+		RS256: sign(t, RS256, "rsa", claims(nil), rsaKey),
+		EdDSA: sign(t, EdDSA, "", claims(nil), edPrivate),
+	}
+
+	for alg, token := range tokens {
+		conversant, err := auth.Auth(map[string]string{"token": token})
+		if err != nil {
+			t.Fatalf("%s: %v", alg, err)
+		}
+
+		if conversant.ID != "d8ece527-a0e9-4513-8972-5a7b0f97785d" || conversant.DisplayName != "alice" {
+			t.Fatalf("%s: claims mapped incorrectly: %+v", alg, conversant)
+		}
+	}
+
+	rejected := map[string]string{
+		"wrong secret": sign(t, HS256, "", claims(nil), []byte("wrong")),
+		"wrong kid":    sign(t, RS256, "hmac", claims(nil), rsaKey),
+		"none":         encodeSegment(map[string]string{"alg": "none"}) + "." + encodeSegment(claims(nil)) + ".",
+		// an RSA public key must never be usable as an HMAC secret
+		"confused": sign(t, HS256, "rsa", claims(nil), rsaKey.PublicKey.N.Bytes()),
+		"garbage":  "not.a.token",
+	}
+
+	for name, token := range rejected {
+		if _, err := auth.Verify(token); err != ErrInvalidToken {
+			t.Fatalf("%s: expected ErrInvalidToken, received %v", name, err)
+		}
+	}
+}
+
+func TestAuthenticator_Claims(t *testing.T) {
+	secret := []byte("secret")
+	auth := newTestAuthenticator(HMACKey("", secret))
+
+	tests := []struct {
+		name   string
+		claims map[string]interface{}
+		valid  bool
+	}{
+		{"valid", claims(nil), true},
+		{"expired", claims(map[string]interface{}{"exp": now.Add(-2 * time.Minute).Unix()}), false},
+		{"expired within skew", claims(map[string]interface{}{"exp": now.Add(-30 * time.Second).Unix()}), true},
+		{"no exp", claims(map[string]interface{}{"exp": nil}), false},
+		{"not yet valid", claims(map[string]interface{}{"nbf": now.Add(2 * time.Minute).Unix()}), false},
+		{"not yet valid within skew", claims(map[string]interface{}{"nbf": now.Add(30 * time.Second).Unix()}), true},
+		{"single audience", claims(map[string]interface{}{"aud": "chat"}), true},
+		{"wrong audience", claims(map[string]interface{}{"aud": "other"}), false},
+		{"no audience", claims(map[string]interface{}{"aud": nil}), false},
+		{"wrong issuer", claims(map[string]interface{}{"iss": "other"}), false},
+	}
+
+	for _, test := range tests {
+		_, err := auth.Verify(sign(t, HS256, "", test.claims, secret))
+		if (err == nil) != test.valid {
+			t.Fatalf("%s: expected valid to be %v, received %v", test.name, test.valid, err)
+		}
+	}
+
+	if _, err := auth.Auth(map[string]string{"token": sign(t, HS256, "", claims(map[string]interface{}{"sub": nil}), secret)}); err == nil {
+		t.Fatal("expected a token without sub to be rejected")
+	}
+
+	_, expiry, err := auth.ExpiringAuth(map[string]string{"access_token": sign(t, HS256, "", claims(nil), secret)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := now.Add(time.Hour + time.Minute); !expiry.Equal(expected) {
+		t.Fatalf("expected the expiry to be exp plus the clock skew, %v, received %v", expected, expiry)
+	}
+
+	if _, err := auth.Auth(map[string]string{}); err != ErrNoToken {
+		t.Fatalf("expected ErrNoToken, received %v", err)
+	}
+}
+
+func TestAuthenticator_SetKeys(t *testing.T) {
+	auth := newTestAuthenticator(HMACKey("", []byte("old")))
+	token := sign(t, HS256, "", claims(nil), []byte("new"))
+
+	if _, err := auth.Verify(token); err == nil {
+		t.Fatal("expected the new key to be unknown")
+	}
+
+	auth.SetKeys([]Key{HMACKey("", []byte("new"))})
+	if _, err := auth.Verify(token); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestParseJWKS(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edPublic, edPrivate, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b64 := base64.RawURLEncoding.EncodeToString
+	jwks := fmt.Sprintf(`{"keys": [
+		{"kty": "oct", "kid": "hmac", "alg": "HS256", "k": %q},
+		{"kty": "RSA", "kid": "rsa", "use": "sig", "n": %q, "e": %q},
+		{"kty": "OKP", "kid": "ed", "crv": "Ed25519", "x": %q},
+		{"kty": "RSA", "kid": "enc", "use": "enc", "n": "AQAB", "e": "AQAB"}
+	]}`, b64([]byte("secret")), b64(rsaKey.N.Bytes()), b64(big.NewInt(int64(rsaKey.E)).Bytes()), b64(edPublic))
+
+	keys, err := ParseJWKS([]byte(jwks))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(keys) != 3 {
+		t.Fatalf("expected the encryption key to be skipped, received %d keys", len(keys))
+	}
+
+	auth := newTestAuthenticator(keys...)
+	for _, token := range []string{
+		sign(t, HS256, "hmac", claims(nil), []byte("secret")),
+		sign(t, RS256, "rsa", claims(nil), rsaKey),
+		sign(t, EdDSA, "ed", claims(nil), edPrivate),
+	} {
+		if _, err := auth.Verify(token); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err = ParseJWKS([]byte(`{"keys": [{"kty": "RSA", "alg": "HS256", "n": "AQAB", "e": "AQAB"}]}`)); err == nil {
+		t.Fatal("expected an RSA key for HS256 to be rejected")
+	}
+
+	if _, err = ParseJWKS([]byte(`{"keys": [{"kty": "EC", "crv": "P-256"}]}`)); err == nil {
+		t.Fatal("expected an unsupported key type to be rejected")
+	}
+}
+
+func TestRequestCredentials(t *testing.T) {
+	request := httptest.NewRequest("GET", "/ws?access_token=query", nil)
+	if creds := RequestCredentials(request); creds["access_token"] != "query" {
+		t.Fatalf("expected the query token, received %v", creds)
+	}
+
+	request.Header.Set("Authorization", "Bearer header")
+	if creds := RequestCredentials(request); creds["access_token"] != "header" {
+		t.Fatalf("expected the header to win over the query, received %v", creds)
+	}
+
+	if creds := RequestCredentials(httptest.NewRequest("GET", "/ws", nil)); creds != nil {
+		t.Fatalf("expected no credentials, received %v", creds)
+	}
+}
+
+func TestBearerCredentials(t *testing.T) {
+	if creds := BearerCredentials("bearer token"); creds["access_token"] != "token" {
+		t.Fatalf("expected the token, received %v", creds)
+	}
+
+	for _, header := range []string{"", "Bearer ", "Basic token"} {
+		if creds := BearerCredentials(header); creds != nil {
+			t.Fatalf("expected no credentials for %q, received %v", header, creds)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package jwtauth
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+// The algorithms tokens can be signed with
+const (
+	HS256 = "HS256"
+	RS256 = "RS256"
+	EdDSA = "EdDSA"
+)
+
+// Key is a key tokens can be verified with. Each key only verifies tokens
+// signed with its own algorithm, so an RSA public key can't be used as an
+// HMAC secret. ID is matched against the kid in the token's header
+type Key struct {
+	ID        string
+	Algorithm string
+	key       interface{}
+}
+
+// HMACKey creates an HS256 key from a shared secret
+func HMACKey(id string, secret []byte) Key {
+	return Key{ID: id, Algorithm: HS256, key: secret}
+}
+
+// RSAKey creates an RS256 key
+func RSAKey(id string, key *rsa.PublicKey) Key {
+	return Key{ID: id, Algorithm: RS256, key: key}
+}
+
+// Ed25519Key creates an EdDSA key
+func Ed25519Key(id string, key ed25519.PublicKey) Key {
+	return Key{ID: id, Algorithm: EdDSA, key: key}
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	Crv string `json:"crv"`
+	K   string `json:"k"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+}
+
+// LoadJWKS reads a JSON Web Key Set file
+func LoadJWKS(path string) ([]Key, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseJWKS(data)
+}
+
+// ParseJWKS parses a JSON Web Key Set. oct, RSA and Ed25519 OKP keys are supported,
+// and keys that are only for encryption are skipped
+func ParseJWKS(data []byte) ([]Key, error) {
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, errors.Wrap(err, "err: parsing JWKS")
+	}
+
+	var keys []Key
+	for i, raw := range set.Keys {
+		if raw.Use == "enc" {
+			continue
+		}
+
+		key, err := raw.key()
+		if err != nil {
+			return nil, errors.Wrapf(err, "err: parsing JWKS key %d", i)
+		}
+
+		if raw.Alg != "" && raw.Alg != key.Algorithm {
+			return nil, errors.Errorf("JWKS key %d is %s, but a %s key can only be used for %s", i, raw.Alg, raw.Kty, key.Algorithm)
+		}
+		keys = append(keys, key)
+	}
+
+	if len(keys) == 0 {
+		return nil, errors.New("JWKS has no signing keys")
+	}
+	return keys, nil
+}
+
+func (raw jwk) key() (Key, error) {
+	switch raw.Kty {
+	case "oct":
+		secret, err := decodeSegment(raw.K)
+		if err != nil {
+			return Key{}, err
+		}
+		return HMACKey(raw.Kid, secret), nil
+	case "RSA":
+		n, err := decodeSegment(raw.N)
+		if err != nil {
+			return Key{}, err
+		}
+		e, err := decodeSegment(raw.E)
+		if err != nil {
+			return Key{}, err
+		}
+
+		exponent := new(big.Int).SetBytes(e)
+		if !exponent.IsInt64() || exponent.Int64() > 1<<31-1 {
+			return Key{}, errors.New("RSA exponent is too large")
+		}
+		return RSAKey(raw.Kid, &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}), nil
+	case "OKP":
+		if raw.Crv != "Ed25519" {
+			return Key{}, errors.Errorf("unsupported OKP curve %q", raw.Crv)
+		}
+		x, err := decodeSegment(raw.X)
+		if err != nil {
+			return Key{}, err
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return Key{}, errors.New("Ed25519 key is the wrong size")
+		}
+		return Ed25519Key(raw.Kid, ed25519.PublicKey(x)), nil
+	default:
+		return Key{}, errors.Errorf("unsupported key type %q", raw.Kty)
+	}
+}
+
+// decodeSegment decodes unpadded base64url, the way every part of a JWT and JWK is encoded
+func decodeSegment(segment string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(segment)
+}
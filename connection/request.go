@@ -5,6 +5,7 @@ import (
 
 	"github.com/go-ozzo/ozzo-validation"
 	"github.com/go-ozzo/ozzo-validation/is"
+	"github.com/ryan-berger/chatty/repositories"
 )
 
 type RequestType int
@@ -14,15 +15,28 @@ const (
 	SendMessage RequestType = iota
 	CreateConversation
 	RetrieveConversation
+	Resume
+	ListConversations
+	AddConversants
+	RemoveConversants
+	LeaveConversation
+	Reauthenticate
+	SetRole
+	RenameConversation
+	DeleteConversation
+	Block
+	Unblock
 	RequestError
 )
 
 type (
 	// Request is a struct with a dynamic body, with a specific type
-	// that allows the MUX to figure out how to cast the body
+	// that allows the MUX to figure out how to cast the body. RequestID
+	// is optional, and is echoed on every response to the request
 	Request struct {
-		Type RequestType `json:"type"`
-		Data interface{} `json:"data"`
+		Type      RequestType `json:"type"`
+		RequestID string      `json:"requestId"`
+		Data      interface{} `json:"data"`
 	}
 
 	// CreateConversationRequest takes in a name and list of extra users
@@ -35,19 +49,110 @@ type (
 	}
 
 	// SendMessageRequest takes the message and conversation
-	// ID and sends the given message to the conversation
+	// ID and sends the given message to the conversation. IdempotencyKey
+	// is optional, and resending with the same key returns the original
+	// message instead of sending it again
 	SendMessageRequest struct {
 		SenderID       string `json:"-"`
 		Message        string `json:"message"`
 		ConversationID string `json:"conversationId"`
+		IdempotencyKey string `json:"idempotencyKey"`
 	}
 
-	// RetrieveConversationRequest uses a limit offset pattern in order to return
-	// chats from a conversation
+	// RetrieveConversationRequest returns up to Limit chats from a conversation, newest
+	// first. Pages are picked either with Offset, or with the Before or After cursors
+	// from a previous ReturnConversationResponse. Only one of them may be set, and
+	// Limit may be at most 100
 	RetrieveConversationRequest struct {
+		SenderID       string `json:"-"`
 		ConversationID string `json:"conversationId"`
 		Limit          int    `json:"limit"`
 		Offset         int    `json:"offset"`
+		Before         int64  `json:"before"`
+		After          int64  `json:"after"`
+	}
+
+	// ListConversationsRequest pages through the sender's conversations,
+	// most recently active first. SenderID is for internal use only
+	ListConversationsRequest struct {
+		SenderID string `json:"-"`
+		Limit    int    `json:"limit"`
+		Offset   int    `json:"offset"`
+	}
+
+	// AddConversantsRequest adds conversants to an existing group conversation.
+	// SenderID is for internal use only
+	AddConversantsRequest struct {
+		SenderID       string   `json:"-"`
+		ConversationID string   `json:"conversationId"`
+		Conversants    []string `json:"conversants"`
+	}
+
+	// RemoveConversantsRequest removes conversants from a group conversation.
+	// Use LeaveConversationRequest to remove yourself
+	RemoveConversantsRequest struct {
+		SenderID       string   `json:"-"`
+		ConversationID string   `json:"conversationId"`
+		Conversants    []string `json:"conversants"`
+	}
+
+	// LeaveConversationRequest removes the sender from a group conversation
+	LeaveConversationRequest struct {
+		SenderID       string `json:"-"`
+		ConversationID string `json:"conversationId"`
+	}
+
+	// SetRoleRequest changes a conversant's role in a group conversation. Making
+	// someone the owner hands the conversation over to them, and the sender
+	// becomes an admin
+	SetRoleRequest struct {
+		SenderID       string            `json:"-"`
+		ConversationID string            `json:"conversationId"`
+		ConversantID   string            `json:"conversantId"`
+		Role           repositories.Role `json:"role"`
+	}
+
+	// RenameConversationRequest renames a group conversation
+	RenameConversationRequest struct {
+		SenderID       string `json:"-"`
+		ConversationID string `json:"conversationId"`
+		Name           string `json:"name"`
+	}
+
+	// DeleteConversationRequest deletes a group conversation and all of its messages
+	DeleteConversationRequest struct {
+		SenderID       string `json:"-"`
+		ConversationID string `json:"conversationId"`
+	}
+
+	// BlockRequest blocks a conversant, so the sender no longer receives their messages
+	// or can be in a direct conversation with them. With Mute, their messages are still
+	// received, but never pushed as notifications
+	BlockRequest struct {
+		SenderID     string `json:"-"`
+		ConversantID string `json:"conversantId"`
+		Mute         bool   `json:"mute"`
+	}
+
+	// UnblockRequest removes the sender's block or mute on a conversant
+	UnblockRequest struct {
+		SenderID     string `json:"-"`
+		ConversantID string `json:"conversantId"`
+	}
+
+	// ReauthenticateRequest carries fresh credentials for a connection whose
+	// credentials are about to expire, in the same shape as the ones it opened with
+	ReauthenticateRequest struct {
+		Credentials map[string]string `json:"credentials"`
+	}
+
+	// ResumeRequest maps conversation IDs to the sequence of the last
+	// message the client has seen, and replays every message after it.
+	// Live messages in those conversations are held until they've been
+	// replayed. Ones delivered before the request was handled can be replayed
+	// again, so clients should resume first and skip sequences they've seen
+	ResumeRequest struct {
+		Cursors map[string]int64 `json:"cursors"`
 	}
 )
 
@@ -76,12 +181,108 @@ func (request SendMessageRequest) Validate() error {
 	return validation.ValidateStruct(&request,
 		validation.Field(&request.Message, validation.Required),
 		validation.Field(&request.ConversationID, is.UUIDv4),
-		validation.Field(&request.ConversationID, validation.Required, is.UUIDv4))
+		validation.Field(&request.ConversationID, validation.Required, is.UUIDv4),
+		validation.Field(&request.IdempotencyKey, validation.Length(0, 255)))
 }
 
 func (request RetrieveConversationRequest) Validate() error {
 	return validation.ValidateStruct(&request,
 		validation.Field(&request.ConversationID, validation.Required, is.UUIDv4),
-		validation.Field(&request.Limit, validation.Required, validation.Min(1)),
-		validation.Field(&request.Offset, validation.Required, validation.Min(0)))
+		validation.Field(&request.Limit, validation.Required, validation.Min(1), validation.Max(100)),
+		validation.Field(&request.Offset, validation.Min(0), validation.By(request.onePageSelector)),
+		validation.Field(&request.Before, validation.Min(int64(0))),
+		validation.Field(&request.After, validation.Min(int64(0))))
+}
+
+func (request RetrieveConversationRequest) onePageSelector(interface{}) error {
+	set := 0
+	for _, selected := range []bool{request.Offset != 0, request.Before != 0, request.After != 0} {
+		if selected {
+			set++
+		}
+	}
+
+	if set > 1 {
+		return errors.New("only one of offset, before and after may be set")
+	}
+	return nil
+}
+
+func (request ListConversationsRequest) Validate() error {
+	return validation.ValidateStruct(&request,
+		validation.Field(&request.Limit, validation.Required, validation.Min(1), validation.Max(100)),
+		validation.Field(&request.Offset, validation.Min(0)))
+}
+
+func (request AddConversantsRequest) Validate() error {
+	return validation.ValidateStruct(&request,
+		validation.Field(&request.ConversationID, validation.Required, is.UUIDv4),
+		validation.Field(&request.Conversants, validation.Required, validation.Length(1, 20), validation.By(UUIDList)))
+}
+
+func (request RemoveConversantsRequest) Validate() error {
+	return validation.ValidateStruct(&request,
+		validation.Field(&request.ConversationID, validation.Required, is.UUIDv4),
+		validation.Field(&request.Conversants, validation.Required, validation.Length(1, 20), validation.By(UUIDList)))
+}
+
+func (request LeaveConversationRequest) Validate() error {
+	return validation.ValidateStruct(&request,
+		validation.Field(&request.ConversationID, validation.Required, is.UUIDv4))
+}
+
+func (request SetRoleRequest) Validate() error {
+	return validation.ValidateStruct(&request,
+		validation.Field(&request.ConversationID, validation.Required, is.UUIDv4),
+		validation.Field(&request.ConversantID, validation.Required, is.UUIDv4),
+		validation.Field(&request.Role, validation.Required, validation.In(
+			repositories.RoleOwner, repositories.RoleAdmin, repositories.RoleMember, repositories.RoleReadOnly)))
+}
+
+func (request RenameConversationRequest) Validate() error {
+	return validation.ValidateStruct(&request,
+		validation.Field(&request.ConversationID, validation.Required, is.UUIDv4),
+		validation.Field(&request.Name, validation.Required, validation.Length(1, 255)))
+}
+
+func (request DeleteConversationRequest) Validate() error {
+	return validation.ValidateStruct(&request,
+		validation.Field(&request.ConversationID, validation.Required, is.UUIDv4))
+}
+
+func (request BlockRequest) Validate() error {
+	return validation.ValidateStruct(&request,
+		validation.Field(&request.ConversantID, validation.Required, is.UUIDv4))
+}
+
+func (request UnblockRequest) Validate() error {
+	return validation.ValidateStruct(&request,
+		validation.Field(&request.ConversantID, validation.Required, is.UUIDv4))
+}
+
+func (request ReauthenticateRequest) Validate() error {
+	return validation.ValidateStruct(&request,
+		validation.Field(&request.Credentials, validation.Required))
+}
+
+func (request ResumeRequest) Validate() error {
+	return validation.ValidateStruct(&request,
+		validation.Field(&request.Cursors, validation.Required, validation.Length(1, 100), validation.By(cursorMap)))
+}
+
+func cursorMap(input interface{}) error {
+	cursors, ok := input.(map[string]int64)
+	if !ok {
+		return errors.New("must be map type")
+	}
+
+	for conversationID, sequence := range cursors {
+		if err := is.UUIDv4.Validate(conversationID); err != nil {
+			return err
+		}
+		if sequence < 0 {
+			return errors.New("sequence must be no less than 0")
+		}
+	}
+	return nil
 }
@@ -1,32 +1,141 @@
 package connection
 
-import "github.com/ryan-berger/chatty/repositories"
+import (
+	"time"
+
+	"github.com/ryan-berger/chatty/repositories"
+)
 
 const (
 	Error ResponseType = iota
 	NewMessage
 	NewConversation
 	ReturnConversation
+	MessageAccepted
+	Resumed
+	ConversationList
+	ConversationUpdated
+	AuthExpiring
+	Reauthenticated
+	ConversationDeleted
+	BlockUpdated
+)
+
+const (
+	// CodeForbidden is the ResponseError code for requests
+	// the sender isn't allowed to make
+	CodeForbidden = "forbidden"
+	// CodeAuthExpired is the ResponseError code sent just before a
+	// connection is closed because its credentials expired
+	CodeAuthExpired = "authExpired"
 )
 
 type (
+	// Response is sent to a connection. RequestID is the ID
+	// of the request that caused it, if the client sent one
 	Response struct {
-		Type ResponseType `json:"type"`
-		Data interface{}  `json:"data"`
+		Type      ResponseType `json:"type"`
+		RequestID string       `json:"requestId"`
+		Data      interface{}  `json:"data"`
 	}
 
 	NewMessageResponse struct {
 		repositories.Message
 	}
 
+	// ReturnConversationResponse is a page of a conversation's messages, newest first.
+	// PrevCursor is set when there are older messages, and is sent as Before to get
+	// them. NextCursor is set when there are newer messages, and is sent as After
+	ReturnConversationResponse struct {
+		repositories.Conversation
+		PrevCursor int64 `json:"prevCursor,omitempty"`
+		NextCursor int64 `json:"nextCursor,omitempty"`
+	}
+
+	// MessageAcceptedResponse acknowledges a SendMessageRequest
+	// once the message has been stored
+	MessageAcceptedResponse struct {
+		MessageID      string `json:"messageId"`
+		ConversationID string `json:"conversationId"`
+	}
+
+	// ResumedResponse is sent once every conversation in a ResumeRequest has been
+	// replayed, with the sequence of the last message sent for each of them
+	ResumedResponse struct {
+		Cursors map[string]int64 `json:"cursors"`
+	}
+
+	// ListConversationsResponse is a page of the sender's conversations
+	ListConversationsResponse struct {
+		Conversations []repositories.ConversationSummary `json:"conversations"`
+	}
+
+	// ConversationUpdatedResponse is pushed to every member of a conversation, and
+	// to anyone removed from it, when its conversants, their roles or its name change.
+	// Name is only set when the conversation was renamed
+	ConversationUpdatedResponse struct {
+		ConversationID string                    `json:"conversationId"`
+		Name           string                    `json:"name,omitempty"`
+		Conversants    []repositories.Conversant `json:"conversants"`
+		Added          []string                  `json:"added,omitempty"`
+		Removed        []string                  `json:"removed,omitempty"`
+	}
+
+	// ConversationDeletedResponse is pushed to everyone who
+	// was in a conversation when it is deleted
+	ConversationDeletedResponse struct {
+		ConversationID string `json:"conversationId"`
+	}
+
+	// BlockUpdatedResponse acknowledges a BlockRequest or UnblockRequest with how the
+	// sender now treats the conversant. Blocked and Mute are both false once unblocked
+	BlockUpdatedResponse struct {
+		ConversantID string `json:"conversantId"`
+		Blocked      bool   `json:"blocked"`
+		Mute         bool   `json:"mute"`
+	}
+
+	// AuthExpiringResponse warns that the connection's credentials expire at ExpiresAt,
+	// and that it will be closed then unless it sends a ReauthenticateRequest
+	AuthExpiringResponse struct {
+		ExpiresAt time.Time `json:"expiresAt"`
+	}
+
+	// ReauthenticatedResponse acknowledges a ReauthenticateRequest
+	// with when the fresh credentials expire
+	ReauthenticatedResponse struct {
+		ExpiresAt time.Time `json:"expiresAt"`
+	}
+
+	// ResponseError is sent when a request fails. Code is set
+	// for errors clients are expected to handle, like CodeForbidden
 	ResponseError struct {
 		Error string `json:"error"`
+		Code  string `json:"code,omitempty"`
 	}
 )
 
-func NewResponseError(error string) Response {
+func NewResponseError(requestID, error string) Response {
+	return Response{
+		Type:      Error,
+		RequestID: requestID,
+		Data:      ResponseError{Error: error},
+	}
+}
+
+// NewForbiddenError is a ResponseError with CodeForbidden
+func NewForbiddenError(requestID, error string) Response {
+	return Response{
+		Type:      Error,
+		RequestID: requestID,
+		Data:      ResponseError{Error: error, Code: CodeForbidden},
+	}
+}
+
+// NewAuthExpiredError is a ResponseError with CodeAuthExpired
+func NewAuthExpiredError() Response {
 	return Response{
 		Type: Error,
-		Data: ResponseError{Error: error},
+		Data: ResponseError{Error: "credentials expired", Code: CodeAuthExpired},
 	}
 }
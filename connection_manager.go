@@ -2,6 +2,7 @@ package chatty
 
 import (
 	"fmt"
+	"hash/fnv"
 	"sync"
 	"time"
 
@@ -15,9 +16,18 @@ import (
 
 var numWorkers = 40
 
+const workerQueueSize = 10
+
+const resumePageSize = 100
+
+// authExpiryWarning is how long before a connection's credentials expire
+// it is sent AuthExpiring, giving it time to reauthenticate
+var authExpiryWarning = time.Minute
+
 type messageRequest struct {
-	conn connection.Conn
-	data connection.SendMessageRequest
+	conn      connection.Conn
+	requestID string
+	data      connection.SendMessageRequest
 }
 
 // ConnectionManager is the main connection manager struct that handles all chat connections
@@ -25,17 +35,24 @@ type ConnectionManager struct {
 	auther         operators.Auther
 	connectionMu   *sync.RWMutex
 	connections    map[string][]connection.Conn
-	messageChan    chan messageRequest
+	workers        []chan func()
 	shutdownChan   chan struct{}
 	chatInteractor *chatInteractor
 	notifier       operators.Notifier
+
+	// resuming holds back live messages for connections whose backlog is being replayed,
+	// keyed by connection and then by conversation, see resume
+	resumingMu *sync.Mutex
+	resuming   map[connection.Conn]map[string][]repositories.Message
 }
 
-// NewManager creates a new connection manager given repos and operators
+// NewManager creates a new connection manager given repos and operators. auther
+// decides who can start conversations with whom, see the policy package
 func NewManager(
 	messageRepo repositories.MessageRepo,
 	conversationRepo repositories.ConversationRepo,
 	conversantRepo repositories.ConversantRepo,
+	blockRepo repositories.BlockRepo,
 	auther operators.Auther,
 	notifier operators.Notifier) *ConnectionManager {
 
@@ -44,22 +61,59 @@ func NewManager(
 		connectionMu:   &sync.RWMutex{},
 		connections:    make(map[string][]connection.Conn),
 		shutdownChan:   make(chan struct{}),
-		messageChan:    make(chan messageRequest, numWorkers),
 		chatInteractor: newChatInteractor(messageRepo, conversationRepo, conversantRepo),
 		notifier:       notifier,
+		resumingMu:     &sync.Mutex{},
+		resuming:       make(map[connection.Conn]map[string][]repositories.Message),
 	}
+	manager.chatInteractor.auther = auther
+	manager.chatInteractor.blockRepo = blockRepo
 	manager.startup()
 	return manager
 }
 
+// startup starts the message workers. Each worker has its own queue, and all
+// work for a conversation goes to the same worker so that a conversation's
+// messages are stored and delivered in the order they were sent
 func (manager *ConnectionManager) startup() {
-	for i := 0; i < numWorkers; i++ {
-		go manager.startMessageWorker()
+	manager.workers = make([]chan func(), numWorkers)
+	for i := range manager.workers {
+		manager.workers[i] = make(chan func(), workerQueueSize)
+		go manager.startMessageWorker(manager.workers[i])
 	}
 }
 
 func (manager *ConnectionManager) shutdown() {
-	manager.shutdownChan <- struct{}{}
+	close(manager.shutdownChan)
+}
+
+// workerFor picks the worker queue for a conversation
+func (manager *ConnectionManager) workerFor(conversationID string) chan func() {
+	h := fnv.New64a()
+	h.Write([]byte(conversationID))
+	return manager.workers[jumpHash(h.Sum64(), len(manager.workers))]
+}
+
+// enqueue runs job on the conversation's worker
+func (manager *ConnectionManager) enqueue(conversationID string, job func()) error {
+	select {
+	case manager.workerFor(conversationID) <- job:
+		return nil
+	case <-time.After(10 * time.Second):
+		return errors.New("server busy")
+	}
+}
+
+// jumpHash is Lamping and Veach's jump consistent hash. It maps key to a bucket in
+// [0, buckets), and only moves 1/buckets of the keys when a bucket is added
+func jumpHash(key uint64, buckets int) int {
+	var b, j int64 = -1, 0
+	for j < int64(buckets) {
+		b = j
+		key = key*2862933555777941757 + 1
+		j = int64(float64(b+1) * (float64(int64(1)<<31) / float64((key>>33)+1)))
+	}
+	return int(b)
 }
 
 // Join authorizes a connection and then joins the server
@@ -72,7 +126,7 @@ func (manager *ConnectionManager) Join(conn connection.Conn) {
 
 	if err != nil {
 		fmt.Println("Join_Upsert", err)
-		conn.Leave() <- struct{}{}
+		conn.Close()
 		return
 	}
 
@@ -84,37 +138,142 @@ func (manager *ConnectionManager) addConn(conn connection.Conn) {
 	connections := manager.connections[conn.GetConversant().ID]
 	manager.connections[conn.GetConversant().ID] = append(connections, conn)
 	recover()
-	go manager.handleConnection(conn)
+
+	done := make(chan struct{})
+	go manager.handleConnection(conn, done)
+	if expiring, ok := conn.(connection.Expiring); ok {
+		go manager.watchExpiry(conn, expiring, done)
+	}
 	manager.connectionMu.Unlock()
 }
 
-func (manager *ConnectionManager) handleConnection(conn connection.Conn) {
+func (manager *ConnectionManager) handleConnection(conn connection.Conn, done chan struct{}) {
 	for {
 		select {
 		case command := <-conn.Requests():
 			if command.Data == nil {
-				manager.sendErr(conn, "no request body")
+				manager.sendErr(conn, command.RequestID, "no request body")
 				continue
 			}
 			var messageErr error
 			switch command.Type {
 			case connection.SendMessage:
-				messageErr = manager.sendMessage(conn, command.Data.(connection.SendMessageRequest))
+				messageErr = manager.sendMessage(conn, command.RequestID, command.Data.(connection.SendMessageRequest))
 			case connection.CreateConversation:
-				messageErr = manager.createConversation(conn, command.Data.(connection.CreateConversationRequest))
+				messageErr = manager.createConversation(conn, command.RequestID, command.Data.(connection.CreateConversationRequest))
 			case connection.RetrieveConversation:
-				manager.retrieveConversation(conn, command.Data.(connection.RetrieveConversationRequest))
+				messageErr = manager.retrieveConversation(conn, command.RequestID, command.Data.(connection.RetrieveConversationRequest))
+			case connection.Resume:
+				messageErr = manager.resume(conn, command.RequestID, command.Data.(connection.ResumeRequest))
+			case connection.ListConversations:
+				messageErr = manager.listConversations(conn, command.RequestID, command.Data.(connection.ListConversationsRequest))
+			case connection.AddConversants:
+				messageErr = manager.addConversants(conn, command.RequestID, command.Data.(connection.AddConversantsRequest))
+			case connection.RemoveConversants:
+				messageErr = manager.removeConversants(conn, command.RequestID, command.Data.(connection.RemoveConversantsRequest))
+			case connection.LeaveConversation:
+				messageErr = manager.leaveConversation(conn, command.RequestID, command.Data.(connection.LeaveConversationRequest))
+			case connection.Reauthenticate:
+				messageErr = manager.reauthenticate(conn, command.RequestID, command.Data.(connection.ReauthenticateRequest))
+			case connection.SetRole:
+				messageErr = manager.setRole(conn, command.RequestID, command.Data.(connection.SetRoleRequest))
+			case connection.RenameConversation:
+				messageErr = manager.renameConversation(conn, command.RequestID, command.Data.(connection.RenameConversationRequest))
+			case connection.DeleteConversation:
+				messageErr = manager.deleteConversation(conn, command.RequestID, command.Data.(connection.DeleteConversationRequest))
+			case connection.Block:
+				messageErr = manager.block(conn, command.RequestID, command.Data.(connection.BlockRequest))
+			case connection.Unblock:
+				messageErr = manager.unblock(conn, command.RequestID, command.Data.(connection.UnblockRequest))
 			}
 			if messageErr != nil {
-				manager.sendErr(conn, messageErr.Error())
+				manager.sendRequestErr(conn, command.RequestID, messageErr)
 			}
 		case <-conn.Leave():
+			close(done)
 			manager.removeConn(conn.GetConversant().ID)
 			return
 		}
 	}
 }
 
+// watchExpiry warns the connection authExpiryWarning before its credentials expire, and
+// closes it once they have unless it reauthenticated in the meantime. It stops when
+// done is closed, even part way through sending, or straight away for credentials that
+// never expire
+func (manager *ConnectionManager) watchExpiry(conn connection.Conn, expiring connection.Expiring, done chan struct{}) {
+	var warned time.Time
+	for {
+		expiry := expiring.Expiry()
+		if expiry.IsZero() {
+			return
+		}
+
+		if !time.Now().Before(expiry) {
+			select {
+			case conn.Response() <- connection.NewAuthExpiredError():
+			case <-done:
+				return
+			}
+
+			// the connection sends on Leave once it has hung up, which removes it
+			conn.Close()
+			return
+		}
+
+		next := expiry
+		if !warned.Equal(expiry) {
+			warning := expiry.Add(-authExpiryWarning)
+			if !time.Now().Before(warning) {
+				warned = expiry
+				select {
+				case conn.Response() <- connection.Response{
+					Type: connection.AuthExpiring,
+					Data: connection.AuthExpiringResponse{ExpiresAt: expiry},
+				}:
+				case <-done:
+					return
+				}
+				continue
+			}
+			next = warning
+		}
+
+		// reauthenticating moves the expiry, which is picked up when the timer fires
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-timer.C:
+		case <-done:
+			timer.Stop()
+			return
+		}
+	}
+}
+
+// reauthenticate gives the connection fresh credentials, if it has ones that expire
+func (manager *ConnectionManager) reauthenticate(conn connection.Conn, requestID string, request connection.ReauthenticateRequest) error {
+	if err := request.Validate(); err != nil {
+		return err
+	}
+
+	expiring, ok := conn.(connection.Expiring)
+	if !ok {
+		return errors.New("connection can't reauthenticate")
+	}
+
+	if err := expiring.Reauthenticate(request.Credentials); err != nil {
+		fmt.Println("reauthenticate_Reauthenticate", err)
+		return &ForbiddenError{Reason: "unable to reauthenticate"}
+	}
+
+	conn.Response() <- connection.Response{
+		Type:      connection.Reauthenticated,
+		RequestID: requestID,
+		Data:      connection.ReauthenticatedResponse{ExpiresAt: expiring.Expiry()},
+	}
+	return nil
+}
+
 func (manager *ConnectionManager) removeConn(id string) {
 	manager.connectionMu.Lock()
 	defer manager.connectionMu.Unlock()
@@ -133,16 +292,154 @@ func (manager *ConnectionManager) removeConn(id string) {
 	}
 }
 
-func (manager *ConnectionManager) sendMessage(conn connection.Conn, m connection.SendMessageRequest) error {
-	select {
-	case manager.messageChan <- messageRequest{conn: conn, data: m}:
-		return nil
-	case <-time.After(10 * time.Second):
+func (manager *ConnectionManager) sendMessage(conn connection.Conn, requestID string, m connection.SendMessageRequest) error {
+	message := messageRequest{conn: conn, requestID: requestID, data: m}
+
+	err := manager.enqueue(m.ConversationID, func() {
+		if err := manager.createMessage(message); err != nil {
+			manager.sendRequestErr(message.conn, message.requestID, err)
+		}
+	})
+
+	if err != nil {
 		return errors.New("could not send message")
 	}
+	return nil
+}
+
+// resume replays every message after each cursor to conn. Each conversation's backlog
+// is sent from that conversation's worker. Live messages for the conversation are held back
+// from the time the request is handled until its backlog has been sent, and then only the
+// ones the backlog didn't include are sent, so the client gets each message once and in order
+func (manager *ConnectionManager) resume(conn connection.Conn, requestID string, request connection.ResumeRequest) error {
+	if err := request.Validate(); err != nil {
+		return err
+	}
+
+	cursorsMu := &sync.Mutex{}
+	cursors := make(map[string]int64)
+	wg := &sync.WaitGroup{}
+
+	for conversationID := range request.Cursors {
+		manager.holdLive(conn, conversationID)
+	}
+
+	for conversationID, sequence := range request.Cursors {
+		conversationID, sequence := conversationID, sequence
+
+		wg.Add(1)
+		err := manager.enqueue(conversationID, func() {
+			defer wg.Done()
+
+			last, err := manager.replay(conn, conversationID, sequence)
+			if err != nil {
+				fmt.Println("resume_replay", err)
+				manager.sendRequestErr(conn, requestID, publicErr(err, "unable to resume conversation "+conversationID))
+			}
+			manager.releaseLive(conn, conversationID, last)
+
+			cursorsMu.Lock()
+			cursors[conversationID] = last
+			cursorsMu.Unlock()
+		})
+
+		if err != nil {
+			wg.Done()
+			manager.releaseLive(conn, conversationID, sequence)
+			manager.sendErr(conn, requestID, "unable to resume conversation "+conversationID)
+		}
+	}
+
+	go func() {
+		wg.Wait()
+		conn.Response() <- connection.Response{
+			Type:      connection.Resumed,
+			RequestID: requestID,
+			Data:      connection.ResumedResponse{Cursors: cursors},
+		}
+	}()
+
+	return nil
+}
+
+// replay sends every message in the conversation after sequence to conn, other than those
+// from conversants it blocked, returning the sequence of the last message replayed
+func (manager *ConnectionManager) replay(conn connection.Conn, conversationID string, sequence int64) (int64, error) {
+	blocked, err := manager.chatInteractor.GetBlocked(conn.GetConversant().ID)
+	if err != nil {
+		return sequence, err
+	}
+
+	for {
+		messages, err := manager.chatInteractor.GetMessagesAfter(conn.GetConversant().ID, conversationID, sequence, resumePageSize)
+		if err != nil {
+			return sequence, err
+		}
+
+		for _, message := range withoutBlocked(messages, blocked) {
+			manager.sendNewMessage(conn, message)
+		}
+
+		if len(messages) > 0 {
+			sequence = messages[len(messages)-1].Sequence
+		}
+
+		if len(messages) < resumePageSize {
+			return sequence, nil
+		}
+	}
 }
 
-func (manager *ConnectionManager) createConversation(sender connection.Conn, conversation connection.CreateConversationRequest) error {
+// holdLive starts holding back live messages in the conversation from conn
+func (manager *ConnectionManager) holdLive(conn connection.Conn, conversationID string) {
+	manager.resumingMu.Lock()
+	defer manager.resumingMu.Unlock()
+
+	held, ok := manager.resuming[conn]
+	if !ok {
+		held = make(map[string][]repositories.Message)
+		manager.resuming[conn] = held
+	}
+
+	if _, ok := held[conversationID]; !ok {
+		held[conversationID] = []repositories.Message{}
+	}
+}
+
+// releaseLive stops holding back live messages in the conversation from conn, sending the
+// held ones after sequence. It runs on the conversation's worker, which is where live
+// messages are sent from, so nothing newer can be sent ahead of them
+func (manager *ConnectionManager) releaseLive(conn connection.Conn, conversationID string, sequence int64) {
+	manager.resumingMu.Lock()
+	held := manager.resuming[conn][conversationID]
+	delete(manager.resuming[conn], conversationID)
+	if len(manager.resuming[conn]) == 0 {
+		delete(manager.resuming, conn)
+	}
+	manager.resumingMu.Unlock()
+
+	for _, message := range held {
+		if message.Sequence > sequence {
+			manager.sendNewMessage(conn, message)
+		}
+	}
+}
+
+// sendLiveMessage sends a message as it is created, unless the conversation's
+// backlog is being replayed to conn, in which case it is held until that's done
+func (manager *ConnectionManager) sendLiveMessage(conn connection.Conn, message repositories.Message) {
+	manager.resumingMu.Lock()
+	if held, ok := manager.resuming[conn][message.ConversationID]; ok {
+		manager.resuming[conn][message.ConversationID] = append(held, message)
+		manager.resumingMu.Unlock()
+		return
+	}
+	manager.resumingMu.Unlock()
+
+	manager.sendNewMessage(conn, message)
+}
+
+func (manager *ConnectionManager) createConversation(sender connection.Conn, requestID string, conversation connection.CreateConversationRequest) error {
 	conversation.SenderID = sender.GetConversant().ID
 
 	newConversation, err := manager.
@@ -151,32 +448,237 @@ func (manager *ConnectionManager) createConversation(sender connection.Conn, con
 
 	if err != nil {
 		fmt.Println("createConversation_CreateConversation", err)
-		return errors.New("unable to create conversation")
+		return publicErr(err, "unable to create conversation")
 	}
 
-	sender.Response() <- connection.Response{Type: connection.NewConversation, Data: *newConversation}
+	sender.Response() <- connection.Response{Type: connection.NewConversation, RequestID: requestID, Data: *newConversation}
 	return nil
 }
 
-func (manager *ConnectionManager) retrieveConversation(sender connection.Conn, request connection.RetrieveConversationRequest) error {
+func (manager *ConnectionManager) retrieveConversation(sender connection.Conn, requestID string, request connection.RetrieveConversationRequest) error {
+	request.SenderID = sender.GetConversant().ID
+
 	conversation, err := manager.
 		chatInteractor.
 		GetConversation(request)
 
 	if err != nil {
 		fmt.Println("retrieveConversation_GetConversation", err)
-		return errors.New("unable to get conversation")
+		return publicErr(err, "unable to get conversation")
+	}
+
+	sender.Response() <- connection.Response{Type: connection.ReturnConversation, RequestID: requestID, Data: *conversation}
+	return nil
+}
+
+func (manager *ConnectionManager) listConversations(sender connection.Conn, requestID string, request connection.ListConversationsRequest) error {
+	request.SenderID = sender.GetConversant().ID
+
+	conversations, err := manager.
+		chatInteractor.
+		ListConversations(request)
+
+	if err != nil {
+		fmt.Println("listConversations_ListConversations", err)
+		return errors.New("unable to list conversations")
+	}
+
+	sender.Response() <- connection.Response{
+		Type:      connection.ConversationList,
+		RequestID: requestID,
+		Data:      connection.ListConversationsResponse{Conversations: conversations},
+	}
+	return nil
+}
+
+func (manager *ConnectionManager) addConversants(sender connection.Conn, requestID string, request connection.AddConversantsRequest) error {
+	request.SenderID = sender.GetConversant().ID
+
+	return manager.updateConversation(sender, requestID, request.ConversationID, func() (*conversationUpdate, error) {
+		update, err := manager.chatInteractor.AddConversants(request)
+		if err != nil {
+			fmt.Println("addConversants_AddConversants", err)
+			return nil, publicErr(err, "unable to add conversants")
+		}
+		return update, nil
+	})
+}
+
+func (manager *ConnectionManager) removeConversants(sender connection.Conn, requestID string, request connection.RemoveConversantsRequest) error {
+	request.SenderID = sender.GetConversant().ID
+
+	return manager.updateConversation(sender, requestID, request.ConversationID, func() (*conversationUpdate, error) {
+		update, err := manager.chatInteractor.RemoveConversants(request)
+		if err != nil {
+			fmt.Println("removeConversants_RemoveConversants", err)
+			return nil, publicErr(err, "unable to remove conversants")
+		}
+		return update, nil
+	})
+}
+
+func (manager *ConnectionManager) leaveConversation(sender connection.Conn, requestID string, request connection.LeaveConversationRequest) error {
+	request.SenderID = sender.GetConversant().ID
+
+	return manager.updateConversation(sender, requestID, request.ConversationID, func() (*conversationUpdate, error) {
+		update, err := manager.chatInteractor.LeaveConversation(request)
+		if err != nil {
+			fmt.Println("leaveConversation_LeaveConversation", err)
+			return nil, publicErr(err, "unable to leave conversation")
+		}
+		return update, nil
+	})
+}
+
+func (manager *ConnectionManager) setRole(sender connection.Conn, requestID string, request connection.SetRoleRequest) error {
+	request.SenderID = sender.GetConversant().ID
+
+	return manager.updateConversation(sender, requestID, request.ConversationID, func() (*conversationUpdate, error) {
+		update, err := manager.chatInteractor.SetRole(request)
+		if err != nil {
+			fmt.Println("setRole_SetRole", err)
+			return nil, publicErr(err, "unable to set role")
+		}
+		return update, nil
+	})
+}
+
+func (manager *ConnectionManager) renameConversation(sender connection.Conn, requestID string, request connection.RenameConversationRequest) error {
+	request.SenderID = sender.GetConversant().ID
+
+	return manager.updateConversation(sender, requestID, request.ConversationID, func() (*conversationUpdate, error) {
+		update, err := manager.chatInteractor.RenameConversation(request)
+		if err != nil {
+			fmt.Println("renameConversation_RenameConversation", err)
+			return nil, publicErr(err, "unable to rename conversation")
+		}
+		return update, nil
+	})
+}
+
+// deleteConversation deletes the conversation on its worker, after any messages already
+// queued for it, and sends a ConversationDeleted event to everyone who was in it
+func (manager *ConnectionManager) deleteConversation(sender connection.Conn, requestID string, request connection.DeleteConversationRequest) error {
+	request.SenderID = sender.GetConversant().ID
+
+	err := manager.enqueue(request.ConversationID, func() {
+		conversants, err := manager.chatInteractor.DeleteConversation(request)
+		if err != nil {
+			fmt.Println("deleteConversation_DeleteConversation", err)
+			manager.sendRequestErr(sender, requestID, publicErr(err, "unable to delete conversation"))
+			return
+		}
+
+		deleted := connection.ConversationDeletedResponse{ConversationID: request.ConversationID}
+
+		manager.connectionMu.RLock()
+		for _, conversant := range conversants {
+			for _, conn := range manager.connections[conversant.ID] {
+				response := connection.Response{Type: connection.ConversationDeleted, Data: deleted}
+				if conn == sender {
+					response.RequestID = requestID
+				}
+				conn.Response() <- response
+			}
+		}
+		manager.connectionMu.RUnlock()
+	})
+
+	if err != nil {
+		return errors.New("could not delete conversation")
+	}
+	return nil
+}
+
+func (manager *ConnectionManager) block(sender connection.Conn, requestID string, request connection.BlockRequest) error {
+	request.SenderID = sender.GetConversant().ID
+
+	err := manager.chatInteractor.Block(request)
+	if err != nil {
+		fmt.Println("block_Block", err)
+		return publicErr(err, "unable to block conversant")
 	}
 
-	sender.Response() <- connection.Response{Type: connection.ReturnConversation, Data: *conversation}
+	manager.sendBlockUpdated(sender, requestID, connection.BlockUpdatedResponse{
+		ConversantID: request.ConversantID,
+		Blocked:      !request.Mute,
+		Mute:         request.Mute,
+	})
 	return nil
 }
 
-func (manager *ConnectionManager) startMessageWorker() {
+func (manager *ConnectionManager) unblock(sender connection.Conn, requestID string, request connection.UnblockRequest) error {
+	request.SenderID = sender.GetConversant().ID
+
+	err := manager.chatInteractor.Unblock(request)
+	if err != nil {
+		fmt.Println("unblock_Unblock", err)
+		return publicErr(err, "unable to unblock conversant")
+	}
+
+	manager.sendBlockUpdated(sender, requestID, connection.BlockUpdatedResponse{ConversantID: request.ConversantID})
+	return nil
+}
+
+func (manager *ConnectionManager) sendBlockUpdated(conn connection.Conn, requestID string, blockUpdated connection.BlockUpdatedResponse) {
+	conn.Response() <- connection.Response{Type: connection.BlockUpdated, RequestID: requestID, Data: blockUpdated}
+}
+
+// updateConversation runs a change to a conversation on the conversation's worker,
+// so the system message is ordered with the conversation's other messages
+func (manager *ConnectionManager) updateConversation(sender connection.Conn, requestID, conversationID string, change func() (*conversationUpdate, error)) error {
+	err := manager.enqueue(conversationID, func() {
+		update, err := change()
+		if err != nil {
+			manager.sendRequestErr(sender, requestID, err)
+			return
+		}
+		manager.notifyUpdate(sender, requestID, *update)
+	})
+
+	if err != nil {
+		return errors.New("could not update conversation")
+	}
+	return nil
+}
+
+// notifyUpdate sends the system message and a ConversationUpdated event to everyone in
+// the conversation, as well as anyone just removed from it. The sender's connection
+// gets the request ID
+func (manager *ConnectionManager) notifyUpdate(sender connection.Conn, requestID string, update conversationUpdate) {
+	recipients := update.conversants
+	for _, conversantID := range update.removed {
+		recipients = append(recipients, repositories.Conversant{ID: conversantID})
+	}
+
+	manager.notifyRecipients(recipients, update.message, nil)
+
+	updated := connection.ConversationUpdatedResponse{
+		ConversationID: update.message.ConversationID,
+		Name:           update.name,
+		Conversants:    update.conversants,
+		Added:          update.added,
+		Removed:        update.removed,
+	}
+
+	manager.connectionMu.RLock()
+	for _, recipient := range recipients {
+		for _, conn := range manager.connections[recipient.ID] {
+			response := connection.Response{Type: connection.ConversationUpdated, Data: updated}
+			if conn == sender {
+				response.RequestID = requestID
+			}
+			conn.Response() <- response
+		}
+	}
+	manager.connectionMu.RUnlock()
+}
+
+func (manager *ConnectionManager) startMessageWorker(jobs chan func()) {
 	for {
 		select {
-		case message := <-manager.messageChan:
-			manager.createMessage(message)
+		case job := <-jobs:
+			job()
 		case <-manager.shutdownChan:
 			return
 		}
@@ -187,34 +689,55 @@ func (manager *ConnectionManager) createMessage(message messageRequest) error {
 	data := message.data
 	data.SenderID = message.conn.GetConversant().ID
 
-	newMessage, err := manager.
+	newMessage, duplicate, err := manager.
 		chatInteractor.
 		SendMessage(data)
 
 	if err != nil {
 		fmt.Println("createMessage_SendMessage", err)
-		return errors.New("couldn't send message")
+		return publicErr(err, "couldn't send message")
+	}
+
+	if duplicate {
+		manager.acceptMessage(message.conn, message.requestID, *newMessage)
+		return nil
 	}
 
 	conversants, err := manager.chatInteractor.GetConversants(data.ConversationID)
 
 	if err != nil {
 		fmt.Println("createMessage_GetConversants", err)
+		manager.acceptMessage(message.conn, message.requestID, *newMessage)
 		return nil
 	}
 
-	manager.notifyRecipients(conversants, *newMessage)
+	// if blocks can't be looked up, the message is delivered to everyone rather than dropped
+	blockers, err := manager.chatInteractor.GetBlockers(data.SenderID)
+	if err != nil {
+		fmt.Println("createMessage_GetBlockers", err)
+	}
+
+	manager.notifyRecipients(conversants, *newMessage, blockers)
+	manager.acceptMessage(message.conn, message.requestID, *newMessage)
 	return nil
 }
 
-func (manager *ConnectionManager) notifyRecipients(conversants []repositories.Conversant, message repositories.Message) {
+// notifyRecipients sends the message to every conversant's connections, or pushes it with the notifier
+// to those who aren't connected. Conversants who blocked the sender, according to blockers, get
+// neither, and those who muted them are sent it live but never pushed
+func (manager *ConnectionManager) notifyRecipients(conversants []repositories.Conversant, message repositories.Message, blockers map[string]repositories.Block) {
 	manager.connectionMu.RLock()
 	for _, conversant := range conversants {
+		block, blocked := blockers[conversant.ID]
+		if blocked && !block.Mute {
+			continue
+		}
+
 		if val, ok := manager.connections[conversant.ID]; ok {
 			for _, conn := range val {
-				manager.sendNewMessage(conn, message)
+				manager.sendLiveMessage(conn, message)
 			}
-		} else {
+		} else if !blocked {
 			manager.notifier.Notify(conversant.ID, message)
 		}
 	}
@@ -225,8 +748,37 @@ func (manager *ConnectionManager) sendNewMessage(conn connection.Conn, message r
 	conn.Response() <- connection.Response{Type: connection.NewMessage, Data: message}
 }
 
-func (manager *ConnectionManager) sendErr(conn connection.Conn, errString string) {
+// acceptMessage acknowledges a stored message to the connection that sent it
+func (manager *ConnectionManager) acceptMessage(conn connection.Conn, requestID string, message repositories.Message) {
+	conn.Response() <- connection.Response{
+		Type:      connection.MessageAccepted,
+		RequestID: requestID,
+		Data:      connection.MessageAcceptedResponse{MessageID: message.ID, ConversationID: message.ConversationID},
+	}
+}
+
+// publicErr hides err behind message, since it can be anything from a validation error to
+// a database error, unless the sender was forbidden, in which case they're told why
+func publicErr(err error, message string) error {
+	if forbidden, ok := err.(*ForbiddenError); ok {
+		return forbidden
+	}
+	return errors.New(message)
+}
+
+// sendRequestErr sends err to the connection, with CodeForbidden for a ForbiddenError
+func (manager *ConnectionManager) sendRequestErr(conn connection.Conn, requestID string, err error) {
+	if forbidden, ok := err.(*ForbiddenError); ok {
+		manager.connectionMu.RLock()
+		conn.Response() <- connection.NewForbiddenError(requestID, forbidden.Error())
+		manager.connectionMu.RUnlock()
+		return
+	}
+	manager.sendErr(conn, requestID, err.Error())
+}
+
+func (manager *ConnectionManager) sendErr(conn connection.Conn, requestID, errString string) {
 	manager.connectionMu.RLock()
-	conn.Response() <- connection.NewResponseError(errString)
+	conn.Response() <- connection.NewResponseError(requestID, errString)
 	manager.connectionMu.RUnlock()
 }
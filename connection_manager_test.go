@@ -1,6 +1,9 @@
 package chatty
 
 import (
+	"errors"
+	"math/rand"
+	"strconv"
 	"sync"
 	"testing"
 	"time"
@@ -11,21 +14,32 @@ import (
 	"github.com/ryan-berger/chatty/operators"
 
 	"github.com/ryan-berger/chatty/repositories"
+	"github.com/ryan-berger/chatty/repositories/memory"
 )
 
 type testData struct {
 	*repositories.MockConversationRepo
 	*repositories.MockConversantRepo
 	*repositories.MockMessageRepo
+	*repositories.MockBlockRepo
 	*operators.MockAuther
 	*operators.MockNotifier
 }
 
+func markReadNoop(conversationID, conversantID string, sequence int64) error {
+	return nil
+}
+
+func alwaysMember(conversationID, conversantID string) (bool, error) {
+	return true, nil
+}
+
 func newTestData() *testData {
 	return &testData{
 		&repositories.MockConversationRepo{},
 		&repositories.MockConversantRepo{},
 		&repositories.MockMessageRepo{},
+		&repositories.MockBlockRepo{},
 		&operators.MockAuther{},
 		&operators.MockNotifier{},
 	}
@@ -54,9 +68,10 @@ func makeMockManager() *ConnectionManager {
 	return &ConnectionManager{
 		connections:    make(map[string][]connection.Conn),
 		connectionMu:   &sync.RWMutex{},
-		messageChan:    make(chan messageRequest, 10),
 		shutdownChan:   make(chan struct{}, 1),
 		chatInteractor: &chatInteractor{},
+		resumingMu:     &sync.Mutex{},
+		resuming:       make(map[connection.Conn]map[string][]repositories.Message),
 	}
 }
 
@@ -81,6 +96,33 @@ func TestConnectionManager_JoinAuthorize(t *testing.T) {
 
 }
 
+func TestConnectionManager_JoinUpsertErr(t *testing.T) {
+	manager := makeMockManager()
+	manager.startup()
+
+	manager.chatInteractor.conversantRepo = &repositories.MockConversantRepo{
+		Upsert: func(conversant repositories.Conversant) (*repositories.Conversant, error) {
+			return nil, errors.New("test")
+		},
+	}
+
+	closed := false
+	conn := makeConn(uuid.New())
+	conn.Closer = func() {
+		closed = true
+	}
+
+	manager.Join(conn)
+
+	if !closed {
+		t.Fatal("connection should have been closed")
+	}
+
+	if len(manager.connections) != 0 {
+		t.Fatal("connection shouldn't have joined")
+	}
+}
+
 func TestConnectionManager_NotifyInMemory(t *testing.T) {
 	manager := makeMockManager()
 	manager.startup()
@@ -95,6 +137,8 @@ func TestConnectionManager_NotifyInMemory(t *testing.T) {
 	}
 
 	c := &repositories.MockConversationRepo{
+		MarkConvoRead: markReadNoop,
+		IsMember:      alwaysMember,
 		GetConvo: func(conversationId string) (conversants []repositories.Conversant, e error) {
 			return []repositories.Conversant{
 				{ID: receiverID},
@@ -121,7 +165,7 @@ func TestConnectionManager_NotifyInMemory(t *testing.T) {
 	manager.addConn(connA)
 	manager.addConn(connB)
 
-	manager.sendMessage(connA, connection.SendMessageRequest{ConversationID: uuid.New(), Message: "test"})
+	manager.sendMessage(connA, "", connection.SendMessageRequest{ConversationID: uuid.New(), Message: "test"})
 
 	select {
 	case response := <-resp:
@@ -145,6 +189,8 @@ func TestConnectionManager_Notifier(t *testing.T) {
 	}
 
 	c := &repositories.MockConversationRepo{
+		MarkConvoRead: markReadNoop,
+		IsMember:      alwaysMember,
 		GetConvo: func(conversationId string) (conversants []repositories.Conversant, e error) {
 			return []repositories.Conversant{
 				{ID: "b"},
@@ -184,9 +230,503 @@ func TestConnectionManager_Notifier(t *testing.T) {
 	}
 }
 
+func TestConnectionManager_MessageAccepted(t *testing.T) {
+	manager := makeMockManager()
+	manager.startup()
+
+	senderID := uuid.New()
+
+	m := &repositories.MockMessageRepo{
+		Create: func(message repositories.Message) (message2 *repositories.Message, e error) {
+			return &message, nil
+		},
+	}
+
+	c := &repositories.MockConversationRepo{
+		MarkConvoRead: markReadNoop,
+		IsMember:      alwaysMember,
+		GetConvo: func(conversationId string) (conversants []repositories.Conversant, e error) {
+			return []repositories.Conversant{
+				{ID: senderID},
+			}, nil
+		},
+	}
+
+	manager.chatInteractor = newChatInteractor(m, c, nil)
+	conn := makeConn(senderID)
+
+	requests := make(chan connection.Request)
+	resp := make(chan connection.Response, 2)
+
+	conn.Request = func() chan connection.Request {
+		return requests
+	}
+
+	conn.Resp = func() chan connection.Response {
+		return resp
+	}
+
+	manager.addConn(conn)
+
+	requests <- connection.Request{
+		Type:      connection.SendMessage,
+		RequestID: "test",
+		Data:      connection.SendMessageRequest{ConversationID: uuid.New(), Message: "Test"},
+	}
+
+	var newMessage repositories.Message
+	for _, expected := range []connection.ResponseType{connection.NewMessage, connection.MessageAccepted} {
+		select {
+		case response := <-resp:
+			if response.Type != expected {
+				t.Fatalf("expected response type %d, received %d", expected, response.Type)
+			}
+
+			if response.Type == connection.NewMessage {
+				newMessage = response.Data.(repositories.Message)
+				continue
+			}
+
+			if response.RequestID != "test" {
+				t.Fatalf("expected request id test, received %s", response.RequestID)
+			}
+
+			if response.Data.(connection.MessageAcceptedResponse).MessageID != newMessage.ID {
+				t.Fatalf("ack should carry the stored message id")
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("didn't receive response")
+		}
+	}
+
+	requests <- connection.Request{Type: connection.RequestError, RequestID: "error"}
+
+	select {
+	case response := <-resp:
+		if response.Type != connection.Error || response.RequestID != "error" {
+			t.Fatalf("expected error for request error, received %+v", response)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("didn't receive error")
+	}
+}
+
+func TestConnectionManager_Forbidden(t *testing.T) {
+	manager := makeMockManager()
+	manager.startup()
+
+	created := false
+	m := &repositories.MockMessageRepo{
+		Create: func(message repositories.Message) (*repositories.Message, error) {
+			created = true
+			return &message, nil
+		},
+	}
+
+	c := &repositories.MockConversationRepo{
+		IsMember: func(conversationID, conversantID string) (bool, error) {
+			return false, nil
+		},
+	}
+
+	manager.chatInteractor = newChatInteractor(m, c, nil)
+	conn := makeConn(uuid.New())
+
+	requests := make(chan connection.Request)
+	resp := make(chan connection.Response, 1)
+
+	conn.Request = func() chan connection.Request {
+		return requests
+	}
+
+	conn.Resp = func() chan connection.Response {
+		return resp
+	}
+
+	manager.addConn(conn)
+
+	requests <- connection.Request{
+		Type:      connection.SendMessage,
+		RequestID: "test",
+		Data:      connection.SendMessageRequest{ConversationID: uuid.New(), Message: "Test"},
+	}
+
+	select {
+	case response := <-resp:
+		if response.Type != connection.Error || response.RequestID != "test" {
+			t.Fatalf("expected an error for the request, received %+v", response)
+		}
+
+		if code := response.Data.(connection.ResponseError).Code; code != connection.CodeForbidden {
+			t.Fatalf("expected code %s, received %q", connection.CodeForbidden, code)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("didn't receive error")
+	}
+
+	if created {
+		t.Fatal("message shouldn't have been stored")
+	}
+}
+
+func TestConnectionManager_DuplicateMessage(t *testing.T) {
+	manager := makeMockManager()
+	manager.startup()
+
+	senderID := uuid.New()
+	original := repositories.Message{ID: uuid.New(), SenderID: senderID}
+
+	m := &repositories.MockMessageRepo{
+		Create: func(message repositories.Message) (message2 *repositories.Message, e error) {
+			return &original, nil
+		},
+	}
+
+	c := &repositories.MockConversationRepo{
+		MarkConvoRead: markReadNoop,
+		IsMember:      alwaysMember,
+		GetConvo: func(conversationId string) (conversants []repositories.Conversant, e error) {
+			return []repositories.Conversant{
+				{ID: senderID},
+			}, nil
+		},
+	}
+
+	manager.chatInteractor = newChatInteractor(m, c, nil)
+	conn := makeConn(senderID)
+
+	resp := make(chan connection.Response, 2)
+	conn.Resp = func() chan connection.Response {
+		return resp
+	}
+
+	manager.addConn(conn)
+	manager.sendMessage(conn, "test", connection.SendMessageRequest{ConversationID: uuid.New(), Message: "Test", IdempotencyKey: "key"})
+
+	select {
+	case response := <-resp:
+		if response.Type != connection.MessageAccepted {
+			t.Fatalf("duplicate message shouldn't be delivered again")
+		}
+
+		if response.Data.(connection.MessageAcceptedResponse).MessageID != original.ID {
+			t.Fatalf("ack should carry the original message id")
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("didn't receive ack")
+	}
+}
+
+func TestConnectionManager_ConversationOrder(t *testing.T) {
+	manager := makeMockManager()
+	manager.startup()
+
+	numConversations := 100
+	numMessages := 50
+
+	storedMu := &sync.Mutex{}
+	stored := make(map[string][]int)
+
+	m := &repositories.MockMessageRepo{
+		Create: func(message repositories.Message) (*repositories.Message, error) {
+			time.Sleep(time.Duration(rand.Intn(100)) * time.Microsecond)
+			i, _ := strconv.Atoi(message.Message)
+
+			storedMu.Lock()
+			stored[message.ConversationID] = append(stored[message.ConversationID], i)
+			storedMu.Unlock()
+			return &message, nil
+		},
+	}
+
+	c := &repositories.MockConversationRepo{
+		MarkConvoRead: markReadNoop,
+		IsMember:      alwaysMember,
+		GetConvo: func(conversationId string) ([]repositories.Conversant, error) {
+			return nil, nil
+		},
+	}
+
+	manager.chatInteractor = newChatInteractor(m, c, nil)
+
+	acks := make(chan connection.Response, numConversations*numMessages)
+	wg := &sync.WaitGroup{}
+
+	for i := 0; i < numConversations; i++ {
+		conn := makeConn(uuid.New())
+		conn.Resp = func() chan connection.Response {
+			return acks
+		}
+
+		wg.Add(1)
+		go func(conversationID string) {
+			defer wg.Done()
+			for j := 0; j < numMessages; j++ {
+				manager.sendMessage(conn, "", connection.SendMessageRequest{
+					ConversationID: conversationID,
+					Message:        strconv.Itoa(j + 1),
+				})
+			}
+		}(uuid.New())
+	}
+
+	wg.Wait()
+	for i := 0; i < numConversations*numMessages; i++ {
+		select {
+		case <-acks:
+		case <-time.After(10 * time.Second):
+			t.Fatalf("only %d of %d messages were stored", i, numConversations*numMessages)
+		}
+	}
+
+	for conversationID, messages := range stored {
+		for i, message := range messages {
+			if message != i+1 {
+				t.Fatalf("conversation %s stored message %d at position %d", conversationID, message, i+1)
+			}
+		}
+	}
+}
+
+func TestConnectionManager_Resume(t *testing.T) {
+	manager := makeMockManager()
+	manager.startup()
+
+	conversationID := uuid.New()
+	m := &repositories.MockMessageRepo{
+		GetAfter: func(id string, sequence int64, limit int) ([]repositories.Message, error) {
+			var messages []repositories.Message
+			for i := sequence + 1; i <= 250 && len(messages) < limit; i++ {
+				messages = append(messages, repositories.Message{ConversationID: id, Sequence: i})
+			}
+			return messages, nil
+		},
+	}
+
+	manager.chatInteractor = newChatInteractor(m, repositories.DefaultMockConversationRepo(), nil)
+	conn := makeConn(uuid.New())
+
+	requests := make(chan connection.Request)
+	resp := make(chan connection.Response)
+
+	conn.Request = func() chan connection.Request {
+		return requests
+	}
+
+	conn.Resp = func() chan connection.Response {
+		return resp
+	}
+
+	manager.addConn(conn)
+
+	requests <- connection.Request{
+		Type:      connection.Resume,
+		RequestID: "test",
+		Data:      connection.ResumeRequest{Cursors: map[string]int64{conversationID: 10}},
+	}
+
+	for i := int64(11); i <= 250; i++ {
+		select {
+		case response := <-resp:
+			if response.Type != connection.NewMessage {
+				t.Fatalf("expected new message, received %d", response.Type)
+			}
+
+			if sequence := response.Data.(repositories.Message).Sequence; sequence != i {
+				t.Fatalf("expected sequence %d, received %d", i, sequence)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("didn't receive message %d", i)
+		}
+	}
+
+	select {
+	case response := <-resp:
+		if response.Type != connection.Resumed || response.RequestID != "test" {
+			t.Fatalf("expected resumed response, received %+v", response)
+		}
+
+		if cursor := response.Data.(connection.ResumedResponse).Cursors[conversationID]; cursor != 250 {
+			t.Fatalf("expected cursor 250, received %d", cursor)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("didn't receive resumed response")
+	}
+}
+
+func TestConnectionManager_ResumeOverlap(t *testing.T) {
+	manager := makeMockManager()
+	manager.startup()
+
+	conversationID := uuid.New()
+	m := &repositories.MockMessageRepo{
+		GetAfter: func(id string, sequence int64, limit int) ([]repositories.Message, error) {
+			var messages []repositories.Message
+			for i := sequence + 1; i <= 3 && len(messages) < limit; i++ {
+				messages = append(messages, repositories.Message{ConversationID: id, Sequence: i})
+			}
+			return messages, nil
+		},
+	}
+
+	manager.chatInteractor = newChatInteractor(m, repositories.DefaultMockConversationRepo(), nil)
+	conn := makeConn(uuid.New())
+
+	resp := make(chan connection.Response)
+	conn.Resp = func() chan connection.Response {
+		return resp
+	}
+
+	manager.addConn(conn)
+
+	conversants := []repositories.Conversant{conn.GetConversant()}
+	live := func(sequence int64) {
+		manager.enqueue(conversationID, func() {
+			manager.notifyRecipients(conversants, repositories.Message{ConversationID: conversationID, Sequence: sequence}, nil)
+		})
+	}
+
+	// message 3 is queued for live delivery before the replay, but only runs once the resume has been requested
+	gate := make(chan struct{})
+	manager.enqueue(conversationID, func() { <-gate })
+	live(3)
+
+	if err := manager.resume(conn, "test", connection.ResumeRequest{Cursors: map[string]int64{conversationID: 0}}); err != nil {
+		t.Fatal(err)
+	}
+	close(gate)
+
+	receive := func() connection.Response {
+		select {
+		case response := <-resp:
+			return response
+		case <-time.After(time.Second):
+			t.Fatal("didn't receive a response")
+			return connection.Response{}
+		}
+	}
+
+	for _, sequence := range []int64{1, 2, 3} {
+		response := receive()
+		if response.Type != connection.NewMessage || response.Data.(repositories.Message).Sequence != sequence {
+			t.Fatalf("expected message %d, received %+v", sequence, response)
+		}
+	}
+
+	if response := receive(); response.Type != connection.Resumed {
+		t.Fatalf("expected resumed response, received %+v", response)
+	}
+
+	// once the backlog has been sent, live messages aren't held back
+	live(4)
+
+	if response := receive(); response.Type != connection.NewMessage || response.Data.(repositories.Message).Sequence != 4 {
+		t.Fatalf("expected message 4, received %+v", response)
+	}
+}
+
+func TestConnectionManager_ResumeBlocked(t *testing.T) {
+	manager := makeMockManager()
+	manager.startup()
+
+	conversationID, blocked := uuid.New(), uuid.New()
+	m := &repositories.MockMessageRepo{
+		GetAfter: func(id string, sequence int64, limit int) ([]repositories.Message, error) {
+			var messages []repositories.Message
+			for i := sequence + 1; i <= 4 && len(messages) < limit; i++ {
+				message := repositories.Message{ConversationID: id, Sequence: i, SenderID: uuid.New()}
+				if i%2 == 0 {
+					message.SenderID = blocked
+				}
+				messages = append(messages, message)
+			}
+			return messages, nil
+		},
+	}
+
+	conn := makeConn(uuid.New())
+	manager.chatInteractor = newChatInteractor(m, repositories.DefaultMockConversationRepo(), nil)
+	manager.chatInteractor.blockRepo = &repositories.MockBlockRepo{
+		Blocker: func(blockerID string) ([]repositories.Block, error) {
+			return []repositories.Block{{BlockerID: blockerID, BlockedID: blocked}}, nil
+		},
+	}
+
+	requests := make(chan connection.Request)
+	resp := make(chan connection.Response)
+
+	conn.Request = func() chan connection.Request {
+		return requests
+	}
+
+	conn.Resp = func() chan connection.Response {
+		return resp
+	}
+
+	manager.addConn(conn)
+
+	requests <- connection.Request{
+		Type:      connection.Resume,
+		RequestID: "test",
+		Data:      connection.ResumeRequest{Cursors: map[string]int64{conversationID: 0}},
+	}
+
+	for _, sequence := range []int64{1, 3} {
+		select {
+		case response := <-resp:
+			if response.Type != connection.NewMessage || response.Data.(repositories.Message).Sequence != sequence {
+				t.Fatalf("expected message %d, received %+v", sequence, response)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("didn't receive message %d", sequence)
+		}
+	}
+
+	// the cursor still moves past the blocked conversant's last message
+	select {
+	case response := <-resp:
+		if response.Type != connection.Resumed {
+			t.Fatalf("expected resumed response, received %+v", response)
+		}
+
+		if cursor := response.Data.(connection.ResumedResponse).Cursors[conversationID]; cursor != 4 {
+			t.Fatalf("expected cursor 4, received %d", cursor)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("didn't receive resumed response")
+	}
+}
+
+func TestJumpHash(t *testing.T) {
+	counts := make([]int, numWorkers)
+	for i := uint64(0); i < 10000; i++ {
+		bucket := jumpHash(i, numWorkers)
+		if bucket < 0 || bucket >= numWorkers {
+			t.Fatalf("bucket %d out of range", bucket)
+		}
+
+		if bucket != jumpHash(i, numWorkers) {
+			t.Fatalf("key %d should always map to the same bucket", i)
+		}
+
+		// growing the pool only ever moves keys to the new bucket
+		if grown := jumpHash(i, numWorkers+1); grown != bucket && grown != numWorkers {
+			t.Fatalf("key %d moved from %d to %d", i, bucket, grown)
+		}
+
+		counts[bucket]++
+	}
+
+	for bucket, count := range counts {
+		if count == 0 {
+			t.Fatalf("bucket %d never used", bucket)
+		}
+	}
+}
+
 func TestManager_Leave(t *testing.T) {
 	td := newTestData()
-	manager := NewManager(td, td, td, td, td)
+	manager := NewManager(td, td, td, td, td, td)
 
 	manager.chatInteractor.conversantRepo = &repositories.MockConversantRepo{
 		Upsert: func(conversant repositories.Conversant) (*repositories.Conversant, error) {
@@ -227,3 +767,358 @@ func TestManager_Leave(t *testing.T) {
 	}
 	manager.connectionMu.Unlock()
 }
+
+func TestConnectionManager_AddConversants(t *testing.T) {
+	store := memory.NewStore()
+	conversants := []repositories.Conversant{{ID: uuid.New()}, {ID: uuid.New()}, {ID: uuid.New()}}
+	for _, conversant := range conversants {
+		memory.NewConversantRepository(store).UpdateOrCreate(conversant)
+	}
+
+	conversationRepo := memory.NewConversationRepository(store)
+	owner := conversants[0]
+	owner.Role = repositories.RoleOwner
+	conversation, err := conversationRepo.CreateConversation(repositories.Conversation{Name: "group", Conversants: []repositories.Conversant{owner, conversants[1]}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	manager := makeMockManager()
+	manager.startup()
+	manager.chatInteractor = newChatInteractor(memory.NewMessageRepository(store), conversationRepo, nil)
+
+	requests := make(chan connection.Request)
+	responses := make([]chan connection.Response, len(conversants))
+	for i, conversant := range conversants {
+		conn := makeConn(conversant.ID)
+		resp := make(chan connection.Response, 2)
+		conn.Resp = func() chan connection.Response {
+			return resp
+		}
+		if i == 0 {
+			conn.Request = func() chan connection.Request {
+				return requests
+			}
+		}
+		responses[i] = resp
+		manager.addConn(conn)
+	}
+
+	requests <- connection.Request{
+		Type:      connection.AddConversants,
+		RequestID: "test",
+		Data:      connection.AddConversantsRequest{ConversationID: conversation.ID, Conversants: []string{conversants[2].ID}},
+	}
+
+	for i, resp := range responses {
+		for _, expected := range []connection.ResponseType{connection.NewMessage, connection.ConversationUpdated} {
+			select {
+			case response := <-resp:
+				if response.Type != expected {
+					t.Fatalf("conversant %d expected response %d, received %+v", i, expected, response)
+				}
+
+				if expected != connection.ConversationUpdated {
+					continue
+				}
+
+				if (i == 0) != (response.RequestID == "test") {
+					t.Fatalf("expected only the sender to receive the request ID, conversant %d received %q", i, response.RequestID)
+				}
+
+				updated := response.Data.(connection.ConversationUpdatedResponse)
+				if len(updated.Conversants) != 3 || len(updated.Added) != 1 || updated.Added[0] != conversants[2].ID {
+					t.Fatalf("expected conversant 2 to be added, received %+v", updated)
+				}
+			case <-time.After(time.Second):
+				t.Fatalf("conversant %d didn't receive response %d", i, expected)
+			}
+		}
+	}
+}
+
+func TestConnectionManager_WatchExpiryClosed(t *testing.T) {
+	manager := makeMockManager()
+
+	// nothing reads the connection's responses, like after it has gone away
+	conn := &connection.MockExpiringConn{
+		MockConn: makeConn(uuid.New()),
+		ExpiresAt: func() time.Time {
+			return time.Now().Add(-time.Second)
+		},
+	}
+	conn.Resp = func() chan connection.Response {
+		return make(chan connection.Response)
+	}
+
+	done := make(chan struct{})
+	returned := make(chan struct{})
+	go func() {
+		manager.watchExpiry(conn, conn, done)
+		close(returned)
+	}()
+
+	close(done)
+
+	select {
+	case <-returned:
+	case <-time.After(time.Second):
+		t.Fatal("watchExpiry blocked sending to a closed connection")
+	}
+}
+
+func TestConnectionManager_AuthExpiry(t *testing.T) {
+	defer func(warning time.Duration) {
+		authExpiryWarning = warning
+	}(authExpiryWarning)
+	authExpiryWarning = 300 * time.Millisecond
+
+	manager := makeMockManager()
+	manager.startup()
+
+	expiryMu := &sync.Mutex{}
+	expiry := time.Now().Add(500 * time.Millisecond)
+
+	requests := make(chan connection.Request)
+	resp := make(chan connection.Response, 1)
+	leave := make(chan struct{}, 1)
+
+	conn := &connection.MockExpiringConn{
+		MockConn: makeConn(uuid.New()),
+		ExpiresAt: func() time.Time {
+			expiryMu.Lock()
+			defer expiryMu.Unlock()
+			return expiry
+		},
+		Reauth: func(creds map[string]string) error {
+			if creds["access_token"] != "fresh" {
+				return errors.New("bad token")
+			}
+			expiryMu.Lock()
+			expiry = expiry.Add(500 * time.Millisecond)
+			expiryMu.Unlock()
+			return nil
+		},
+	}
+	conn.Request = func() chan connection.Request {
+		return requests
+	}
+	conn.Resp = func() chan connection.Response {
+		return resp
+	}
+	conn.Leaver = func() chan struct{} {
+		return leave
+	}
+	closed := make(chan struct{})
+	conn.Closer = func() {
+		close(closed)
+		leave <- struct{}{}
+	}
+
+	receive := func(expected connection.ResponseType) connection.Response {
+		t.Helper()
+		select {
+		case response := <-resp:
+			if response.Type != expected {
+				t.Fatalf("expected response type %d, received %+v", expected, response)
+			}
+			return response
+		case <-time.After(time.Second):
+			t.Fatalf("didn't receive response %d", expected)
+		}
+		return connection.Response{}
+	}
+
+	manager.addConn(conn)
+	receive(connection.AuthExpiring)
+
+	requests <- connection.Request{
+		Type:      connection.Reauthenticate,
+		RequestID: "stale",
+		Data:      connection.ReauthenticateRequest{Credentials: map[string]string{"access_token": "stale"}},
+	}
+
+	if code := receive(connection.Error).Data.(connection.ResponseError).Code; code != connection.CodeForbidden {
+		t.Fatalf("expected a failed reauthentication to be forbidden, received %q", code)
+	}
+
+	requests <- connection.Request{
+		Type:      connection.Reauthenticate,
+		RequestID: "fresh",
+		Data:      connection.ReauthenticateRequest{Credentials: map[string]string{"access_token": "fresh"}},
+	}
+
+	if response := receive(connection.Reauthenticated); response.RequestID != "fresh" {
+		t.Fatalf("expected the reauthentication to be acknowledged, received %+v", response)
+	}
+
+	// the warning for the new expiry comes, then the connection is closed when it passes
+	receive(connection.AuthExpiring)
+	if code := receive(connection.Error).Data.(connection.ResponseError).Code; code != connection.CodeAuthExpired {
+		t.Fatalf("expected code %s, received %q", connection.CodeAuthExpired, code)
+	}
+
+	if time.Now().Before(conn.Expiry()) {
+		t.Fatal("connection closed before it expired")
+	}
+
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Fatal("connection wasn't hung up")
+	}
+
+	for start := time.Now(); ; time.Sleep(10 * time.Millisecond) {
+		manager.connectionMu.RLock()
+		_, connected := manager.connections[conn.GetConversant().ID]
+		manager.connectionMu.RUnlock()
+
+		if !connected {
+			break
+		}
+
+		if time.Since(start) > time.Second {
+			t.Fatal("connection wasn't removed")
+		}
+	}
+}
+
+func TestConnectionManager_DeleteConversation(t *testing.T) {
+	store := memory.NewStore()
+	conversants := []repositories.Conversant{{ID: uuid.New(), Role: repositories.RoleOwner}, {ID: uuid.New()}, {ID: uuid.New()}}
+	for _, conversant := range conversants {
+		memory.NewConversantRepository(store).UpdateOrCreate(conversant)
+	}
+
+	conversationRepo := memory.NewConversationRepository(store)
+	conversation, err := conversationRepo.CreateConversation(repositories.Conversation{Name: "group", Conversants: conversants})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	manager := makeMockManager()
+	manager.startup()
+	manager.chatInteractor = newChatInteractor(memory.NewMessageRepository(store), conversationRepo, nil)
+
+	requests := make(chan connection.Request)
+	responses := make([]chan connection.Response, len(conversants))
+	for i, conversant := range conversants {
+		conn := makeConn(conversant.ID)
+		resp := make(chan connection.Response, 1)
+		conn.Resp = func() chan connection.Response {
+			return resp
+		}
+		if i == 0 {
+			conn.Request = func() chan connection.Request {
+				return requests
+			}
+		}
+		responses[i] = resp
+		manager.addConn(conn)
+	}
+
+	requests <- connection.Request{
+		Type:      connection.DeleteConversation,
+		RequestID: "test",
+		Data:      connection.DeleteConversationRequest{ConversationID: conversation.ID},
+	}
+
+	for i, resp := range responses {
+		select {
+		case response := <-resp:
+			if response.Type != connection.ConversationDeleted {
+				t.Fatalf("conversant %d expected ConversationDeleted, received %+v", i, response)
+			}
+
+			if (i == 0) != (response.RequestID == "test") {
+				t.Fatalf("expected only the sender to receive the request ID, conversant %d received %q", i, response.RequestID)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("conversant %d wasn't told the conversation was deleted", i)
+		}
+	}
+
+	if _, err = conversationRepo.RetrieveConversation(conversation.ID, 0, 0); err == nil {
+		t.Fatal("expected the conversation to be deleted")
+	}
+}
+
+func TestConnectionManager_Blocks(t *testing.T) {
+	store := memory.NewStore()
+	sender, blocker, muter, offlineMuter, offline := uuid.New(), uuid.New(), uuid.New(), uuid.New(), uuid.New()
+	var conversants []repositories.Conversant
+	for _, id := range []string{sender, blocker, muter, offlineMuter, offline} {
+		memory.NewConversantRepository(store).UpdateOrCreate(repositories.Conversant{ID: id})
+		conversants = append(conversants, repositories.Conversant{ID: id})
+	}
+
+	conversationRepo := memory.NewConversationRepository(store)
+	conversation, err := conversationRepo.CreateConversation(repositories.Conversation{Name: "group", Conversants: conversants})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	blockRepo := memory.NewBlockRepository(store)
+	blockRepo.Block(repositories.Block{BlockerID: blocker, BlockedID: sender})
+	blockRepo.Block(repositories.Block{BlockerID: muter, BlockedID: sender, Mute: true})
+	blockRepo.Block(repositories.Block{BlockerID: offlineMuter, BlockedID: sender, Mute: true})
+
+	manager := makeMockManager()
+	manager.startup()
+	manager.chatInteractor = newChatInteractor(memory.NewMessageRepository(store), repositories.NewMembershipCache(conversationRepo, time.Minute), nil)
+	manager.chatInteractor.blockRepo = blockRepo
+
+	notified := make(chan string, len(conversants))
+	manager.notifier = &operators.MockNotifier{
+		SendNotification: func(id string, message repositories.Message) error {
+			notified <- id
+			return nil
+		},
+	}
+
+	responses := make(map[string]chan connection.Response)
+	for _, id := range []string{sender, blocker, muter} {
+		conn := makeConn(id)
+		resp := make(chan connection.Response, 2)
+		conn.Resp = func() chan connection.Response {
+			return resp
+		}
+		responses[id] = resp
+		manager.addConn(conn)
+	}
+
+	manager.connectionMu.RLock()
+	conn := manager.connections[sender][0]
+	manager.connectionMu.RUnlock()
+
+	manager.sendMessage(conn, "test", connection.SendMessageRequest{ConversationID: conversation.ID, Message: "hi"})
+
+	for _, expected := range []connection.ResponseType{connection.NewMessage, connection.MessageAccepted} {
+		select {
+		case response := <-responses[sender]:
+			if response.Type != expected {
+				t.Fatalf("expected response %d, received %+v", expected, response)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("sender didn't receive response %d", expected)
+		}
+	}
+
+	if len(responses[muter]) != 1 {
+		t.Fatal("expected a conversant who muted the sender to still receive the message")
+	}
+
+	if len(responses[blocker]) != 0 {
+		t.Fatalf("expected a conversant who blocked the sender not to receive the message, received %+v", <-responses[blocker])
+	}
+
+	close(notified)
+	var pushed []string
+	for id := range notified {
+		pushed = append(pushed, id)
+	}
+
+	if len(pushed) != 1 || pushed[0] != offline {
+		t.Fatalf("expected only %s to be notified, received %v", offline, pushed)
+	}
+}
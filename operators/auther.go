@@ -4,17 +4,20 @@ import (
 	"github.com/ryan-berger/chatty/repositories"
 )
 
-// Auther Interface helps figure out if a conversation can be started
+// Auther Interface helps figure out if a conversation can be started. It is asked
+// with the conversants the conversation would have, including the creator, both
+// when a conversation is created and when conversants are added to it.
+// See the policy package for implementations
 type Auther interface {
-	CanStartConversation(conversation repositories.Conversation) bool
+	CanStartConversation(creatorID string, conversation repositories.Conversation) bool
 }
 
 // MockAuther operator for testing
 type MockAuther struct {
-	CanStartConvo func(repositories.Conversation) bool
+	CanStartConvo func(creatorID string, conversation repositories.Conversation) bool
 }
 
 // CanStartConversation calls function passed in from MockAuther for testing
-func (mock *MockAuther) CanStartConversation(conversation repositories.Conversation) bool {
-	return mock.CanStartConvo(conversation)
+func (mock *MockAuther) CanStartConversation(creatorID string, conversation repositories.Conversation) bool {
+	return mock.CanStartConvo(creatorID, conversation)
 }
@@ -0,0 +1,197 @@
+// Package policy has operators.Auther implementations that decide who can start
+// conversations with whom. They are meant to be composed with All and Any:
+//
+//	auther := policy.All(
+//		policy.MaxGroupSize(20),
+//		policy.TenantBoundary(tenantOf),
+//		blocklist,
+//	)
+package policy
+
+import (
+	"sync"
+
+	"github.com/ryan-berger/chatty/operators"
+	"github.com/ryan-berger/chatty/repositories"
+)
+
+// AutherFunc lets an ordinary function be used as an operators.Auther
+type AutherFunc func(creatorID string, conversation repositories.Conversation) bool
+
+// CanStartConversation calls fn
+func (fn AutherFunc) CanStartConversation(creatorID string, conversation repositories.Conversation) bool {
+	return fn(creatorID, conversation)
+}
+
+// AllowAll lets anyone start any conversation
+func AllowAll() operators.Auther {
+	return AutherFunc(func(string, repositories.Conversation) bool {
+		return true
+	})
+}
+
+// All allows a conversation only when every one of authers allows it
+func All(authers ...operators.Auther) operators.Auther {
+	return AutherFunc(func(creatorID string, conversation repositories.Conversation) bool {
+		for _, auther := range authers {
+			if !auther.CanStartConversation(creatorID, conversation) {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+// Any allows a conversation when at least one of authers allows it
+func Any(authers ...operators.Auther) operators.Auther {
+	return AutherFunc(func(creatorID string, conversation repositories.Conversation) bool {
+		for _, auther := range authers {
+			if auther.CanStartConversation(creatorID, conversation) {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// MaxGroupSize allows conversations with at most size conversants, including the creator
+func MaxGroupSize(size int) operators.Auther {
+	return AutherFunc(func(creatorID string, conversation repositories.Conversation) bool {
+		return len(conversation.Conversants) <= size
+	})
+}
+
+// TenantBoundary only allows conversations where every conversant is in the creator's
+// tenant. tenantOf looks up a conversant's tenant, and a failed lookup is a denial
+func TenantBoundary(tenantOf func(conversantID string) (string, error)) operators.Auther {
+	return AutherFunc(func(creatorID string, conversation repositories.Conversation) bool {
+		tenant, err := tenantOf(creatorID)
+		if err != nil {
+			return false
+		}
+
+		for _, conversant := range conversation.Conversants {
+			conversantTenant, err := tenantOf(conversant.ID)
+			if err != nil || conversantTenant != tenant {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+// Allowlist only lets the conversants on it start conversations.
+// It is safe for concurrent use
+type Allowlist struct {
+	mu      *sync.RWMutex
+	allowed map[string]bool
+}
+
+// NewAllowlist creates an Allowlist with the given conversants on it
+func NewAllowlist(conversantIDs ...string) *Allowlist {
+	list := &Allowlist{mu: &sync.RWMutex{}, allowed: make(map[string]bool)}
+	for _, conversantID := range conversantIDs {
+		list.allowed[conversantID] = true
+	}
+	return list
+}
+
+// Allow adds the conversant to the list
+func (list *Allowlist) Allow(conversantID string) {
+	list.mu.Lock()
+	list.allowed[conversantID] = true
+	list.mu.Unlock()
+}
+
+// Revoke takes the conversant off the list
+func (list *Allowlist) Revoke(conversantID string) {
+	list.mu.Lock()
+	delete(list.allowed, conversantID)
+	list.mu.Unlock()
+}
+
+// CanStartConversation allows the conversation if the creator is on the list
+func (list *Allowlist) CanStartConversation(creatorID string, conversation repositories.Conversation) bool {
+	list.mu.RLock()
+	defer list.mu.RUnlock()
+	return list.allowed[creatorID]
+}
+
+// Blocklist keeps conversants out of conversations with anyone who blocked them,
+// and out of every conversation once they are banned. It is safe for concurrent use
+type Blocklist struct {
+	mu      *sync.RWMutex
+	banned  map[string]bool
+	blocked map[string]map[string]bool
+}
+
+// NewBlocklist creates an empty Blocklist
+func NewBlocklist() *Blocklist {
+	return &Blocklist{
+		mu:      &sync.RWMutex{},
+		banned:  make(map[string]bool),
+		blocked: make(map[string]map[string]bool),
+	}
+}
+
+// Ban keeps the conversant out of every new conversation
+func (list *Blocklist) Ban(conversantID string) {
+	list.mu.Lock()
+	list.banned[conversantID] = true
+	list.mu.Unlock()
+}
+
+// Unban lifts a Ban
+func (list *Blocklist) Unban(conversantID string) {
+	list.mu.Lock()
+	delete(list.banned, conversantID)
+	list.mu.Unlock()
+}
+
+// Block keeps blockedID out of new conversations with blockerID
+func (list *Blocklist) Block(blockerID, blockedID string) {
+	list.mu.Lock()
+	defer list.mu.Unlock()
+
+	blocked, ok := list.blocked[blockerID]
+	if !ok {
+		blocked = make(map[string]bool)
+		list.blocked[blockerID] = blocked
+	}
+	blocked[blockedID] = true
+}
+
+// Unblock lifts a Block
+func (list *Blocklist) Unblock(blockerID, blockedID string) {
+	list.mu.Lock()
+	defer list.mu.Unlock()
+
+	delete(list.blocked[blockerID], blockedID)
+	if len(list.blocked[blockerID]) == 0 {
+		delete(list.blocked, blockerID)
+	}
+}
+
+// CanStartConversation denies the conversation if the creator or any conversant is
+// banned, or if any conversant has blocked another, whichever way round
+func (list *Blocklist) CanStartConversation(creatorID string, conversation repositories.Conversation) bool {
+	list.mu.RLock()
+	defer list.mu.RUnlock()
+
+	if list.banned[creatorID] {
+		return false
+	}
+
+	for _, conversant := range conversation.Conversants {
+		if list.banned[conversant.ID] || list.blocked[creatorID][conversant.ID] || list.blocked[conversant.ID][creatorID] {
+			return false
+		}
+
+		for _, other := range conversation.Conversants {
+			if list.blocked[conversant.ID][other.ID] {
+				return false
+			}
+		}
+	}
+	return true
+}
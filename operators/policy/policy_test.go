@@ -0,0 +1,125 @@
+package policy
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/ryan-berger/chatty/repositories"
+)
+
+func conversation(conversantIDs ...string) repositories.Conversation {
+	var conversation repositories.Conversation
+	for _, id := range conversantIDs {
+		conversation.Conversants = append(conversation.Conversants, repositories.Conversant{ID: id})
+	}
+	return conversation
+}
+
+func TestCompose(t *testing.T) {
+	deny := AutherFunc(func(string, repositories.Conversation) bool { return false })
+
+	if !All(AllowAll(), AllowAll()).CanStartConversation("a", conversation("a")) {
+		t.Fatal("expected All to allow when everything allows")
+	}
+
+	if All(AllowAll(), deny).CanStartConversation("a", conversation("a")) {
+		t.Fatal("expected All to deny when anything denies")
+	}
+
+	if !Any(deny, AllowAll()).CanStartConversation("a", conversation("a")) {
+		t.Fatal("expected Any to allow when anything allows")
+	}
+
+	if Any(deny, deny).CanStartConversation("a", conversation("a")) {
+		t.Fatal("expected Any to deny when everything denies")
+	}
+}
+
+func TestMaxGroupSize(t *testing.T) {
+	auther := MaxGroupSize(2)
+
+	if !auther.CanStartConversation("a", conversation("a", "b")) {
+		t.Fatal("expected a conversation at the limit to be allowed")
+	}
+
+	if auther.CanStartConversation("a", conversation("a", "b", "c")) {
+		t.Fatal("expected a conversation over the limit to be denied")
+	}
+}
+
+func TestTenantBoundary(t *testing.T) {
+	tenants := map[string]string{"a": "acme", "b": "acme", "c": "initech"}
+	auther := TenantBoundary(func(conversantID string) (string, error) {
+		tenant, ok := tenants[conversantID]
+		if !ok {
+			return "", errors.New("unknown conversant")
+		}
+		return tenant, nil
+	})
+
+	tests := []struct {
+		conversation repositories.Conversation
+		allowed      bool
+	}{
+		{conversation("a", "b"), true},
+		{conversation("a", "b", "c"), false},
+		{conversation("a", "d"), false},
+	}
+
+	for _, test := range tests {
+		if allowed := auther.CanStartConversation("a", test.conversation); allowed != test.allowed {
+			t.Fatalf("%+v: expected %v, received %v", test.conversation.Conversants, test.allowed, allowed)
+		}
+	}
+}
+
+func TestAllowlist(t *testing.T) {
+	list := NewAllowlist("a")
+
+	if !list.CanStartConversation("a", conversation("a", "b")) {
+		t.Fatal("expected a to be allowed")
+	}
+
+	if list.CanStartConversation("b", conversation("a", "b")) {
+		t.Fatal("expected b not to be allowed")
+	}
+
+	list.Allow("b")
+	list.Revoke("a")
+
+	if list.CanStartConversation("a", conversation("a", "b")) || !list.CanStartConversation("b", conversation("a", "b")) {
+		t.Fatal("expected allowing and revoking to swap who is allowed")
+	}
+}
+
+func TestBlocklist(t *testing.T) {
+	list := NewBlocklist()
+	list.Block("a", "b")
+
+	if list.CanStartConversation("a", conversation("a", "b")) || list.CanStartConversation("b", conversation("a", "b")) {
+		t.Fatal("expected a block to work whichever way round the conversation is started")
+	}
+
+	if list.CanStartConversation("c", conversation("a", "b", "c")) {
+		t.Fatal("expected a block to keep both conversants out of a group started by someone else")
+	}
+
+	if !list.CanStartConversation("a", conversation("a", "c")) {
+		t.Fatal("expected a to still talk to c")
+	}
+
+	list.Unblock("a", "b")
+	if !list.CanStartConversation("b", conversation("a", "b")) {
+		t.Fatal("expected unblocking to allow the conversation")
+	}
+
+	list.Ban("c")
+	if list.CanStartConversation("a", conversation("a", "c")) || list.CanStartConversation("c", conversation("c")) {
+		t.Fatal("expected a banned conversant to be kept out of every conversation")
+	}
+
+	list.Unban("c")
+	if !list.CanStartConversation("a", conversation("a", "c")) {
+		t.Fatal("expected unbanning to allow the conversation")
+	}
+}
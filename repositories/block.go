@@ -0,0 +1,48 @@
+package repositories
+
+// BlockRepo stores which conversants have blocked or muted each other. Blocking someone
+// again replaces the block, so that muting a blocked conversant unblocks them, and
+// Unblock removes either kind. IsBlocked reports whether either conversant has blocked
+// the other, ignoring mutes, GetBlockers returns every block on the conversant, and
+// GetBlocked returns every block the conversant has made
+type BlockRepo interface {
+	Block(block Block) error
+	Unblock(blockerID, blockedID string) error
+	IsBlocked(conversantID, otherID string) (bool, error)
+	GetBlockers(blockedID string) ([]Block, error)
+	GetBlocked(blockerID string) ([]Block, error)
+}
+
+// MockBlockRepo is a mock block repo for testing
+type MockBlockRepo struct {
+	Add     func(block Block) error
+	Remove  func(blockerID, blockedID string) error
+	Blocked func(conversantID, otherID string) (bool, error)
+	Blocks  func(blockedID string) ([]Block, error)
+	Blocker func(blockerID string) ([]Block, error)
+}
+
+// Block calls Add in the MockBlockRepo struct
+func (m *MockBlockRepo) Block(block Block) error {
+	return m.Add(block)
+}
+
+// Unblock calls Remove in the MockBlockRepo struct
+func (m *MockBlockRepo) Unblock(blockerID, blockedID string) error {
+	return m.Remove(blockerID, blockedID)
+}
+
+// IsBlocked calls Blocked in the MockBlockRepo struct
+func (m *MockBlockRepo) IsBlocked(conversantID, otherID string) (bool, error) {
+	return m.Blocked(conversantID, otherID)
+}
+
+// GetBlockers calls Blocks in the MockBlockRepo struct
+func (m *MockBlockRepo) GetBlockers(blockedID string) ([]Block, error) {
+	return m.Blocks(blockedID)
+}
+
+// GetBlocked calls Blocker in the MockBlockRepo struct
+func (m *MockBlockRepo) GetBlocked(blockerID string) ([]Block, error) {
+	return m.Blocker(blockerID)
+}
@@ -0,0 +1,138 @@
+package bolt
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/ryan-berger/chatty/repositories"
+	"go.etcd.io/bbolt"
+)
+
+// BlockRepository is a BlockRepo implementation that uses bbolt to store blocks
+type BlockRepository struct {
+	db *bbolt.DB
+}
+
+// NewBlockRepository creates a new bbolt BlockRepository
+func NewBlockRepository(db *bbolt.DB) *BlockRepository {
+	return &BlockRepository{
+		db: db,
+	}
+}
+
+// Block stores the block, replacing any the blocker already has on the same conversant
+func (repo *BlockRepository) Block(block repositories.Block) error {
+	value, err := json.Marshal(block)
+	if err != nil {
+		return err
+	}
+
+	return repo.db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket(blocksBucket).Put(blockKey(block.BlockedID, block.BlockerID), value)
+	})
+}
+
+// Unblock removes the blocker's block on the conversant, if there is one
+func (repo *BlockRepository) Unblock(blockerID, blockedID string) error {
+	return repo.db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket(blocksBucket).Delete(blockKey(blockedID, blockerID))
+	})
+}
+
+// IsBlocked reports whether either conversant has blocked the other
+func (repo *BlockRepository) IsBlocked(conversantID, otherID string) (bool, error) {
+	blocked := false
+
+	err := repo.db.View(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket(blocksBucket)
+		for _, key := range [][]byte{blockKey(conversantID, otherID), blockKey(otherID, conversantID)} {
+			value := bucket.Get(key)
+			if value == nil {
+				continue
+			}
+
+			var block repositories.Block
+			if err := json.Unmarshal(value, &block); err != nil {
+				return err
+			}
+
+			if !block.Mute {
+				blocked = true
+				return nil
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return blocked, nil
+}
+
+// GetBlockers returns every block on the conversant
+func (repo *BlockRepository) GetBlockers(blockedID string) ([]repositories.Block, error) {
+	var blocks []repositories.Block
+
+	err := repo.db.View(func(tx *bbolt.Tx) error {
+		prefix := blockKey(blockedID, "")
+		cursor := tx.Bucket(blocksBucket).Cursor()
+		for key, value := cursor.Seek(prefix); key != nil && bytes.HasPrefix(key, prefix); key, value = cursor.Next() {
+			var block repositories.Block
+			if err := json.Unmarshal(value, &block); err != nil {
+				return err
+			}
+			blocks = append(blocks, block)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return blocks, nil
+}
+
+// GetBlocked returns every block the conversant has made. Blocks are keyed
+// by who was blocked, so this reads through all of them
+func (repo *BlockRepository) GetBlocked(blockerID string) ([]repositories.Block, error) {
+	var blocks []repositories.Block
+
+	err := repo.db.View(func(tx *bbolt.Tx) error {
+		return tx.Bucket(blocksBucket).ForEach(func(key, value []byte) error {
+			var block repositories.Block
+			if err := json.Unmarshal(value, &block); err != nil {
+				return err
+			}
+
+			if block.BlockerID == blockerID {
+				blocks = append(blocks, block)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return blocks, nil
+}
+
+// hiddenFrom reports whether the reader blocked the message's sender. Mutes and system
+// messages aren't hidden, the same as when messages are delivered live
+func hiddenFrom(tx *bbolt.Tx, readerID string, message repositories.Message) (bool, error) {
+	if message.System {
+		return false, nil
+	}
+
+	value := tx.Bucket(blocksBucket).Get(blockKey(message.SenderID, readerID))
+	if value == nil {
+		return false, nil
+	}
+
+	var block repositories.Block
+	if err := json.Unmarshal(value, &block); err != nil {
+		return false, err
+	}
+	return !block.Mute, nil
+}
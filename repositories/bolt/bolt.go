@@ -0,0 +1,148 @@
+package bolt
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/ryan-berger/chatty/repositories"
+	"go.etcd.io/bbolt"
+)
+
+var (
+	// ErrConversationNotFound is returned when a conversation ID isn't in the database
+	ErrConversationNotFound = errors.New("conversation not found")
+	// ErrConversantNotFound is returned when a conversant ID isn't in the database
+	ErrConversantNotFound = errors.New("conversant not found")
+)
+
+// The database is laid out as six top level buckets:
+//
+//	conversants:   conversant id -> Conversant
+//	conversations: conversation id -> conversation
+//	messages:      conversation id -> bucket of sequence -> Message
+//	idempotency:   sender id, 0, idempotency key -> conversation id, sequence
+//	memberships:   conversant id, 0, conversation id -> conversation id
+//	blocks:        blocked id, 0, blocker id -> Block
+//
+// Sequences are stored big endian, so each conversation's messages are kept
+// in order and pages of them are read with a cursor instead of a full scan.
+// Memberships share a prefix per conversant, so their conversations are found
+// with a prefix scan, and blocks share one per blocked conversant the same way
+var (
+	conversantsBucket   = []byte("conversants")
+	conversationsBucket = []byte("conversations")
+	messagesBucket      = []byte("messages")
+	idempotencyBucket   = []byte("idempotency")
+	membershipsBucket   = []byte("memberships")
+	blocksBucket        = []byte("blocks")
+)
+
+// conversation is how a conversation is stored. Conversants and messages
+// are kept in their own buckets and looked up by ID
+type conversation struct {
+	ID            string                       `json:"id"`
+	Name          string                       `json:"name"`
+	Direct        bool                         `json:"direct"`
+	ConversantIDs []string                     `json:"conversantIds"`
+	LastSequence  int64                        `json:"lastSequence"`
+	LastActivity  time.Time                    `json:"lastActivity"`
+	LastRead      map[string]int64             `json:"lastRead"`
+	Roles         map[string]repositories.Role `json:"roles"`
+}
+
+// role is the conversant's role in the conversation
+func (convo *conversation) role(conversantID string) repositories.Role {
+	return convo.Roles[conversantID].OrMember()
+}
+
+// setRole stores the conversant's role
+func (convo *conversation) setRole(conversantID string, role repositories.Role) {
+	if convo.Roles == nil {
+		convo.Roles = make(map[string]repositories.Role)
+	}
+	convo.Roles[conversantID] = role
+}
+
+// Open opens the bbolt database at path, creating it and its buckets if they don't exist
+func Open(path string) (*bbolt.DB, error) {
+	db, err := bbolt.Open(path, 0600, &bbolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Update(func(tx *bbolt.Tx) error {
+		for _, bucket := range [][]byte{conversantsBucket, conversationsBucket, messagesBucket, idempotencyBucket, membershipsBucket, blocksBucket} {
+			if _, err := tx.CreateBucketIfNotExists(bucket); err != nil {
+				return err
+			}
+		}
+		return backfillRoles(tx)
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return db, nil
+}
+
+// backfillRoles gives roles to groups stored before there were any. Like the SQL migrations,
+// the member with the lowest conversant ID is made the owner and everyone else is a member
+func backfillRoles(tx *bbolt.Tx) error {
+	var legacy []*conversation
+	err := tx.Bucket(conversationsBucket).ForEach(func(key, value []byte) error {
+		convo := &conversation{}
+		if err := json.Unmarshal(value, convo); err != nil {
+			return err
+		}
+
+		if convo.Roles == nil && !convo.Direct {
+			legacy = append(legacy, convo)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, convo := range legacy {
+		convo.Roles = make(map[string]repositories.Role)
+
+		var owner string
+		for _, id := range convo.ConversantIDs {
+			convo.Roles[id] = repositories.RoleMember
+			if owner == "" || id < owner {
+				owner = id
+			}
+		}
+
+		if owner != "" {
+			convo.Roles[owner] = repositories.RoleOwner
+		}
+
+		if err := putConversation(tx, convo); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func sequenceKey(sequence int64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, uint64(sequence))
+	return key
+}
+
+func idempotencyKey(senderID, key string) []byte {
+	return append(append([]byte(senderID), 0), key...)
+}
+
+func membershipKey(conversantID, conversationID string) []byte {
+	return append(append([]byte(conversantID), 0), conversationID...)
+}
+
+func blockKey(blockedID, blockerID string) []byte {
+	return append(append([]byte(blockedID), 0), blockerID...)
+}
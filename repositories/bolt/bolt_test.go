@@ -0,0 +1,245 @@
+package bolt
+
+import (
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/pborman/uuid"
+	"go.etcd.io/bbolt"
+
+	"github.com/ryan-berger/chatty/repositories"
+	"github.com/ryan-berger/chatty/repositories/repotest"
+)
+
+func openTestDB(t *testing.T) *bbolt.DB {
+	db, err := Open(filepath.Join(t.TempDir(), "chatty.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	return db
+}
+
+func createTestConversation(t *testing.T, db *bbolt.DB) (*repositories.Conversation, []repositories.Conversant) {
+	conversantRepo := NewConversantRepository(db)
+	conversants := []repositories.Conversant{
+		{ID: uuid.New(), DisplayName: "a"},
+		{ID: uuid.New(), DisplayName: "b"},
+	}
+
+	for _, conversant := range conversants {
+		if _, err := conversantRepo.UpdateOrCreate(conversant); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	conversation, err := NewConversationRepository(db).CreateConversation(repositories.Conversation{
+		Name:        "test",
+		Direct:      true,
+		Conversants: conversants,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return conversation, conversants
+}
+
+func TestConversantRepository_UpdateOrCreate(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewConversantRepository(db)
+
+	conversant := repositories.Conversant{ID: uuid.New(), DisplayName: "before"}
+	if _, err := repo.UpdateOrCreate(conversant); err != nil {
+		t.Fatal(err)
+	}
+
+	conversant.DisplayName = "after"
+	if _, err := repo.UpdateOrCreate(conversant); err != nil {
+		t.Fatal(err)
+	}
+
+	err := db.View(func(tx *bbolt.Tx) error {
+		conversants, err := getConversants(tx, &conversation{ConversantIDs: []string{conversant.ID}})
+		if err == nil && conversants[0].DisplayName != "after" {
+			t.Fatalf("expected display name after, received %s", conversants[0].DisplayName)
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestConversationRepository_RetrieveConversation(t *testing.T) {
+	db := openTestDB(t)
+	conversation, conversants := createTestConversation(t, db)
+
+	messageRepo := NewMessageRepository(db)
+	for i := 0; i < 5; i++ {
+		_, err := messageRepo.CreateMessage(repositories.Message{
+			SenderID:       conversants[0].ID,
+			ConversationID: conversation.ID,
+			Message:        "test",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	retrieved, err := NewConversationRepository(db).RetrieveConversation(conversation.ID, 2, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if retrieved.Name != "test" || !retrieved.Direct {
+		t.Fatalf("conversation retrieved incorrectly: %+v", retrieved)
+	}
+
+	if len(retrieved.Conversants) != 2 {
+		t.Fatalf("expected 2 conversants, received %d", len(retrieved.Conversants))
+	}
+
+	if len(retrieved.Messages) != 2 || retrieved.Messages[0].Sequence != 4 || retrieved.Messages[1].Sequence != 3 {
+		t.Fatalf("expected messages 4 and 3, received %+v", retrieved.Messages)
+	}
+}
+
+func TestMessageRepository_CreateMessage(t *testing.T) {
+	db := openTestDB(t)
+	conversation, conversants := createTestConversation(t, db)
+	repo := NewMessageRepository(db)
+
+	for i := int64(1); i <= 3; i++ {
+		message, err := repo.CreateMessage(repositories.Message{
+			SenderID:       conversants[i%2].ID,
+			ConversationID: conversation.ID,
+			Message:        "test",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if message.Sequence != i {
+			t.Fatalf("expected sequence %d, received %d", i, message.Sequence)
+		}
+	}
+
+	original, err := repo.CreateMessage(repositories.Message{
+		SenderID:       conversants[0].ID,
+		ConversationID: conversation.ID,
+		Message:        "test",
+		IdempotencyKey: "key",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	duplicate, err := repo.CreateMessage(repositories.Message{
+		ID:             uuid.New(),
+		SenderID:       conversants[0].ID,
+		ConversationID: conversation.ID,
+		Message:        "test",
+		IdempotencyKey: "key",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if duplicate.ID != original.ID || duplicate.Sequence != original.Sequence {
+		t.Fatalf("expected original message %+v, received %+v", original, duplicate)
+	}
+
+	messages, err := repo.GetMessagesAfter(conversation.ID, 2, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(messages) != 2 || messages[0].Sequence != 3 || messages[1].Sequence != 4 {
+		t.Fatalf("expected messages 3 and 4, received %+v", messages)
+	}
+}
+
+func TestOpen_BackfillRoles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "chatty.db")
+	db, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conversants := []repositories.Conversant{{ID: uuid.New()}, {ID: uuid.New()}, {ID: uuid.New()}}
+	for _, conversant := range conversants {
+		if _, err := NewConversantRepository(db).UpdateOrCreate(conversant); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	conversationRepo := NewConversationRepository(db)
+	group, err := conversationRepo.CreateConversation(repositories.Conversation{Name: "group", Conversants: conversants})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the highest conversant ID sends first, which shouldn't make them the owner
+	ids := []string{conversants[0].ID, conversants[1].ID, conversants[2].ID}
+	sort.Strings(ids)
+	_, err = NewMessageRepository(db).CreateMessage(repositories.Message{SenderID: ids[2], ConversationID: group.ID, Message: "test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// store the group the way it was before roles
+	err = db.Update(func(tx *bbolt.Tx) error {
+		convo, err := getConversation(tx, group.ID)
+		if err != nil {
+			return err
+		}
+		convo.Roles = nil
+		return putConversation(tx, convo)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	db, err = Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	retrieved, err := NewConversationRepository(db).GetConversants(group.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	roles := make(map[string]repositories.Role)
+	for _, conversant := range retrieved {
+		roles[conversant.ID] = conversant.Role
+	}
+
+	for _, id := range ids {
+		expected := repositories.RoleMember
+		if id == ids[0] {
+			expected = repositories.RoleOwner
+		}
+
+		if roles[id] != expected {
+			t.Fatalf("expected %s to be %s, received %v", id, expected, roles)
+		}
+	}
+}
+
+func TestConformance(t *testing.T) {
+	repotest.Run(t, func(t *testing.T) repotest.Repos {
+		db := openTestDB(t)
+		return repotest.Repos{
+			Messages:      NewMessageRepository(db),
+			Conversations: NewConversationRepository(db),
+			Conversants:   NewConversantRepository(db),
+			Blocks:        NewBlockRepository(db),
+		}
+	})
+}
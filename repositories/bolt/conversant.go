@@ -0,0 +1,57 @@
+package bolt
+
+import (
+	"encoding/json"
+
+	"github.com/ryan-berger/chatty/repositories"
+	"go.etcd.io/bbolt"
+)
+
+// ConversantRepository is a ConversantRepo implementation that uses bbolt to store conversants
+type ConversantRepository struct {
+	db *bbolt.DB
+}
+
+// NewConversantRepository creates a new bbolt ConversantRepository
+func NewConversantRepository(db *bbolt.DB) *ConversantRepository {
+	return &ConversantRepository{
+		db: db,
+	}
+}
+
+// UpdateOrCreate stores the conversant, replacing it if it already exists
+func (repo *ConversantRepository) UpdateOrCreate(conversant repositories.Conversant) (*repositories.Conversant, error) {
+	value, err := json.Marshal(conversant)
+	if err != nil {
+		return nil, err
+	}
+
+	err = repo.db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket(conversantsBucket).Put([]byte(conversant.ID), value)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &conversant, nil
+}
+
+// getConversants looks up every conversant in the conversation
+func getConversants(tx *bbolt.Tx, convo *conversation) ([]repositories.Conversant, error) {
+	bucket := tx.Bucket(conversantsBucket)
+	conversants := make([]repositories.Conversant, 0, len(convo.ConversantIDs))
+	for _, id := range convo.ConversantIDs {
+		value := bucket.Get([]byte(id))
+		if value == nil {
+			return nil, ErrConversantNotFound
+		}
+
+		var conversant repositories.Conversant
+		if err := json.Unmarshal(value, &conversant); err != nil {
+			return nil, err
+		}
+		conversant.Role = convo.role(id)
+		conversants = append(conversants, conversant)
+	}
+	return conversants, nil
+}
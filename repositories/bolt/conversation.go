@@ -0,0 +1,456 @@
+package bolt
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/pborman/uuid"
+	"github.com/ryan-berger/chatty/repositories"
+	"go.etcd.io/bbolt"
+)
+
+// ConversationRepository is an implementation of ConversationRepo
+// that uses bbolt as it's backend
+type ConversationRepository struct {
+	db *bbolt.DB
+}
+
+// NewConversationRepository creates a bbolt instance of a ConversationRepo
+func NewConversationRepository(db *bbolt.DB) *ConversationRepository {
+	return &ConversationRepository{
+		db: db,
+	}
+}
+
+// CreateConversation stores a conversation. Every conversant must already exist
+func (repo *ConversationRepository) CreateConversation(newConversation repositories.Conversation) (*repositories.Conversation, error) {
+	newConversation.ID = uuid.New()
+
+	convo := conversation{
+		ID:           newConversation.ID,
+		Name:         newConversation.Name,
+		Direct:       newConversation.Direct,
+		LastActivity: time.Now(),
+		LastRead:     make(map[string]int64),
+		Roles:        make(map[string]repositories.Role),
+	}
+	for _, conversant := range newConversation.Conversants {
+		convo.ConversantIDs = append(convo.ConversantIDs, conversant.ID)
+		convo.Roles[conversant.ID] = conversant.Role.OrMember()
+	}
+
+	err := repo.db.Update(func(tx *bbolt.Tx) error {
+		if _, err := getConversants(tx, &convo); err != nil {
+			return err
+		}
+
+		if _, err := tx.Bucket(messagesBucket).CreateBucket([]byte(convo.ID)); err != nil {
+			return err
+		}
+
+		for _, conversantID := range convo.ConversantIDs {
+			if err := tx.Bucket(membershipsBucket).Put(membershipKey(conversantID, convo.ID), []byte(convo.ID)); err != nil {
+				return err
+			}
+		}
+
+		return putConversation(tx, &convo)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &newConversation, nil
+}
+
+// RetrieveConversation returns the conversation with a page of its messages, newest first.
+// The page is read by walking backwards from the conversation's last message
+func (repo *ConversationRepository) RetrieveConversation(conversationID string, limit, offset int) (*repositories.Conversation, error) {
+	return repo.retrieveConversation(conversationID, func(cursor *bbolt.Cursor) ([]repositories.Message, error) {
+		_, value := cursor.Last()
+		for i := 0; i < offset && value != nil; i++ {
+			_, value = cursor.Prev()
+		}
+
+		return readMessages(value, cursor.Prev, limit)
+	})
+}
+
+// RetrieveConversationPage returns the conversation with up to limit messages on the given side of the cursor,
+// newest first. The page is read by seeking straight to the cursor's sequence
+func (repo *ConversationRepository) RetrieveConversationPage(conversationID string, page repositories.Cursor, limit int) (*repositories.Conversation, error) {
+	return repo.retrieveConversation(conversationID, func(cursor *bbolt.Cursor) ([]repositories.Message, error) {
+		if page.After > 0 {
+			_, value := cursor.Seek(sequenceKey(page.After + 1))
+			messages, err := readMessages(value, cursor.Next, limit)
+			for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+				messages[i], messages[j] = messages[j], messages[i]
+			}
+			return messages, err
+		}
+
+		if page.Before == 0 {
+			_, value := cursor.Last()
+			return readMessages(value, cursor.Prev, limit)
+		}
+
+		// Seek lands on the first message at or after Before, so step back once to get below it
+		key, _ := cursor.Seek(sequenceKey(page.Before))
+		var value []byte
+		if key == nil {
+			_, value = cursor.Last()
+		} else {
+			_, value = cursor.Prev()
+		}
+		return readMessages(value, cursor.Prev, limit)
+	})
+}
+
+func (repo *ConversationRepository) retrieveConversation(conversationID string, page func(*bbolt.Cursor) ([]repositories.Message, error)) (*repositories.Conversation, error) {
+	var retrieved *repositories.Conversation
+
+	err := repo.db.View(func(tx *bbolt.Tx) error {
+		convo, err := getConversation(tx, conversationID)
+		if err != nil {
+			return err
+		}
+
+		conversants, err := getConversants(tx, convo)
+		if err != nil {
+			return err
+		}
+
+		messages, err := page(tx.Bucket(messagesBucket).Bucket([]byte(conversationID)).Cursor())
+		if err != nil {
+			return err
+		}
+
+		retrieved = &repositories.Conversation{
+			ID:          convo.ID,
+			Name:        convo.Name,
+			Direct:      convo.Direct,
+			Conversants: conversants,
+			Messages:    messages,
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return retrieved, nil
+}
+
+// readMessages decodes up to limit messages, starting with value and moving the cursor with step
+func readMessages(value []byte, step func() ([]byte, []byte), limit int) ([]repositories.Message, error) {
+	var messages []repositories.Message
+	for ; value != nil && len(messages) < limit; _, value = step() {
+		var message repositories.Message
+		if err := json.Unmarshal(value, &message); err != nil {
+			return nil, err
+		}
+		messages = append(messages, message)
+	}
+	return messages, nil
+}
+
+// GetConversants gets the conversants for a given conversation
+func (repo *ConversationRepository) GetConversants(conversationID string) ([]repositories.Conversant, error) {
+	var conversants []repositories.Conversant
+
+	err := repo.db.View(func(tx *bbolt.Tx) error {
+		convo, err := getConversation(tx, conversationID)
+		if err != nil {
+			return err
+		}
+
+		conversants, err = getConversants(tx, convo)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return conversants, nil
+}
+
+// ListConversations returns a page of the conversant's conversations, most recently active first
+func (repo *ConversationRepository) ListConversations(conversantID string, limit, offset int) ([]repositories.ConversationSummary, error) {
+	var summaries []repositories.ConversationSummary
+
+	err := repo.db.View(func(tx *bbolt.Tx) error {
+		prefix := membershipKey(conversantID, "")
+		cursor := tx.Bucket(membershipsBucket).Cursor()
+		for key, conversationID := cursor.Seek(prefix); key != nil && bytes.HasPrefix(key, prefix); key, conversationID = cursor.Next() {
+			convo, err := getConversation(tx, string(conversationID))
+			if err != nil {
+				return err
+			}
+
+			summary := repositories.ConversationSummary{
+				ID:           convo.ID,
+				Name:         convo.Name,
+				Direct:       convo.Direct,
+				LastActivity: convo.LastActivity,
+			}
+
+			if err = summarizeMessages(tx, convo, conversantID, &summary); err != nil {
+				return err
+			}
+
+			summaries = append(summaries, summary)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(summaries, func(i, j int) bool {
+		if !summaries[i].LastActivity.Equal(summaries[j].LastActivity) {
+			return summaries[i].LastActivity.After(summaries[j].LastActivity)
+		}
+		return summaries[i].ID < summaries[j].ID
+	})
+
+	if offset < 0 || offset > len(summaries) {
+		offset = len(summaries)
+	}
+	summaries = summaries[offset:]
+	if len(summaries) > limit {
+		summaries = summaries[:limit]
+	}
+
+	return summaries, nil
+}
+
+// summarizeMessages fills in the summary's last message and unread count. Messages from
+// conversants the reader blocked are neither, so it walks back from the newest message
+// until it has found both the last message and the reader's read position
+func summarizeMessages(tx *bbolt.Tx, convo *conversation, readerID string, summary *repositories.ConversationSummary) error {
+	messages := tx.Bucket(messagesBucket).Bucket([]byte(convo.ID))
+	if messages == nil {
+		return nil
+	}
+
+	lastRead := convo.LastRead[readerID]
+	cursor := messages.Cursor()
+	for key, value := cursor.Last(); key != nil; key, value = cursor.Prev() {
+		var message repositories.Message
+		if err := json.Unmarshal(value, &message); err != nil {
+			return err
+		}
+
+		if message.Sequence <= lastRead && summary.LastMessage != nil {
+			break
+		}
+
+		hidden, err := hiddenFrom(tx, readerID, message)
+		if err != nil {
+			return err
+		}
+
+		if hidden {
+			continue
+		}
+
+		if message.Sequence > lastRead {
+			summary.UnreadCount++
+		}
+
+		if summary.LastMessage == nil {
+			summary.LastMessage = &message
+		}
+	}
+	return nil
+}
+
+// MarkRead moves the conversant's read position in the conversation forward to sequence
+func (repo *ConversationRepository) MarkRead(conversationID, conversantID string, sequence int64) error {
+	return repo.db.Update(func(tx *bbolt.Tx) error {
+		convo, err := getConversation(tx, conversationID)
+		if err != nil {
+			return err
+		}
+
+		if tx.Bucket(membershipsBucket).Get(membershipKey(conversantID, conversationID)) == nil ||
+			sequence <= convo.LastRead[conversantID] {
+			return nil
+		}
+
+		if convo.LastRead == nil {
+			convo.LastRead = make(map[string]int64)
+		}
+		convo.LastRead[conversantID] = sequence
+		return putConversation(tx, convo)
+	})
+}
+
+// AddConversants adds the conversants to the conversation. Every conversant must already exist
+func (repo *ConversationRepository) AddConversants(conversationID string, conversants []repositories.Conversant) error {
+	return repo.db.Update(func(tx *bbolt.Tx) error {
+		convo, err := getConversation(tx, conversationID)
+		if err != nil {
+			return err
+		}
+
+		if convo.LastRead == nil {
+			convo.LastRead = make(map[string]int64)
+		}
+
+		memberships := tx.Bucket(membershipsBucket)
+		for _, conversant := range conversants {
+			if tx.Bucket(conversantsBucket).Get([]byte(conversant.ID)) == nil {
+				return ErrConversantNotFound
+			}
+
+			key := membershipKey(conversant.ID, conversationID)
+			if memberships.Get(key) != nil {
+				continue
+			}
+
+			if err = memberships.Put(key, []byte(conversationID)); err != nil {
+				return err
+			}
+			convo.setRole(conversant.ID, conversant.Role.OrMember())
+			convo.ConversantIDs = append(convo.ConversantIDs, conversant.ID)
+			convo.LastRead[conversant.ID] = convo.LastSequence
+		}
+
+		return putConversation(tx, convo)
+	})
+}
+
+// RemoveConversants removes the conversants from the conversation
+func (repo *ConversationRepository) RemoveConversants(conversationID string, conversantIDs []string) error {
+	return repo.db.Update(func(tx *bbolt.Tx) error {
+		convo, err := getConversation(tx, conversationID)
+		if err != nil {
+			return err
+		}
+
+		for _, conversantID := range conversantIDs {
+			if err = tx.Bucket(membershipsBucket).Delete(membershipKey(conversantID, conversationID)); err != nil {
+				return err
+			}
+
+			for i, id := range convo.ConversantIDs {
+				if id == conversantID {
+					convo.ConversantIDs = append(convo.ConversantIDs[:i], convo.ConversantIDs[i+1:]...)
+					delete(convo.LastRead, conversantID)
+					delete(convo.Roles, conversantID)
+					break
+				}
+			}
+		}
+
+		return putConversation(tx, convo)
+	})
+}
+
+// SetRole changes the conversant's role in the conversation
+func (repo *ConversationRepository) SetRole(conversationID, conversantID string, role repositories.Role) error {
+	return repo.db.Update(func(tx *bbolt.Tx) error {
+		convo, err := getConversation(tx, conversationID)
+		if err != nil {
+			return err
+		}
+
+		if tx.Bucket(membershipsBucket).Get(membershipKey(conversantID, conversationID)) == nil {
+			return nil
+		}
+
+		convo.setRole(conversantID, role)
+		return putConversation(tx, convo)
+	})
+}
+
+// RenameConversation changes the conversation's name
+func (repo *ConversationRepository) RenameConversation(conversationID, name string) error {
+	return repo.db.Update(func(tx *bbolt.Tx) error {
+		convo, err := getConversation(tx, conversationID)
+		if err != nil {
+			return err
+		}
+
+		convo.Name = name
+		return putConversation(tx, convo)
+	})
+}
+
+// DeleteConversation deletes the conversation, along with its messages,
+// the idempotency keys they were sent with, and its memberships
+func (repo *ConversationRepository) DeleteConversation(conversationID string) error {
+	return repo.db.Update(func(tx *bbolt.Tx) error {
+		convo, err := getConversation(tx, conversationID)
+		if err != nil {
+			return err
+		}
+
+		messages := tx.Bucket(messagesBucket).Bucket([]byte(conversationID))
+		err = messages.ForEach(func(_, value []byte) error {
+			var message repositories.Message
+			if err := json.Unmarshal(value, &message); err != nil {
+				return err
+			}
+
+			if message.IdempotencyKey == "" {
+				return nil
+			}
+			return tx.Bucket(idempotencyBucket).Delete(idempotencyKey(message.SenderID, message.IdempotencyKey))
+		})
+		if err != nil {
+			return err
+		}
+
+		if err = tx.Bucket(messagesBucket).DeleteBucket([]byte(conversationID)); err != nil {
+			return err
+		}
+
+		for _, conversantID := range convo.ConversantIDs {
+			if err = tx.Bucket(membershipsBucket).Delete(membershipKey(conversantID, conversationID)); err != nil {
+				return err
+			}
+		}
+
+		return tx.Bucket(conversationsBucket).Delete([]byte(conversationID))
+	})
+}
+
+func getConversation(tx *bbolt.Tx, conversationID string) (*conversation, error) {
+	value := tx.Bucket(conversationsBucket).Get([]byte(conversationID))
+	if value == nil {
+		return nil, ErrConversationNotFound
+	}
+
+	var convo conversation
+	if err := json.Unmarshal(value, &convo); err != nil {
+		return nil, err
+	}
+	return &convo, nil
+}
+
+func putConversation(tx *bbolt.Tx, convo *conversation) error {
+	value, err := json.Marshal(convo)
+	if err != nil {
+		return err
+	}
+	return tx.Bucket(conversationsBucket).Put([]byte(convo.ID), value)
+}
+
+// IsConversant reports whether the conversant is in the conversation
+func (repo *ConversationRepository) IsConversant(conversationID, conversantID string) (bool, error) {
+	var member bool
+
+	err := repo.db.View(func(tx *bbolt.Tx) error {
+		member = tx.Bucket(membershipsBucket).Get(membershipKey(conversantID, conversationID)) != nil
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return member, nil
+}
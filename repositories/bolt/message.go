@@ -0,0 +1,124 @@
+package bolt
+
+import (
+	"time"
+
+	"encoding/json"
+
+	"github.com/pborman/uuid"
+	"github.com/ryan-berger/chatty/repositories"
+	"go.etcd.io/bbolt"
+)
+
+// MessageRepository is a MessageRepo implementation that uses bbolt to store messages
+type MessageRepository struct {
+	db *bbolt.DB
+}
+
+// NewMessageRepository creates a new bbolt MessageRepository
+func NewMessageRepository(db *bbolt.DB) *MessageRepository {
+	return &MessageRepository{
+		db: db,
+	}
+}
+
+// CreateMessage stores a message at the end of its conversation. bbolt only runs one
+// write transaction at a time, so concurrent messages are numbered one after another.
+// When the sender has already used the message's idempotency key, the original
+// message is returned instead
+func (repo *MessageRepository) CreateMessage(message repositories.Message) (*repositories.Message, error) {
+	if message.ID == "" {
+		message.ID = uuid.New()
+	}
+
+	err := repo.db.Update(func(tx *bbolt.Tx) error {
+		key := idempotencyKey(message.SenderID, message.IdempotencyKey)
+		if message.IdempotencyKey != "" {
+			if location := tx.Bucket(idempotencyBucket).Get(key); location != nil {
+				idLength := len(location) - 8
+				return getMessage(tx, string(location[:idLength]), location[idLength:], &message)
+			}
+		}
+
+		convo, err := getConversation(tx, message.ConversationID)
+		if err != nil {
+			return err
+		}
+
+		if tx.Bucket(conversantsBucket).Get([]byte(message.SenderID)) == nil {
+			return ErrConversantNotFound
+		}
+
+		convo.LastSequence++
+		convo.LastActivity = time.Now()
+		message.Sequence = convo.LastSequence
+		if err = putConversation(tx, convo); err != nil {
+			return err
+		}
+
+		value, err := json.Marshal(message)
+		if err != nil {
+			return err
+		}
+
+		sequence := sequenceKey(message.Sequence)
+		err = tx.Bucket(messagesBucket).Bucket([]byte(message.ConversationID)).Put(sequence, value)
+		if err != nil {
+			return err
+		}
+
+		if message.IdempotencyKey == "" {
+			return nil
+		}
+
+		location := append([]byte(message.ConversationID), sequence...)
+		return tx.Bucket(idempotencyBucket).Put(key, location)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &message, nil
+}
+
+// GetMessagesAfter returns up to limit messages in the conversation after the given sequence
+func (repo *MessageRepository) GetMessagesAfter(conversationID string, sequence int64, limit int) ([]repositories.Message, error) {
+	if sequence < 0 {
+		sequence = 0
+	}
+
+	var messages []repositories.Message
+
+	err := repo.db.View(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket(messagesBucket).Bucket([]byte(conversationID))
+		if bucket == nil {
+			return ErrConversationNotFound
+		}
+
+		cursor := bucket.Cursor()
+		for _, value := cursor.Seek(sequenceKey(sequence + 1)); value != nil && len(messages) < limit; _, value = cursor.Next() {
+			var message repositories.Message
+			if err := json.Unmarshal(value, &message); err != nil {
+				return err
+			}
+			messages = append(messages, message)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return messages, nil
+}
+
+func getMessage(tx *bbolt.Tx, conversationID string, sequence []byte, message *repositories.Message) error {
+	value := tx.Bucket(messagesBucket).Bucket([]byte(conversationID)).Get(sequence)
+	if value == nil {
+		return ErrConversationNotFound
+	}
+
+	*message = repositories.Message{}
+	return json.Unmarshal(value, message)
+}
@@ -1,17 +1,46 @@
 package repositories
 
-// ConversationRepo is a way for the connection manager to store conversations
+// ConversationRepo is a way for the connection manager to store conversations.
+// RetrieveConversation and RetrieveConversationPage both return messages newest first.
+// ListConversations returns a conversant's conversations, most recently active first, and
+// leaves messages from conversants they blocked out of the last message and unread count,
+// other than mutes and system messages. MarkRead moves the conversant's read position
+// forward to sequence.
+// AddConversants skips conversants who are already members, and starts the
+// new members' read positions at the conversation's latest message.
+// IsConversant reports false, rather than an error, for unknown conversations.
+// Conversants are stored with their Role, or as members when it isn't set, and
+// SetRole does nothing for conversants outside the conversation. DeleteConversation
+// deletes the conversation's messages and memberships along with it
 type ConversationRepo interface {
 	CreateConversation(conversation Conversation) (*Conversation, error)
 	RetrieveConversation(conversationID string, limit, offset int) (*Conversation, error)
+	RetrieveConversationPage(conversationID string, cursor Cursor, limit int) (*Conversation, error)
 	GetConversants(conversationID string) ([]Conversant, error)
+	ListConversations(conversantID string, limit, offset int) ([]ConversationSummary, error)
+	MarkRead(conversationID, conversantID string, sequence int64) error
+	AddConversants(conversationID string, conversants []Conversant) error
+	RemoveConversants(conversationID string, conversantIDs []string) error
+	IsConversant(conversationID, conversantID string) (bool, error)
+	SetRole(conversationID, conversantID string, role Role) error
+	RenameConversation(conversationID, name string) error
+	DeleteConversation(conversationID string) error
 }
 
 // MockConversationRepo is a mock conversation repo for testing
 type MockConversationRepo struct {
 	CreateConvo   func(conversation Conversation) (*Conversation, error)
 	RetrieveConvo func(conversationId string, limit, offset int) (*Conversation, error)
+	RetrievePage  func(conversationId string, cursor Cursor, limit int) (*Conversation, error)
 	GetConvo      func(conversationId string) ([]Conversant, error)
+	ListConvos    func(conversantID string, limit, offset int) ([]ConversationSummary, error)
+	MarkConvoRead func(conversationID, conversantID string, sequence int64) error
+	AddMembers    func(conversationID string, conversants []Conversant) error
+	RemoveMembers func(conversationID string, conversantIDs []string) error
+	IsMember      func(conversationID, conversantID string) (bool, error)
+	SetMemberRole func(conversationID, conversantID string, role Role) error
+	RenameConvo   func(conversationID, name string) error
+	DeleteConvo   func(conversationID string) error
 }
 
 // CreateConversation calls CreateConvo inside of the MockConversationRepo struct
@@ -24,16 +53,67 @@ func (m *MockConversationRepo) RetrieveConversation(conversationID string, limit
 	return m.RetrieveConvo(conversationID, limit, offset)
 }
 
+// RetrieveConversationPage calls RetrievePage in the MockConversationRepo struct
+func (m *MockConversationRepo) RetrieveConversationPage(conversationID string, cursor Cursor, limit int) (*Conversation, error) {
+	return m.RetrievePage(conversationID, cursor, limit)
+}
+
 // GetConversants calls GetConvo in the MockConversationRepo struct
 func (m *MockConversationRepo) GetConversants(conversationID string) ([]Conversant, error) {
 	return m.GetConvo(conversationID)
 }
 
+// ListConversations calls ListConvos in the MockConversationRepo struct
+func (m *MockConversationRepo) ListConversations(conversantID string, limit, offset int) ([]ConversationSummary, error) {
+	return m.ListConvos(conversantID, limit, offset)
+}
+
+// MarkRead calls MarkConvoRead in the MockConversationRepo struct
+func (m *MockConversationRepo) MarkRead(conversationID, conversantID string, sequence int64) error {
+	return m.MarkConvoRead(conversationID, conversantID, sequence)
+}
+
+// AddConversants calls AddMembers in the MockConversationRepo struct
+func (m *MockConversationRepo) AddConversants(conversationID string, conversants []Conversant) error {
+	return m.AddMembers(conversationID, conversants)
+}
+
+// RemoveConversants calls RemoveMembers in the MockConversationRepo struct
+func (m *MockConversationRepo) RemoveConversants(conversationID string, conversantIDs []string) error {
+	return m.RemoveMembers(conversationID, conversantIDs)
+}
+
+// IsConversant calls IsMember in the MockConversationRepo struct
+func (m *MockConversationRepo) IsConversant(conversationID, conversantID string) (bool, error) {
+	return m.IsMember(conversationID, conversantID)
+}
+
+// SetRole calls SetMemberRole in the MockConversationRepo struct
+func (m *MockConversationRepo) SetRole(conversationID, conversantID string, role Role) error {
+	return m.SetMemberRole(conversationID, conversantID, role)
+}
+
+// RenameConversation calls RenameConvo in the MockConversationRepo struct
+func (m *MockConversationRepo) RenameConversation(conversationID, name string) error {
+	return m.RenameConvo(conversationID, name)
+}
+
+// DeleteConversation calls DeleteConvo in the MockConversationRepo struct
+func (m *MockConversationRepo) DeleteConversation(conversationID string) error {
+	return m.DeleteConvo(conversationID)
+}
+
 // NewDefaultMockRepo creates a mock repo that will return
 func DefaultMockConversationRepo() ConversationRepo {
 	return &MockConversationRepo{
 		CreateConvo: func(conversation Conversation) (*Conversation, error) {
 			return &conversation, nil
 		},
+		MarkConvoRead: func(conversationID, conversantID string, sequence int64) error {
+			return nil
+		},
+		IsMember: func(conversationID, conversantID string) (bool, error) {
+			return true, nil
+		},
 	}
 }
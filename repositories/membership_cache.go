@@ -0,0 +1,218 @@
+package repositories
+
+import (
+	"sync"
+	"time"
+)
+
+type membership struct {
+	member  bool
+	expires time.Time
+}
+
+type cachedConversants struct {
+	conversants []Conversant
+	expires     time.Time
+}
+
+// MembershipCache is a ConversationRepo that caches IsConversant and GetConversants lookups,
+// since they happen on every message sent. Changes made through the cache invalidate it right away,
+// and changes made elsewhere, like by another server, are seen once ttl has passed.
+// Invalidating a conversation bumps the generation of any lookups in flight for it,
+// so a lookup that raced a change isn't cached
+type MembershipCache struct {
+	ConversationRepo
+	ttl         time.Duration
+	mu          *sync.RWMutex
+	memberships map[string]map[string]membership
+	conversants map[string]cachedConversants
+	lookups     map[string]*lookups
+	nextSweep   time.Time
+}
+
+// lookups tracks the lookups in flight for a conversation. It is only kept while
+// there are some, so conversations don't stay in the cache once nothing is cached for them
+type lookups struct {
+	generation uint64
+	pending    int
+}
+
+// NewMembershipCache wraps repo, caching membership lookups for ttl
+func NewMembershipCache(repo ConversationRepo, ttl time.Duration) *MembershipCache {
+	return &MembershipCache{
+		ConversationRepo: repo,
+		ttl:              ttl,
+		mu:               &sync.RWMutex{},
+		memberships:      make(map[string]map[string]membership),
+		conversants:      make(map[string]cachedConversants),
+		lookups:          make(map[string]*lookups),
+	}
+}
+
+// IsConversant reports whether the conversant is in the conversation,
+// only asking the wrapped repo when there isn't a fresh cached answer
+func (cache *MembershipCache) IsConversant(conversationID, conversantID string) (bool, error) {
+	cache.mu.RLock()
+	cached, ok := cache.memberships[conversationID][conversantID]
+	cache.mu.RUnlock()
+
+	if ok && time.Now().Before(cached.expires) {
+		return cached.member, nil
+	}
+
+	generation := cache.startLookup(conversationID)
+	member, err := cache.ConversationRepo.IsConversant(conversationID, conversantID)
+
+	now := time.Now()
+
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	// the conversation changed during the lookup, so member may already be wrong
+	if !cache.endLookup(conversationID, generation) || err != nil {
+		return member, err
+	}
+	cache.sweep(now)
+
+	conversation, ok := cache.memberships[conversationID]
+	if !ok {
+		conversation = make(map[string]membership)
+		cache.memberships[conversationID] = conversation
+	}
+
+	conversation[conversantID] = membership{member: member, expires: now.Add(cache.ttl)}
+
+	return member, nil
+}
+
+// GetConversants returns the conversation's conversants, with their roles,
+// only asking the wrapped repo when there isn't a fresh cached answer
+func (cache *MembershipCache) GetConversants(conversationID string) ([]Conversant, error) {
+	cache.mu.RLock()
+	cached, ok := cache.conversants[conversationID]
+	cache.mu.RUnlock()
+
+	if ok && time.Now().Before(cached.expires) {
+		return append([]Conversant(nil), cached.conversants...), nil
+	}
+
+	generation := cache.startLookup(conversationID)
+	conversants, err := cache.ConversationRepo.GetConversants(conversationID)
+
+	now := time.Now()
+
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	// the conversation changed during the lookup, so conversants may already be wrong
+	if !cache.endLookup(conversationID, generation) || err != nil {
+		return conversants, err
+	}
+	cache.sweep(now)
+
+	cache.conversants[conversationID] = cachedConversants{
+		conversants: append([]Conversant(nil), conversants...),
+		expires:     now.Add(cache.ttl),
+	}
+
+	return conversants, nil
+}
+
+// startLookup records a lookup in flight for the conversation, returning its generation
+func (cache *MembershipCache) startLookup(conversationID string) uint64 {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	inFlight, ok := cache.lookups[conversationID]
+	if !ok {
+		inFlight = &lookups{}
+		cache.lookups[conversationID] = inFlight
+	}
+	inFlight.pending++
+	return inFlight.generation
+}
+
+// endLookup records that a lookup started at generation is done, and reports whether the
+// conversation is unchanged since, so that it can be cached. The caller must hold mu
+func (cache *MembershipCache) endLookup(conversationID string, generation uint64) bool {
+	inFlight := cache.lookups[conversationID]
+	inFlight.pending--
+	if inFlight.pending == 0 {
+		delete(cache.lookups, conversationID)
+	}
+	return inFlight.generation == generation
+}
+
+// sweep drops every expired entry once per ttl, so that conversations and conversants
+// nobody looks up again don't stay cached forever. The caller must hold mu
+func (cache *MembershipCache) sweep(now time.Time) {
+	if now.Before(cache.nextSweep) {
+		return
+	}
+
+	for conversationID, conversation := range cache.memberships {
+		for conversantID, cached := range conversation {
+			if !now.Before(cached.expires) {
+				delete(conversation, conversantID)
+			}
+		}
+
+		if len(conversation) == 0 {
+			delete(cache.memberships, conversationID)
+		}
+	}
+
+	for conversationID, cached := range cache.conversants {
+		if !now.Before(cached.expires) {
+			delete(cache.conversants, conversationID)
+		}
+	}
+
+	cache.nextSweep = now.Add(cache.ttl)
+}
+
+// CreateConversation creates the conversation with the wrapped repo, then forgets any
+// memberships cached for its ID, like lookups made before it existed
+func (cache *MembershipCache) CreateConversation(conversation Conversation) (*Conversation, error) {
+	created, err := cache.ConversationRepo.CreateConversation(conversation)
+	if err != nil {
+		return nil, err
+	}
+
+	cache.invalidate(created.ID)
+	return created, nil
+}
+
+// AddConversants adds the conversants with the wrapped repo, then forgets the conversation's memberships
+func (cache *MembershipCache) AddConversants(conversationID string, conversants []Conversant) error {
+	defer cache.invalidate(conversationID)
+	return cache.ConversationRepo.AddConversants(conversationID, conversants)
+}
+
+// RemoveConversants removes the conversants with the wrapped repo, then forgets the conversation's memberships
+func (cache *MembershipCache) RemoveConversants(conversationID string, conversantIDs []string) error {
+	defer cache.invalidate(conversationID)
+	return cache.ConversationRepo.RemoveConversants(conversationID, conversantIDs)
+}
+
+// SetRole sets the role with the wrapped repo, then forgets the conversation's memberships
+func (cache *MembershipCache) SetRole(conversationID, conversantID string, role Role) error {
+	defer cache.invalidate(conversationID)
+	return cache.ConversationRepo.SetRole(conversationID, conversantID, role)
+}
+
+// DeleteConversation deletes the conversation with the wrapped repo, then forgets its memberships
+func (cache *MembershipCache) DeleteConversation(conversationID string) error {
+	defer cache.invalidate(conversationID)
+	return cache.ConversationRepo.DeleteConversation(conversationID)
+}
+
+func (cache *MembershipCache) invalidate(conversationID string) {
+	cache.mu.Lock()
+	delete(cache.memberships, conversationID)
+	delete(cache.conversants, conversationID)
+	if inFlight, ok := cache.lookups[conversationID]; ok {
+		inFlight.generation++
+	}
+	cache.mu.Unlock()
+}
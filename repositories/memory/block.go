@@ -0,0 +1,83 @@
+package memory
+
+import (
+	"github.com/ryan-berger/chatty/repositories"
+)
+
+// BlockRepository is a BlockRepo implementation that keeps blocks in memory
+type BlockRepository struct {
+	store *Store
+}
+
+// NewBlockRepository creates a new memory BlockRepository
+func NewBlockRepository(store *Store) *BlockRepository {
+	return &BlockRepository{
+		store: store,
+	}
+}
+
+// Block stores the block, replacing any the blocker already has on the same conversant
+func (repo *BlockRepository) Block(block repositories.Block) error {
+	repo.store.mu.Lock()
+	defer repo.store.mu.Unlock()
+
+	blockers, ok := repo.store.blocks[block.BlockedID]
+	if !ok {
+		blockers = make(map[string]repositories.Block)
+		repo.store.blocks[block.BlockedID] = blockers
+	}
+
+	blockers[block.BlockerID] = block
+	return nil
+}
+
+// Unblock removes the blocker's block on the conversant, if there is one
+func (repo *BlockRepository) Unblock(blockerID, blockedID string) error {
+	repo.store.mu.Lock()
+	defer repo.store.mu.Unlock()
+
+	delete(repo.store.blocks[blockedID], blockerID)
+	if len(repo.store.blocks[blockedID]) == 0 {
+		delete(repo.store.blocks, blockedID)
+	}
+	return nil
+}
+
+// IsBlocked reports whether either conversant has blocked the other
+func (repo *BlockRepository) IsBlocked(conversantID, otherID string) (bool, error) {
+	repo.store.mu.RLock()
+	defer repo.store.mu.RUnlock()
+
+	for _, pair := range [][2]string{{conversantID, otherID}, {otherID, conversantID}} {
+		if block, ok := repo.store.blocks[pair[1]][pair[0]]; ok && !block.Mute {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// GetBlockers returns every block on the conversant
+func (repo *BlockRepository) GetBlockers(blockedID string) ([]repositories.Block, error) {
+	repo.store.mu.RLock()
+	defer repo.store.mu.RUnlock()
+
+	blocks := make([]repositories.Block, 0, len(repo.store.blocks[blockedID]))
+	for _, block := range repo.store.blocks[blockedID] {
+		blocks = append(blocks, block)
+	}
+	return blocks, nil
+}
+
+// GetBlocked returns every block the conversant has made
+func (repo *BlockRepository) GetBlocked(blockerID string) ([]repositories.Block, error) {
+	repo.store.mu.RLock()
+	defer repo.store.mu.RUnlock()
+
+	var blocks []repositories.Block
+	for _, blockers := range repo.store.blocks {
+		if block, ok := blockers[blockerID]; ok {
+			blocks = append(blocks, block)
+		}
+	}
+	return blocks, nil
+}
@@ -0,0 +1,26 @@
+package memory
+
+import (
+	"github.com/ryan-berger/chatty/repositories"
+)
+
+// ConversantRepository is a ConversantRepo implementation that keeps conversants in memory
+type ConversantRepository struct {
+	store *Store
+}
+
+// NewConversantRepository creates a new memory ConversantRepository
+func NewConversantRepository(store *Store) *ConversantRepository {
+	return &ConversantRepository{
+		store: store,
+	}
+}
+
+// UpdateOrCreate stores the conversant, replacing it if it already exists
+func (repo *ConversantRepository) UpdateOrCreate(conversant repositories.Conversant) (*repositories.Conversant, error) {
+	repo.store.mu.Lock()
+	repo.store.conversants[conversant.ID] = conversant
+	repo.store.mu.Unlock()
+
+	return &conversant, nil
+}
@@ -0,0 +1,306 @@
+package memory
+
+import (
+	"sort"
+	"time"
+
+	"github.com/pborman/uuid"
+	"github.com/ryan-berger/chatty/repositories"
+)
+
+// ConversationRepository is a ConversationRepo implementation that keeps conversations in memory
+type ConversationRepository struct {
+	store *Store
+}
+
+// NewConversationRepository creates a new memory ConversationRepository
+func NewConversationRepository(store *Store) *ConversationRepository {
+	return &ConversationRepository{
+		store: store,
+	}
+}
+
+// CreateConversation stores a conversation. Every conversant must already exist
+func (repo *ConversationRepository) CreateConversation(newConversation repositories.Conversation) (*repositories.Conversation, error) {
+	repo.store.mu.Lock()
+	defer repo.store.mu.Unlock()
+
+	convo := &conversation{
+		lastActivity: time.Now(),
+		lastRead:     make(map[string]int64),
+		roles:        make(map[string]repositories.Role),
+	}
+	for _, conversant := range newConversation.Conversants {
+		if _, ok := repo.store.conversants[conversant.ID]; !ok {
+			return nil, ErrConversantNotFound
+		}
+		convo.conversantIDs = append(convo.conversantIDs, conversant.ID)
+		convo.roles[conversant.ID] = conversant.Role.OrMember()
+	}
+
+	newConversation.ID = uuid.New()
+	convo.ID = newConversation.ID
+	convo.Name = newConversation.Name
+	convo.Direct = newConversation.Direct
+
+	repo.store.conversations[convo.ID] = convo
+
+	return &newConversation, nil
+}
+
+// RetrieveConversation returns the conversation with a page of its messages, newest first
+func (repo *ConversationRepository) RetrieveConversation(conversationID string, limit, offset int) (*repositories.Conversation, error) {
+	return repo.retrieveConversation(conversationID, func(messages []repositories.Message) []repositories.Message {
+		end := len(messages) - offset
+		if offset < 0 {
+			end = len(messages)
+		}
+		return newestFirst(messages, end-limit, end)
+	})
+}
+
+// RetrieveConversationPage returns the conversation with up to limit messages on the given side of the cursor,
+// newest first
+func (repo *ConversationRepository) RetrieveConversationPage(conversationID string, cursor repositories.Cursor, limit int) (*repositories.Conversation, error) {
+	return repo.retrieveConversation(conversationID, func(messages []repositories.Message) []repositories.Message {
+		// sequences start at 1, so a message is at index sequence - 1
+		if cursor.After > 0 {
+			return newestFirst(messages, int(cursor.After), int(cursor.After)+limit)
+		}
+
+		end := len(messages)
+		if cursor.Before > 0 && int(cursor.Before)-1 < end {
+			end = int(cursor.Before) - 1
+		}
+		return newestFirst(messages, end-limit, end)
+	})
+}
+
+func (repo *ConversationRepository) retrieveConversation(conversationID string, page func([]repositories.Message) []repositories.Message) (*repositories.Conversation, error) {
+	repo.store.mu.RLock()
+	defer repo.store.mu.RUnlock()
+
+	convo, ok := repo.store.conversations[conversationID]
+	if !ok {
+		return nil, ErrConversationNotFound
+	}
+
+	return &repositories.Conversation{
+		ID:          convo.ID,
+		Name:        convo.Name,
+		Direct:      convo.Direct,
+		Conversants: repo.store.conversantsOf(convo),
+		Messages:    page(convo.Messages),
+	}, nil
+}
+
+// GetConversants gets the conversants for a given conversation
+func (repo *ConversationRepository) GetConversants(conversationID string) ([]repositories.Conversant, error) {
+	repo.store.mu.RLock()
+	defer repo.store.mu.RUnlock()
+
+	convo, ok := repo.store.conversations[conversationID]
+	if !ok {
+		return nil, ErrConversationNotFound
+	}
+
+	return repo.store.conversantsOf(convo), nil
+}
+
+// ListConversations returns a page of the conversant's conversations, most recently active first
+func (repo *ConversationRepository) ListConversations(conversantID string, limit, offset int) ([]repositories.ConversationSummary, error) {
+	repo.store.mu.RLock()
+	defer repo.store.mu.RUnlock()
+
+	var convos []*conversation
+	for _, convo := range repo.store.conversations {
+		if convo.hasConversant(conversantID) {
+			convos = append(convos, convo)
+		}
+	}
+
+	sort.Slice(convos, func(i, j int) bool {
+		if !convos[i].lastActivity.Equal(convos[j].lastActivity) {
+			return convos[i].lastActivity.After(convos[j].lastActivity)
+		}
+		return convos[i].ID < convos[j].ID
+	})
+
+	var summaries []repositories.ConversationSummary
+	for i := offset; i >= 0 && i < len(convos) && len(summaries) < limit; i++ {
+		convo := convos[i]
+		summary := repositories.ConversationSummary{
+			ID:           convo.ID,
+			Name:         convo.Name,
+			Direct:       convo.Direct,
+			LastActivity: convo.lastActivity,
+		}
+
+		// messages from conversants they blocked aren't their last message or unread,
+		// so walk back from the newest until both the last message and read position are found
+		lastRead := convo.lastRead[conversantID]
+		for j := len(convo.Messages) - 1; j >= 0; j-- {
+			message := convo.Messages[j]
+			if message.Sequence <= lastRead && summary.LastMessage != nil {
+				break
+			}
+
+			if repo.store.hiddenFrom(conversantID, message) {
+				continue
+			}
+
+			if message.Sequence > lastRead {
+				summary.UnreadCount++
+			}
+
+			if summary.LastMessage == nil {
+				summary.LastMessage = &message
+			}
+		}
+
+		summaries = append(summaries, summary)
+	}
+
+	return summaries, nil
+}
+
+// MarkRead moves the conversant's read position in the conversation forward to sequence
+func (repo *ConversationRepository) MarkRead(conversationID, conversantID string, sequence int64) error {
+	repo.store.mu.Lock()
+	defer repo.store.mu.Unlock()
+
+	convo, ok := repo.store.conversations[conversationID]
+	if !ok {
+		return ErrConversationNotFound
+	}
+
+	if convo.hasConversant(conversantID) && sequence > convo.lastRead[conversantID] {
+		convo.lastRead[conversantID] = sequence
+	}
+
+	return nil
+}
+
+// AddConversants adds the conversants to the conversation. Every conversant must already exist
+func (repo *ConversationRepository) AddConversants(conversationID string, conversants []repositories.Conversant) error {
+	repo.store.mu.Lock()
+	defer repo.store.mu.Unlock()
+
+	convo, ok := repo.store.conversations[conversationID]
+	if !ok {
+		return ErrConversationNotFound
+	}
+
+	for _, conversant := range conversants {
+		if _, ok := repo.store.conversants[conversant.ID]; !ok {
+			return ErrConversantNotFound
+		}
+	}
+
+	for _, conversant := range conversants {
+		if !convo.hasConversant(conversant.ID) {
+			convo.conversantIDs = append(convo.conversantIDs, conversant.ID)
+			convo.lastRead[conversant.ID] = int64(len(convo.Messages))
+			convo.roles[conversant.ID] = conversant.Role.OrMember()
+		}
+	}
+
+	return nil
+}
+
+// RemoveConversants removes the conversants from the conversation
+func (repo *ConversationRepository) RemoveConversants(conversationID string, conversantIDs []string) error {
+	repo.store.mu.Lock()
+	defer repo.store.mu.Unlock()
+
+	convo, ok := repo.store.conversations[conversationID]
+	if !ok {
+		return ErrConversationNotFound
+	}
+
+	for _, conversantID := range conversantIDs {
+		for i, id := range convo.conversantIDs {
+			if id == conversantID {
+				convo.conversantIDs = append(convo.conversantIDs[:i], convo.conversantIDs[i+1:]...)
+				delete(convo.lastRead, conversantID)
+				delete(convo.roles, conversantID)
+				break
+			}
+		}
+	}
+
+	return nil
+}
+
+// IsConversant reports whether the conversant is in the conversation
+func (repo *ConversationRepository) IsConversant(conversationID, conversantID string) (bool, error) {
+	repo.store.mu.RLock()
+	defer repo.store.mu.RUnlock()
+
+	convo, ok := repo.store.conversations[conversationID]
+	return ok && convo.hasConversant(conversantID), nil
+}
+
+// SetRole changes the conversant's role in the conversation
+func (repo *ConversationRepository) SetRole(conversationID, conversantID string, role repositories.Role) error {
+	repo.store.mu.Lock()
+	defer repo.store.mu.Unlock()
+
+	convo, ok := repo.store.conversations[conversationID]
+	if !ok {
+		return ErrConversationNotFound
+	}
+
+	if convo.hasConversant(conversantID) {
+		convo.roles[conversantID] = role
+	}
+	return nil
+}
+
+// RenameConversation changes the conversation's name
+func (repo *ConversationRepository) RenameConversation(conversationID, name string) error {
+	repo.store.mu.Lock()
+	defer repo.store.mu.Unlock()
+
+	convo, ok := repo.store.conversations[conversationID]
+	if !ok {
+		return ErrConversationNotFound
+	}
+
+	convo.Name = name
+	return nil
+}
+
+// DeleteConversation deletes the conversation, along with its messages
+func (repo *ConversationRepository) DeleteConversation(conversationID string) error {
+	repo.store.mu.Lock()
+	defer repo.store.mu.Unlock()
+
+	if _, ok := repo.store.conversations[conversationID]; !ok {
+		return ErrConversationNotFound
+	}
+
+	delete(repo.store.conversations, conversationID)
+	for key, message := range repo.store.idempotency {
+		if message.ConversationID == conversationID {
+			delete(repo.store.idempotency, key)
+		}
+	}
+	return nil
+}
+
+// newestFirst copies messages[start:end] in reverse, clamping start and end to the slice
+func newestFirst(messages []repositories.Message, start, end int) []repositories.Message {
+	if start < 0 {
+		start = 0
+	}
+	if end > len(messages) {
+		end = len(messages)
+	}
+
+	var page []repositories.Message
+	for i := end - 1; i >= start; i-- {
+		page = append(page, messages[i])
+	}
+	return page
+}
@@ -0,0 +1,233 @@
+package memory
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/pborman/uuid"
+
+	"github.com/ryan-berger/chatty/repositories"
+	"github.com/ryan-berger/chatty/repositories/repotest"
+)
+
+func createTestConversation(t *testing.T, store *Store) (*repositories.Conversation, []repositories.Conversant) {
+	conversantRepo := NewConversantRepository(store)
+	conversants := []repositories.Conversant{
+		{ID: uuid.New(), DisplayName: "a"},
+		{ID: uuid.New(), DisplayName: "b"},
+	}
+
+	for _, conversant := range conversants {
+		if _, err := conversantRepo.UpdateOrCreate(conversant); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	conversation, err := NewConversationRepository(store).CreateConversation(repositories.Conversation{
+		Name:        "test",
+		Direct:      true,
+		Conversants: conversants,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return conversation, conversants
+}
+
+func TestConversantRepository_UpdateOrCreate(t *testing.T) {
+	store := NewStore()
+	conversation, conversants := createTestConversation(t, store)
+
+	conversants[0].DisplayName = "after"
+	if _, err := NewConversantRepository(store).UpdateOrCreate(conversants[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	retrieved, err := NewConversationRepository(store).GetConversants(conversation.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if retrieved[0].DisplayName != "after" {
+		t.Fatalf("expected display name after, received %s", retrieved[0].DisplayName)
+	}
+}
+
+func TestConversationRepository_CreateConversation(t *testing.T) {
+	_, err := NewConversationRepository(NewStore()).CreateConversation(repositories.Conversation{
+		Conversants: []repositories.Conversant{{ID: uuid.New()}},
+	})
+
+	if err != ErrConversantNotFound {
+		t.Fatalf("expected ErrConversantNotFound, received %v", err)
+	}
+}
+
+func TestConversationRepository_RetrieveConversation(t *testing.T) {
+	store := NewStore()
+	conversation, conversants := createTestConversation(t, store)
+
+	messageRepo := NewMessageRepository(store)
+	for i := 0; i < 5; i++ {
+		_, err := messageRepo.CreateMessage(repositories.Message{
+			SenderID:       conversants[0].ID,
+			ConversationID: conversation.ID,
+			Message:        "test",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	repo := NewConversationRepository(store)
+	retrieved, err := repo.RetrieveConversation(conversation.ID, 2, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if retrieved.Name != "test" || !retrieved.Direct {
+		t.Fatalf("conversation retrieved incorrectly: %+v", retrieved)
+	}
+
+	if len(retrieved.Conversants) != 2 {
+		t.Fatalf("expected 2 conversants, received %d", len(retrieved.Conversants))
+	}
+
+	if len(retrieved.Messages) != 2 || retrieved.Messages[0].Sequence != 4 || retrieved.Messages[1].Sequence != 3 {
+		t.Fatalf("expected messages 4 and 3, received %+v", retrieved.Messages)
+	}
+
+	retrieved, err = repo.RetrieveConversation(conversation.ID, 10, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(retrieved.Messages) != 0 {
+		t.Fatalf("expected no messages past the end, received %+v", retrieved.Messages)
+	}
+
+	if _, err = repo.RetrieveConversation(uuid.New(), 10, 0); err != ErrConversationNotFound {
+		t.Fatalf("expected ErrConversationNotFound, received %v", err)
+	}
+}
+
+func TestMessageRepository_CreateMessage(t *testing.T) {
+	store := NewStore()
+	conversation, conversants := createTestConversation(t, store)
+	repo := NewMessageRepository(store)
+
+	for i := int64(1); i <= 3; i++ {
+		message, err := repo.CreateMessage(repositories.Message{
+			SenderID:       conversants[i%2].ID,
+			ConversationID: conversation.ID,
+			Message:        "test",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if message.Sequence != i {
+			t.Fatalf("expected sequence %d, received %d", i, message.Sequence)
+		}
+	}
+
+	original, err := repo.CreateMessage(repositories.Message{
+		SenderID:       conversants[0].ID,
+		ConversationID: conversation.ID,
+		Message:        "test",
+		IdempotencyKey: "key",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	duplicate, err := repo.CreateMessage(repositories.Message{
+		ID:             uuid.New(),
+		SenderID:       conversants[0].ID,
+		ConversationID: conversation.ID,
+		Message:        "test",
+		IdempotencyKey: "key",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if duplicate.ID != original.ID || duplicate.Sequence != original.Sequence {
+		t.Fatalf("expected original message %+v, received %+v", original, duplicate)
+	}
+
+	other, err := repo.CreateMessage(repositories.Message{
+		SenderID:       conversants[1].ID,
+		ConversationID: conversation.ID,
+		Message:        "test",
+		IdempotencyKey: "key",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if other.ID == original.ID {
+		t.Fatal("expected idempotency keys to be scoped to the sender")
+	}
+
+	messages, err := repo.GetMessagesAfter(conversation.ID, 2, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(messages) != 2 || messages[0].Sequence != 3 || messages[1].Sequence != 4 {
+		t.Fatalf("expected messages 3 and 4, received %+v", messages)
+	}
+}
+
+func TestMessageRepository_CreateMessageConcurrent(t *testing.T) {
+	store := NewStore()
+	conversation, conversants := createTestConversation(t, store)
+	repo := NewMessageRepository(store)
+
+	const count = 50
+	var wg sync.WaitGroup
+	wg.Add(count)
+	for i := 0; i < count; i++ {
+		go func() {
+			defer wg.Done()
+			_, err := repo.CreateMessage(repositories.Message{
+				SenderID:       conversants[0].ID,
+				ConversationID: conversation.ID,
+				Message:        "test",
+			})
+			if err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	messages, err := repo.GetMessagesAfter(conversation.ID, 0, count)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(messages) != count {
+		t.Fatalf("expected %d messages, received %d", count, len(messages))
+	}
+
+	for i, message := range messages {
+		if message.Sequence != int64(i)+1 {
+			t.Fatalf("expected sequence %d, received %d", i+1, message.Sequence)
+		}
+	}
+}
+
+func TestConformance(t *testing.T) {
+	repotest.Run(t, func(t *testing.T) repotest.Repos {
+		store := NewStore()
+		return repotest.Repos{
+			Messages:      NewMessageRepository(store),
+			Conversations: NewConversationRepository(store),
+			Conversants:   NewConversantRepository(store),
+			Blocks:        NewBlockRepository(store),
+		}
+	})
+}
@@ -0,0 +1,80 @@
+package memory
+
+import (
+	"time"
+
+	"github.com/pborman/uuid"
+	"github.com/ryan-berger/chatty/repositories"
+)
+
+// MessageRepository is a MessageRepo implementation that keeps messages in memory
+type MessageRepository struct {
+	store *Store
+}
+
+// NewMessageRepository creates a new memory MessageRepository
+func NewMessageRepository(store *Store) *MessageRepository {
+	return &MessageRepository{
+		store: store,
+	}
+}
+
+// CreateMessage stores a message at the end of its conversation. When the sender has
+// already used the message's idempotency key, the original message is returned instead
+func (repo *MessageRepository) CreateMessage(message repositories.Message) (*repositories.Message, error) {
+	repo.store.mu.Lock()
+	defer repo.store.mu.Unlock()
+
+	key := idempotencyKey{senderID: message.SenderID, key: message.IdempotencyKey}
+	if message.IdempotencyKey != "" {
+		if original, ok := repo.store.idempotency[key]; ok {
+			return &original, nil
+		}
+	}
+
+	convo, ok := repo.store.conversations[message.ConversationID]
+	if !ok {
+		return nil, ErrConversationNotFound
+	}
+
+	if _, ok := repo.store.conversants[message.SenderID]; !ok {
+		return nil, ErrConversantNotFound
+	}
+
+	if message.ID == "" {
+		message.ID = uuid.New()
+	}
+
+	message.Sequence = int64(len(convo.Messages)) + 1
+	convo.Messages = append(convo.Messages, message)
+	convo.lastActivity = time.Now()
+
+	if message.IdempotencyKey != "" {
+		repo.store.idempotency[key] = message
+	}
+
+	return &message, nil
+}
+
+// GetMessagesAfter returns up to limit messages in the conversation after the given sequence
+func (repo *MessageRepository) GetMessagesAfter(conversationID string, sequence int64, limit int) ([]repositories.Message, error) {
+	repo.store.mu.RLock()
+	defer repo.store.mu.RUnlock()
+
+	convo, ok := repo.store.conversations[conversationID]
+	if !ok {
+		return nil, ErrConversationNotFound
+	}
+
+	if sequence < 0 {
+		sequence = 0
+	}
+
+	var messages []repositories.Message
+	// sequences start at 1, so the message after sequence is at index sequence
+	for i := sequence; i < int64(len(convo.Messages)) && len(messages) < limit; i++ {
+		messages = append(messages, convo.Messages[i])
+	}
+
+	return messages, nil
+}
@@ -0,0 +1,79 @@
+package memory
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/ryan-berger/chatty/repositories"
+)
+
+var (
+	// ErrConversationNotFound is returned when a conversation ID isn't in the store
+	ErrConversationNotFound = errors.New("conversation not found")
+	// ErrConversantNotFound is returned when a conversant ID isn't in the store
+	ErrConversantNotFound = errors.New("conversant not found")
+)
+
+type conversation struct {
+	repositories.Conversation
+	conversantIDs []string
+	lastActivity  time.Time
+	lastRead      map[string]int64
+	roles         map[string]repositories.Role
+}
+
+// hasConversant reports whether the conversant is in the conversation
+func (convo *conversation) hasConversant(conversantID string) bool {
+	for _, id := range convo.conversantIDs {
+		if id == conversantID {
+			return true
+		}
+	}
+	return false
+}
+
+type idempotencyKey struct {
+	senderID string
+	key      string
+}
+
+// Store holds everything the memory repositories keep. It is safe for concurrent use,
+// and is shared between the repositories the same way a *sqlx.DB would be
+type Store struct {
+	mu            *sync.RWMutex
+	conversants   map[string]repositories.Conversant
+	conversations map[string]*conversation
+	idempotency   map[idempotencyKey]repositories.Message
+	// blocks is keyed by who was blocked, then by who blocked them
+	blocks map[string]map[string]repositories.Block
+}
+
+// NewStore creates an empty Store
+func NewStore() *Store {
+	return &Store{
+		mu:            &sync.RWMutex{},
+		conversants:   make(map[string]repositories.Conversant),
+		conversations: make(map[string]*conversation),
+		idempotency:   make(map[idempotencyKey]repositories.Message),
+		blocks:        make(map[string]map[string]repositories.Block),
+	}
+}
+
+// conversantsOf looks up every conversant in the conversation. The caller must hold mu
+func (store *Store) conversantsOf(convo *conversation) []repositories.Conversant {
+	conversants := make([]repositories.Conversant, 0, len(convo.conversantIDs))
+	for _, id := range convo.conversantIDs {
+		conversant := store.conversants[id]
+		conversant.Role = convo.roles[id]
+		conversants = append(conversants, conversant)
+	}
+	return conversants
+}
+
+// hiddenFrom reports whether the reader blocked the message's sender. Mutes and system
+// messages aren't hidden, the same as when messages are delivered live. The caller must hold mu
+func (store *Store) hiddenFrom(readerID string, message repositories.Message) bool {
+	block, ok := store.blocks[message.SenderID][readerID]
+	return ok && !block.Mute && !message.System
+}
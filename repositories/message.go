@@ -1,13 +1,20 @@
 package repositories
 
-// MessageRepo is a way for the connection manager to store messages
+// MessageRepo is a way for the connection manager to store messages.
+// CreateMessage must give each message the next sequence number in its
+// conversation. If a message with the same sender and idempotency key has
+// already been stored, it returns that message instead of storing a new one.
+// GetMessagesAfter returns up to limit messages with a sequence greater than
+// sequence, oldest first
 type MessageRepo interface {
 	CreateMessage(message Message) (*Message, error)
+	GetMessagesAfter(conversationID string, sequence int64, limit int) ([]Message, error)
 }
 
 // MockMessageRepo is a MessageRepo implementation for testing
 type MockMessageRepo struct {
-	Create func(message Message) (*Message, error)
+	Create   func(message Message) (*Message, error)
+	GetAfter func(conversationID string, sequence int64, limit int) ([]Message, error)
 }
 
 // CreateMessage calls the Create method in the MockMessageRepo
@@ -15,6 +22,11 @@ func (mock *MockMessageRepo) CreateMessage(message Message) (*Message, error) {
 	return mock.Create(message)
 }
 
+// GetMessagesAfter calls the GetAfter method in the MockMessageRepo
+func (mock *MockMessageRepo) GetMessagesAfter(conversationID string, sequence int64, limit int) ([]Message, error) {
+	return mock.GetAfter(conversationID, sequence, limit)
+}
+
 // DefaultMockRepo creates a mock repo that will return
 // any data given to it without errors
 func DefaultMockMessageRepo() MessageRepo {
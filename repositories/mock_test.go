@@ -0,0 +1,185 @@
+package repositories_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ryan-berger/chatty/repositories"
+	"github.com/ryan-berger/chatty/repositories/memory"
+	"github.com/ryan-berger/chatty/repositories/repotest"
+)
+
+// TestMocks checks that the mocks pass every call through untouched by backing them with memory repositories
+func TestMocks(t *testing.T) {
+	repotest.Run(t, func(t *testing.T) repotest.Repos {
+		store := memory.NewStore()
+		messages := memory.NewMessageRepository(store)
+		conversations := memory.NewConversationRepository(store)
+		conversants := memory.NewConversantRepository(store)
+		blocks := memory.NewBlockRepository(store)
+
+		return repotest.Repos{
+			Messages: &repositories.MockMessageRepo{
+				Create:   messages.CreateMessage,
+				GetAfter: messages.GetMessagesAfter,
+			},
+			Conversations: &repositories.MockConversationRepo{
+				CreateConvo:   conversations.CreateConversation,
+				RetrieveConvo: conversations.RetrieveConversation,
+				RetrievePage:  conversations.RetrieveConversationPage,
+				GetConvo:      conversations.GetConversants,
+				ListConvos:    conversations.ListConversations,
+				MarkConvoRead: conversations.MarkRead,
+				AddMembers:    conversations.AddConversants,
+				RemoveMembers: conversations.RemoveConversants,
+				IsMember:      conversations.IsConversant,
+				SetMemberRole: conversations.SetRole,
+				RenameConvo:   conversations.RenameConversation,
+				DeleteConvo:   conversations.DeleteConversation,
+			},
+			Conversants: &repositories.MockConversantRepo{
+				Upsert: conversants.UpdateOrCreate,
+			},
+			Blocks: &repositories.MockBlockRepo{
+				Add:     blocks.Block,
+				Remove:  blocks.Unblock,
+				Blocked: blocks.IsBlocked,
+				Blocks:  blocks.GetBlockers,
+				Blocker: blocks.GetBlocked,
+			},
+		}
+	})
+}
+
+// TestMembershipCache checks that the cache still behaves like the repo it wraps
+func TestMembershipCache(t *testing.T) {
+	repotest.Run(t, func(t *testing.T) repotest.Repos {
+		store := memory.NewStore()
+		return repotest.Repos{
+			Messages:      memory.NewMessageRepository(store),
+			Conversations: repositories.NewMembershipCache(memory.NewConversationRepository(store), time.Minute),
+			Conversants:   memory.NewConversantRepository(store),
+			Blocks:        memory.NewBlockRepository(store),
+		}
+	})
+}
+
+func TestMembershipCache_IsConversant(t *testing.T) {
+	lookups := 0
+	member := true
+	mock := &repositories.MockConversationRepo{
+		IsMember: func(conversationID, conversantID string) (bool, error) {
+			lookups++
+			return member, nil
+		},
+		RemoveMembers: func(conversationID string, conversantIDs []string) error {
+			member = false
+			return nil
+		},
+	}
+
+	cache := repositories.NewMembershipCache(mock, time.Minute)
+	for i := 0; i < 3; i++ {
+		if ok, err := cache.IsConversant("conversation", "conversant"); err != nil || !ok {
+			t.Fatalf("expected a member, received %v, %v", ok, err)
+		}
+	}
+
+	if lookups != 1 {
+		t.Fatalf("expected 1 lookup, received %d", lookups)
+	}
+
+	if err := cache.RemoveConversants("conversation", []string{"conversant"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if ok, _ := cache.IsConversant("conversation", "conversant"); ok || lookups != 2 {
+		t.Fatalf("expected removing conversants to invalidate the cache, received %v after %d lookups", ok, lookups)
+	}
+
+	expiring := repositories.NewMembershipCache(mock, 0)
+	expiring.IsConversant("conversation", "conversant")
+	expiring.IsConversant("conversation", "conversant")
+	if lookups != 4 {
+		t.Fatalf("expected expired entries to be looked up again, received %d lookups", lookups)
+	}
+}
+
+func TestMembershipCache_InvalidatedDuringLookup(t *testing.T) {
+	var cache *repositories.MembershipCache
+	lookups := 0
+	member := true
+	mock := &repositories.MockConversationRepo{
+		IsMember: func(conversationID, conversantID string) (bool, error) {
+			lookups++
+			wasMember := member
+			if lookups == 1 {
+				// the conversant is removed after they were looked up, but before the answer is cached
+				cache.RemoveConversants(conversationID, []string{conversantID})
+			}
+			return wasMember, nil
+		},
+		RemoveMembers: func(conversationID string, conversantIDs []string) error {
+			member = false
+			return nil
+		},
+		CreateConvo: func(conversation repositories.Conversation) (*repositories.Conversation, error) {
+			member = true
+			return &conversation, nil
+		},
+	}
+
+	cache = repositories.NewMembershipCache(mock, time.Minute)
+	cache.IsConversant("conversation", "conversant")
+
+	if ok, _ := cache.IsConversant("conversation", "conversant"); ok || lookups != 2 {
+		t.Fatalf("expected the stale lookup not to be cached, received %v after %d lookups", ok, lookups)
+	}
+
+	if _, err := cache.CreateConversation(repositories.Conversation{ID: "conversation"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if ok, _ := cache.IsConversant("conversation", "conversant"); !ok || lookups != 3 {
+		t.Fatalf("expected creating the conversation to invalidate the cache, received %v after %d lookups", ok, lookups)
+	}
+}
+
+func TestMembershipCache_GetConversants(t *testing.T) {
+	lookups := 0
+	role := repositories.RoleMember
+	mock := &repositories.MockConversationRepo{
+		GetConvo: func(conversationID string) ([]repositories.Conversant, error) {
+			lookups++
+			return []repositories.Conversant{{ID: "conversant", Role: role}}, nil
+		},
+		SetMemberRole: func(conversationID, conversantID string, newRole repositories.Role) error {
+			role = newRole
+			return nil
+		},
+	}
+
+	cache := repositories.NewMembershipCache(mock, time.Minute)
+	for i := 0; i < 3; i++ {
+		conversants, err := cache.GetConversants("conversation")
+		if err != nil || len(conversants) != 1 || conversants[0].Role != repositories.RoleMember {
+			t.Fatalf("expected a member, received %v, %v", conversants, err)
+		}
+
+		// callers get their own copy, so they can't change what's cached
+		conversants[0].Role = repositories.RoleOwner
+	}
+
+	if lookups != 1 {
+		t.Fatalf("expected 1 lookup, received %d", lookups)
+	}
+
+	if err := cache.SetRole("conversation", "conversant", repositories.RoleReadOnly); err != nil {
+		t.Fatal(err)
+	}
+
+	conversants, _ := cache.GetConversants("conversation")
+	if conversants[0].Role != repositories.RoleReadOnly || lookups != 2 {
+		t.Fatalf("expected setting a role to invalidate the cache, received %v after %d lookups", conversants, lookups)
+	}
+}
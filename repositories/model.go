@@ -1,28 +1,100 @@
 package repositories
 
+import "time"
+
 // Conversant is a struct representing someone who converses
 // A conversant is not unique per connection, but is distinct
-// from a user as a Conversant is not organizationally dependent
+// from a user as a Conversant is not organizationally dependent.
+// Role is only set on a conversation's conversants, and is their
+// role in that conversation
 type Conversant struct {
-	ID          string `json:"id"db:"id"`
-	DisplayName string `json:"name"db:"display_name"`
+	ID          string `json:"id" db:"id"`
+	DisplayName string `json:"name" db:"display_name"`
+	Role        Role   `json:"role,omitempty" db:"role"`
+}
+
+// Role is what a conversant is allowed to do in a conversation. Owners can do anything,
+// admins can manage members and rename the conversation, members can send messages, and
+// read-only conversants can only read them
+type Role string
+
+const (
+	RoleOwner    Role = "owner"
+	RoleAdmin    Role = "admin"
+	RoleMember   Role = "member"
+	RoleReadOnly Role = "readonly"
+)
+
+// OrMember is the role, or RoleMember when it isn't set. Conversants
+// are stored as members when they're given without a role
+func (role Role) OrMember() Role {
+	if role == "" {
+		return RoleMember
+	}
+	return role
+}
+
+// CanSend reports whether the role is allowed to send messages
+func (role Role) CanSend() bool {
+	return role != RoleReadOnly
+}
+
+// CanManage reports whether the role is allowed to rename
+// the conversation and add or remove its members
+func (role Role) CanManage() bool {
+	return role == RoleOwner || role == RoleAdmin
+}
+
+// Block is a conversant blocking another. Blocked conversants' messages aren't delivered
+// to the blocker at all, while muted ones are delivered but never pushed as notifications
+type Block struct {
+	BlockerID string `json:"blockerId" db:"blocker_id"`
+	BlockedID string `json:"blockedId" db:"blocked_id"`
+	Mute      bool   `json:"mute" db:"mute"`
 }
 
 // Message is an incoming message to be sent to all conversants
-// within the given conversation
+// within the given conversation. IdempotencyKey is unique per sender,
+// and Sequence increases by one with every message in a conversation.
+// System messages describe changes to the conversation, like members
+// being added, and are sent by the conversant that made the change
 type Message struct {
-	ID             string `json:"id"db:"id"`
-	SenderID       string `json:"senderId"db:"sender_id"`
-	Message        string `json:"message"db:"message"`
-	ConversationID string `json:"conversationId"db:"conversation_id"`
+	ID             string `json:"id" db:"id"`
+	SenderID       string `json:"senderId" db:"sender_id"`
+	Message        string `json:"message" db:"message"`
+	ConversationID string `json:"conversationId" db:"conversation_id"`
+	IdempotencyKey string `json:"idempotencyKey,omitempty" db:"idempotency_key"`
+	Sequence       int64  `json:"sequence" db:"sequence"`
+	System         bool   `json:"system,omitempty" db:"system_message"`
 }
 
 // Conversation is a group of conversants, and a list of messages
 // allowing the manager to make sure everyone is notified of a message
 type Conversation struct {
-	ID          string       `json:"id"db:"id"`
-	Name        string       `json:"id"db:"name"`
+	ID          string       `json:"id" db:"id"`
+	Name        string       `json:"name" db:"name"`
 	Conversants []Conversant `json:"conversants"`
 	Messages    []Message    `json:"messages"`
-	Direct      bool         `json:"direct"db:"direct"`
+	Direct      bool         `json:"direct" db:"direct"`
+}
+
+// Cursor picks a page of a conversation's messages by sequence. A page with
+// Before set holds the messages just older than Before, and a page with After
+// set holds the messages just newer than After. With neither set, the page
+// holds the newest messages
+type Cursor struct {
+	Before int64
+	After  int64
+}
+
+// ConversationSummary is a conversation as it is listed for one of its conversants.
+// UnreadCount is how many messages came after the last one the conversant read, and
+// LastActivity is when the last message was sent, or when the conversation was created
+type ConversationSummary struct {
+	ID           string    `json:"id"`
+	Name         string    `json:"name"`
+	Direct       bool      `json:"direct"`
+	LastMessage  *Message  `json:"lastMessage"`
+	UnreadCount  int64     `json:"unreadCount"`
+	LastActivity time.Time `json:"lastActivity"`
 }
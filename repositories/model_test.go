@@ -0,0 +1,26 @@
+package repositories_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/ryan-berger/chatty/repositories"
+)
+
+// TestConversation_JSON pins the conversation's wire format. Name used to share the
+// "id" key with ID, which made encoding/json leave both of them out
+func TestConversation_JSON(t *testing.T) {
+	b, err := json.Marshal(repositories.Conversation{ID: "id", Name: "name"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var fields map[string]interface{}
+	if err = json.Unmarshal(b, &fields); err != nil {
+		t.Fatal(err)
+	}
+
+	if fields["id"] != "id" || fields["name"] != "name" {
+		t.Fatalf("expected id and name to be encoded separately, received %s", b)
+	}
+}
@@ -0,0 +1,35 @@
+package mysql
+
+import (
+	"github.com/jmoiron/sqlx"
+	"github.com/ryan-berger/chatty/repositories"
+)
+
+const updateOrCreateConversant = `
+INSERT INTO conversant (id, display_name) VALUES (:id, :display_name)
+ON DUPLICATE KEY
+  UPDATE display_name = VALUES(display_name)
+`
+
+// ConversantRepository is a ConversantRepo implementation that uses MySQL to store conversants
+type ConversantRepository struct {
+	db *sqlx.DB
+}
+
+// NewConversantRepository creates a new MySQL ConversantRepository
+func NewConversantRepository(db *sqlx.DB) *ConversantRepository {
+	return &ConversantRepository{
+		db: db,
+	}
+}
+
+// UpdateOrCreate stores the conversant, updating the display name if it already exists
+func (repo *ConversantRepository) UpdateOrCreate(conversant repositories.Conversant) (*repositories.Conversant, error) {
+	_, err := repo.db.NamedExec(updateOrCreateConversant, &conversant)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &conversant, nil
+}
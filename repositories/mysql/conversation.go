@@ -0,0 +1,413 @@
+package mysql
+
+import (
+	"database/sql"
+	"math"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/pborman/uuid"
+	"github.com/pkg/errors"
+	"github.com/ryan-berger/chatty/repositories"
+)
+
+const createConversation = `
+INSERT INTO conversation(id, name, direct) VALUES (:id, :name, :direct)
+`
+
+const createConversantConversation = `
+INSERT INTO conversant_conversation(conversation_id, conversant_id, role) VALUES (?, ?, ?)
+`
+
+const getConversation = `
+SELECT
+	c.id,
+	COALESCE(c.name, '') AS name,
+	c.direct
+FROM conversation c
+WHERE c.id = ?
+`
+
+const getUsersFromConversation = `
+SELECT
+	c.id,
+	c.display_name,
+	cc.role
+FROM conversant_conversation cc
+JOIN conversant c on cc.conversant_id = c.id
+WHERE conversation_id = ?
+`
+
+const getConversationMessages = `
+SELECT
+	m.id,
+	m.sender AS sender_id,
+	m.message,
+	m.conversation AS conversation_id,
+	m.sequence,
+	m.system_message
+FROM chat_message m
+WHERE m.conversation = ?
+ORDER BY m.sequence DESC
+LIMIT ? OFFSET ?
+`
+
+// Pages by cursor are read straight off the (conversation, sequence) unique index,
+// so they stay fast and stable however many messages arrive after the first page
+const getConversationMessagesBefore = `
+SELECT
+	m.id,
+	m.sender AS sender_id,
+	m.message,
+	m.conversation AS conversation_id,
+	m.sequence,
+	m.system_message
+FROM chat_message m
+WHERE m.conversation = ? AND m.sequence < ?
+ORDER BY m.sequence DESC
+LIMIT ?
+`
+
+const getConversationMessagesAfter = `
+SELECT * FROM (
+SELECT
+	m.id,
+	m.sender AS sender_id,
+	m.message,
+	m.conversation AS conversation_id,
+	m.sequence,
+	m.system_message
+FROM chat_message m
+WHERE m.conversation = ? AND m.sequence > ?
+ORDER BY m.sequence
+LIMIT ?
+) page
+ORDER BY page.sequence DESC
+`
+
+// listConversations hides messages from conversants the reader blocked from both the last
+// message and the unread count, the same as the postgres query
+const listConversations = `
+SELECT
+	c.id,
+	COALESCE(c.name, '') AS name,
+	c.direct,
+	c.last_activity,
+	c.last_sequence - cc.last_read_sequence - (
+		SELECT COUNT(*)
+		FROM chat_message hidden
+		JOIN conversant_block b ON b.blocked_id = hidden.sender AND b.blocker_id = cc.conversant_id AND NOT b.mute
+		WHERE hidden.conversation = c.id AND hidden.sequence > cc.last_read_sequence AND NOT hidden.system_message
+	) AS unread_count,
+	m.id AS message_id,
+	m.sender AS message_sender_id,
+	m.message,
+	m.sequence AS message_sequence,
+	m.system_message AS message_system
+FROM conversant_conversation cc
+JOIN conversation c ON c.id = cc.conversation_id
+LEFT JOIN chat_message m ON m.conversation = c.id AND m.sequence = (
+	SELECT shown.sequence
+	FROM chat_message shown
+	WHERE shown.conversation = c.id
+		AND (shown.system_message OR NOT EXISTS(
+			SELECT 1 FROM conversant_block b
+			WHERE b.blocker_id = cc.conversant_id AND b.blocked_id = shown.sender AND NOT b.mute
+		))
+	ORDER BY shown.sequence DESC
+	LIMIT 1
+)
+WHERE cc.conversant_id = ?
+ORDER BY c.last_activity DESC, c.id
+LIMIT ? OFFSET ?
+`
+
+const markRead = `
+UPDATE conversant_conversation SET last_read_sequence = GREATEST(last_read_sequence, ?)
+WHERE conversation_id = ? AND conversant_id = ?
+`
+
+// new members start out having read everything already in the conversation
+const addConversant = `
+INSERT INTO conversant_conversation(conversation_id, conversant_id, last_read_sequence, role)
+SELECT c.id, ?, c.last_sequence, ? FROM conversation c WHERE c.id = ?
+ON DUPLICATE KEY UPDATE conversant_id = conversant_id
+`
+
+const isConversant = `
+SELECT EXISTS(SELECT 1 FROM conversant_conversation WHERE conversation_id = ? AND conversant_id = ?)
+`
+
+const removeConversant = `
+DELETE FROM conversant_conversation WHERE conversation_id = ? AND conversant_id = ?
+`
+
+const setRole = `
+UPDATE conversant_conversation SET role = ?
+WHERE conversation_id = ? AND conversant_id = ?
+`
+
+const renameConversation = `
+UPDATE conversation SET name = ? WHERE id = ?
+`
+
+// a conversation's messages and memberships reference it, so they're deleted first
+const deleteConversationMessages = `
+DELETE FROM chat_message WHERE conversation = ?
+`
+
+const deleteConversationConversants = `
+DELETE FROM conversant_conversation WHERE conversation_id = ?
+`
+
+const deleteConversation = `
+DELETE FROM conversation WHERE id = ?
+`
+
+// conversationSummaryRow is a row of listConversations. The last message
+// columns are null when the conversation has no messages yet
+type conversationSummaryRow struct {
+	ID              string         `db:"id"`
+	Name            string         `db:"name"`
+	Direct          bool           `db:"direct"`
+	LastActivity    time.Time      `db:"last_activity"`
+	UnreadCount     int64          `db:"unread_count"`
+	MessageID       sql.NullString `db:"message_id"`
+	MessageSenderID sql.NullString `db:"message_sender_id"`
+	Message         sql.NullString `db:"message"`
+	MessageSequence sql.NullInt64  `db:"message_sequence"`
+	MessageSystem   sql.NullBool   `db:"message_system"`
+}
+
+func (row conversationSummaryRow) summary() repositories.ConversationSummary {
+	summary := repositories.ConversationSummary{
+		ID:           row.ID,
+		Name:         row.Name,
+		Direct:       row.Direct,
+		UnreadCount:  row.UnreadCount,
+		LastActivity: row.LastActivity,
+	}
+
+	if row.MessageID.Valid {
+		summary.LastMessage = &repositories.Message{
+			ID:             row.MessageID.String,
+			SenderID:       row.MessageSenderID.String,
+			Message:        row.Message.String,
+			ConversationID: row.ID,
+			Sequence:       row.MessageSequence.Int64,
+			System:         row.MessageSystem.Bool,
+		}
+	}
+
+	return summary
+}
+
+// ConversationRepository is an implementation of ConversationRepo
+// that uses MySQL as it's backend
+type ConversationRepository struct {
+	db *sqlx.DB
+}
+
+// NewConversationRepository creates a MySQL instance of a ConversationRepo
+func NewConversationRepository(db *sqlx.DB) *ConversationRepository {
+	return &ConversationRepository{
+		db: db,
+	}
+}
+
+// CreateConversation creates a conversation with its conversants in a transaction
+func (repo *ConversationRepository) CreateConversation(conversation repositories.Conversation) (*repositories.Conversation, error) {
+	tx, err := repo.db.Beginx()
+	if err != nil {
+		return nil, err
+	}
+
+	conversation.ID = uuid.New()
+
+	_, err = tx.NamedExec(createConversation, &conversation)
+	if err != nil {
+		tx.Rollback()
+		return nil, errors.Wrap(err, "err: creating conversation")
+	}
+
+	for _, conversant := range conversation.Conversants {
+		_, err = tx.Exec(createConversantConversation, conversation.ID, conversant.ID, conversant.Role.OrMember())
+		if err != nil {
+			tx.Rollback()
+			return nil, errors.Wrap(err, "err: Adding Conversants")
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, errors.Wrap(err, "commit: error comitting CreateConversation")
+	}
+
+	return &conversation, nil
+}
+
+// RetrieveConversation grabs a conversation with the messages given a limit and offset
+func (repo *ConversationRepository) RetrieveConversation(conversationID string, limit, offset int) (*repositories.Conversation, error) {
+	return repo.retrieveConversation(conversationID, getConversationMessages, conversationID, limit, offset)
+}
+
+// RetrieveConversationPage grabs a conversation with up to limit messages on the given side of the cursor
+func (repo *ConversationRepository) RetrieveConversationPage(conversationID string, cursor repositories.Cursor, limit int) (*repositories.Conversation, error) {
+	if cursor.After > 0 {
+		return repo.retrieveConversation(conversationID, getConversationMessagesAfter, conversationID, cursor.After, limit)
+	}
+
+	before := cursor.Before
+	if before == 0 {
+		before = math.MaxInt64
+	}
+
+	return repo.retrieveConversation(conversationID, getConversationMessagesBefore, conversationID, before, limit)
+}
+
+func (repo *ConversationRepository) retrieveConversation(conversationID string, messagesQuery string, args ...interface{}) (*repositories.Conversation, error) {
+	var conversation repositories.Conversation
+
+	err := repo.db.Get(&conversation, getConversation, conversationID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = repo.db.Select(&conversation.Conversants, getUsersFromConversation, conversationID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = repo.db.Select(&conversation.Messages, messagesQuery, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &conversation, nil
+}
+
+// GetConversants gets the conversants for a given conversation
+func (repo *ConversationRepository) GetConversants(conversationID string) ([]repositories.Conversant, error) {
+	var conversants []repositories.Conversant
+	err := repo.db.Select(&conversants, getUsersFromConversation, conversationID)
+	if err != nil {
+		return nil, err
+	}
+
+	return conversants, nil
+}
+
+// ListConversations returns a page of the conversant's conversations, most recently active first
+// last_activity is a DATETIME, so the DSN must set parseTime=true, as Open does
+func (repo *ConversationRepository) ListConversations(conversantID string, limit, offset int) ([]repositories.ConversationSummary, error) {
+	var rows []conversationSummaryRow
+	err := repo.db.Select(&rows, listConversations, conversantID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+
+	summaries := make([]repositories.ConversationSummary, 0, len(rows))
+	for _, row := range rows {
+		summaries = append(summaries, row.summary())
+	}
+
+	return summaries, nil
+}
+
+// MarkRead moves the conversant's read position in the conversation forward to sequence
+func (repo *ConversationRepository) MarkRead(conversationID, conversantID string, sequence int64) error {
+	_, err := repo.db.Exec(markRead, sequence, conversationID, conversantID)
+	return err
+}
+
+// AddConversants adds the conversants to the conversation in a transaction
+func (repo *ConversationRepository) AddConversants(conversationID string, conversants []repositories.Conversant) error {
+	tx, err := repo.db.Beginx()
+	if err != nil {
+		return err
+	}
+
+	for _, conversant := range conversants {
+		_, err = tx.Exec(addConversant, conversant.ID, conversant.Role.OrMember(), conversationID)
+		if err != nil {
+			tx.Rollback()
+			return errors.Wrap(err, "err: Adding Conversants")
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return errors.Wrap(err, "commit: error comitting AddConversants")
+	}
+
+	return nil
+}
+
+// RemoveConversants removes the conversants from the conversation in a transaction
+func (repo *ConversationRepository) RemoveConversants(conversationID string, conversantIDs []string) error {
+	tx, err := repo.db.Beginx()
+	if err != nil {
+		return err
+	}
+
+	for _, conversantID := range conversantIDs {
+		_, err = tx.Exec(removeConversant, conversationID, conversantID)
+		if err != nil {
+			tx.Rollback()
+			return errors.Wrap(err, "err: Removing Conversants")
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return errors.Wrap(err, "commit: error comitting RemoveConversants")
+	}
+
+	return nil
+}
+
+// IsConversant reports whether the conversant is in the conversation
+func (repo *ConversationRepository) IsConversant(conversationID, conversantID string) (bool, error) {
+	var member bool
+	err := repo.db.Get(&member, isConversant, conversationID, conversantID)
+	if err != nil {
+		return false, err
+	}
+
+	return member, nil
+}
+
+// SetRole changes the conversant's role in the conversation
+func (repo *ConversationRepository) SetRole(conversationID, conversantID string, role repositories.Role) error {
+	_, err := repo.db.Exec(setRole, role, conversationID, conversantID)
+	return err
+}
+
+// RenameConversation changes the conversation's name
+func (repo *ConversationRepository) RenameConversation(conversationID, name string) error {
+	_, err := repo.db.Exec(renameConversation, name, conversationID)
+	return err
+}
+
+// DeleteConversation deletes the conversation with its messages and memberships in a transaction
+func (repo *ConversationRepository) DeleteConversation(conversationID string) error {
+	tx, err := repo.db.Beginx()
+	if err != nil {
+		return err
+	}
+
+	for _, query := range []string{deleteConversationMessages, deleteConversationConversants, deleteConversation} {
+		_, err = tx.Exec(query, conversationID)
+		if err != nil {
+			tx.Rollback()
+			return errors.Wrap(err, "err: Deleting Conversation")
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return errors.Wrap(err, "commit: error comitting DeleteConversation")
+	}
+
+	return nil
+}
@@ -0,0 +1,144 @@
+package mysql
+
+import (
+	"database/sql"
+
+	driver "github.com/go-sql-driver/mysql"
+	"github.com/jmoiron/sqlx"
+	"github.com/pborman/uuid"
+	"github.com/pkg/errors"
+	"github.com/ryan-berger/chatty/repositories"
+)
+
+// errDuplicateEntry is the MySQL error number for a unique key violation
+const errDuplicateEntry = 1062
+
+// MySQL has no RETURNING, so the new sequence is handed back through LAST_INSERT_ID,
+// which is scoped to the connection running the transaction
+const nextSequence = `
+UPDATE conversation SET last_sequence = LAST_INSERT_ID(last_sequence + 1), last_activity = NOW(6)
+WHERE id = ?
+`
+
+const createMessage = `
+INSERT INTO chat_message(id, message, sender, conversation, idempotency_key, sequence, system_message)
+VALUES (:id, :message, :sender_id, :conversation_id, NULLIF(:idempotency_key, ''), :sequence, :system_message)
+`
+
+const getMessageByIdempotencyKey = `
+SELECT
+	m.id,
+	m.message,
+	m.sender AS sender_id,
+	m.conversation AS conversation_id,
+	m.idempotency_key,
+	m.sequence,
+	m.system_message
+FROM chat_message m
+WHERE m.sender = ? AND m.idempotency_key = ?
+`
+
+const getMessagesAfter = `
+SELECT
+	m.id,
+	m.message,
+	m.sender AS sender_id,
+	m.conversation AS conversation_id,
+	m.sequence,
+	m.system_message
+FROM chat_message m
+WHERE m.conversation = ? AND m.sequence > ?
+ORDER BY m.sequence
+LIMIT ?
+`
+
+// MessageRepository is a MessageRepo implementation that uses MySQL to store messages
+type MessageRepository struct {
+	db *sqlx.DB
+}
+
+// NewMessageRepository creates a new MySQL MessageRepository
+func NewMessageRepository(db *sqlx.DB) *MessageRepository {
+	return &MessageRepository{
+		db: db,
+	}
+}
+
+// CreateMessage stores a message in MySQL, giving it the next sequence number in its
+// conversation. The conversation row stays locked until the transaction commits, so
+// concurrent messages are numbered one after another. When the sender has already used
+// the message's idempotency key, the original message is returned instead
+func (repo *MessageRepository) CreateMessage(message repositories.Message) (*repositories.Message, error) {
+	if message.ID == "" {
+		message.ID = uuid.New()
+	}
+
+	if message.IdempotencyKey != "" {
+		original, err := repo.getByIdempotencyKey(message.SenderID, message.IdempotencyKey)
+		if err == nil {
+			return original, nil
+		}
+		if err != sql.ErrNoRows {
+			return nil, err
+		}
+	}
+
+	tx, err := repo.db.Beginx()
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := tx.Exec(nextSequence, message.ConversationID)
+	if err != nil {
+		tx.Rollback()
+		return nil, errors.Wrap(err, "err: getting next sequence")
+	}
+
+	updated, err := result.RowsAffected()
+	if err == nil && updated == 0 {
+		err = sql.ErrNoRows
+	}
+	if err == nil {
+		message.Sequence, err = result.LastInsertId()
+	}
+	if err != nil {
+		tx.Rollback()
+		return nil, errors.Wrap(err, "err: getting next sequence")
+	}
+
+	_, err = tx.NamedExec(createMessage, &message)
+	if err != nil {
+		tx.Rollback()
+		if mysqlErr, ok := err.(*driver.MySQLError); ok && mysqlErr.Number == errDuplicateEntry && message.IdempotencyKey != "" {
+			return repo.getByIdempotencyKey(message.SenderID, message.IdempotencyKey)
+		}
+		return nil, errors.Wrap(err, "err: creating message")
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, errors.Wrap(err, "commit: error comitting CreateMessage")
+	}
+
+	return &message, nil
+}
+
+// GetMessagesAfter returns up to limit messages in the conversation after the given sequence
+func (repo *MessageRepository) GetMessagesAfter(conversationID string, sequence int64, limit int) ([]repositories.Message, error) {
+	var messages []repositories.Message
+	err := repo.db.Select(&messages, getMessagesAfter, conversationID, sequence, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	return messages, nil
+}
+
+func (repo *MessageRepository) getByIdempotencyKey(senderID, idempotencyKey string) (*repositories.Message, error) {
+	var original repositories.Message
+	err := repo.db.Get(&original, getMessageByIdempotencyKey, senderID, idempotencyKey)
+	if err != nil {
+		return nil, err
+	}
+	return &original, nil
+}
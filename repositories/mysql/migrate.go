@@ -0,0 +1,281 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// Direction is which way Migrate moves the schema
+type Direction int
+
+const (
+	// Up applies every migration that hasn't been applied yet
+	Up Direction = iota
+	// Down rolls back the most recently applied migration
+	Down
+)
+
+// migrationLock is the named lock held while migrating, so that
+// servers migrating on startup at the same time don't race each other
+const migrationLock = "chatty_migrations"
+
+// migrationLockTimeout is how many seconds to wait for another server's migration to finish
+const migrationLockTimeout = 60
+
+const createSchemaMigrations = `
+CREATE TABLE IF NOT EXISTS chatty_migrations
+(
+  version    BIGINT PRIMARY KEY,
+  name       VARCHAR(255) NOT NULL,
+  applied_at DATETIME     NOT NULL DEFAULT CURRENT_TIMESTAMP
+)
+`
+
+const lockMigrations = `SELECT GET_LOCK(?, ?)`
+
+const unlockMigrations = `SELECT RELEASE_LOCK(?)`
+
+const getAppliedVersions = `SELECT version FROM chatty_migrations`
+
+const insertVersion = `INSERT INTO chatty_migrations(version, name) VALUES (?, ?)`
+
+const deleteVersion = `DELETE FROM chatty_migrations WHERE version = ?`
+
+// Migration is a single schema change, read from a pair of
+// <version>_<name>.up.sql and .down.sql files
+type Migration struct {
+	Version int64
+	Name    string
+	Applied bool
+	up      *string
+	down    *string
+}
+
+// Migrate moves the schema in the given direction. MySQL commits schema changes as soon
+// as they run, so unlike postgres a failed migration can leave the statements before it
+// applied, and the schema has to be fixed by hand before migrating again
+func Migrate(db *sqlx.DB, direction Direction) error {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	conn, err := lock(ctx, db)
+	if err != nil {
+		return err
+	}
+	defer unlock(ctx, conn)
+
+	applied, err := appliedVersions(ctx, conn)
+	if err != nil {
+		return err
+	}
+
+	switch direction {
+	case Up:
+		for _, migration := range migrations {
+			if applied[migration.Version] {
+				continue
+			}
+
+			if err = execStatements(ctx, conn, *migration.up); err != nil {
+				return errors.Wrapf(err, "err: applying migration %d_%s", migration.Version, migration.Name)
+			}
+
+			if _, err = conn.ExecContext(ctx, insertVersion, migration.Version, migration.Name); err != nil {
+				return err
+			}
+		}
+	case Down:
+		for i := len(migrations) - 1; i >= 0; i-- {
+			migration := migrations[i]
+			if !applied[migration.Version] {
+				continue
+			}
+
+			if err = execStatements(ctx, conn, *migration.down); err != nil {
+				return errors.Wrapf(err, "err: rolling back migration %d_%s", migration.Version, migration.Name)
+			}
+
+			if _, err = conn.ExecContext(ctx, deleteVersion, migration.Version); err != nil {
+				return err
+			}
+			break
+		}
+	default:
+		return errors.Errorf("unknown migration direction %d", direction)
+	}
+
+	return nil
+}
+
+// MigrationStatus lists every known migration, oldest first, and whether it has been applied
+func MigrationStatus(db *sqlx.DB) ([]Migration, error) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := context.Background()
+	conn, err := lock(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock(ctx, conn)
+
+	applied, err := appliedVersions(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range migrations {
+		migrations[i].Applied = applied[migrations[i].Version]
+	}
+
+	return migrations, nil
+}
+
+// lock takes the migration lock on a connection of its own. MySQL's named locks belong to
+// the session that took them, so everything that needs the lock has to run on that connection
+func lock(ctx context.Context, db *sqlx.DB) (*sql.Conn, error) {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var locked sql.NullInt64
+	err = conn.QueryRowContext(ctx, lockMigrations, migrationLock, migrationLockTimeout).Scan(&locked)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	if locked.Int64 != 1 {
+		conn.Close()
+		return nil, errors.New("err: timed out waiting for another migration to finish")
+	}
+
+	return conn, nil
+}
+
+func unlock(ctx context.Context, conn *sql.Conn) {
+	conn.ExecContext(ctx, unlockMigrations, migrationLock)
+	conn.Close()
+}
+
+// appliedVersions creates the schema table if needed and reads which migrations it records
+func appliedVersions(ctx context.Context, conn *sql.Conn) (map[int64]bool, error) {
+	if _, err := conn.ExecContext(ctx, createSchemaMigrations); err != nil {
+		return nil, err
+	}
+
+	rows, err := conn.QueryContext(ctx, getAppliedVersions)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make(map[int64]bool)
+	for rows.Next() {
+		var version int64
+		if err = rows.Scan(&version); err != nil {
+			return nil, err
+		}
+		applied[version] = true
+	}
+	return applied, rows.Err()
+}
+
+// execStatements runs a migration one statement at a time, since the driver only runs one
+// statement per Exec unless the DSN sets multiStatements. Migrations must only use
+// semicolons to end statements
+func execStatements(ctx context.Context, conn *sql.Conn, migration string) error {
+	for _, statement := range strings.Split(migration, ";") {
+		if strings.TrimSpace(statement) == "" {
+			continue
+		}
+
+		if _, err := conn.ExecContext(ctx, statement); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func loadMigrations() ([]Migration, error) {
+	files, err := fs.Glob(migrationFiles, "migrations/*.sql")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int64]*Migration)
+	for _, file := range files {
+		base := path.Base(file)
+
+		var up bool
+		switch {
+		case strings.HasSuffix(base, ".up.sql"):
+			up = true
+			base = strings.TrimSuffix(base, ".up.sql")
+		case strings.HasSuffix(base, ".down.sql"):
+			base = strings.TrimSuffix(base, ".down.sql")
+		default:
+			return nil, errors.Errorf("migration %s is neither up nor down", file)
+		}
+
+		parts := strings.SplitN(base, "_", 2)
+		if len(parts) != 2 {
+			return nil, errors.Errorf("migration %s is not named <version>_<name>", file)
+		}
+
+		version, err := strconv.ParseInt(parts[0], 10, 64)
+		if err != nil {
+			return nil, errors.Wrapf(err, "migration %s has a bad version", file)
+		}
+
+		contents, err := migrationFiles.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: parts[1]}
+			byVersion[version] = migration
+		}
+
+		statements := string(contents)
+		if up {
+			migration.up = &statements
+		} else {
+			migration.down = &statements
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.up == nil || migration.down == nil {
+			return nil, errors.Errorf("migration %d_%s needs both an up and a down file", migration.Version, migration.Name)
+		}
+		migrations = append(migrations, *migration)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
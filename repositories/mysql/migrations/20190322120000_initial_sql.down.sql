@@ -0,0 +1,4 @@
+DROP TABLE chat_message;
+DROP TABLE conversant_conversation;
+DROP TABLE conversant;
+DROP TABLE conversation;
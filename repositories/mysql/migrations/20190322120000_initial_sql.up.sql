@@ -0,0 +1,36 @@
+CREATE TABLE conversation
+(
+  id            CHAR(36) PRIMARY KEY,
+  name          VARCHAR(255)        DEFAULT NULL,
+  direct        BOOLEAN    NOT NULL DEFAULT TRUE,
+  last_sequence BIGINT     NOT NULL DEFAULT 0
+) ENGINE = InnoDB DEFAULT CHARSET = utf8mb4;
+
+CREATE TABLE conversant
+(
+  id           CHAR(36) PRIMARY KEY,
+  display_name VARCHAR(255) NOT NULL DEFAULT ''
+) ENGINE = InnoDB DEFAULT CHARSET = utf8mb4;
+
+CREATE TABLE conversant_conversation
+(
+  conversation_id CHAR(36) NOT NULL,
+  conversant_id   CHAR(36) NOT NULL,
+  PRIMARY KEY (conversation_id, conversant_id),
+  FOREIGN KEY (conversation_id) REFERENCES conversation (id),
+  FOREIGN KEY (conversant_id) REFERENCES conversant (id)
+) ENGINE = InnoDB DEFAULT CHARSET = utf8mb4;
+
+CREATE TABLE chat_message
+(
+  id              CHAR(36) PRIMARY KEY,
+  message         TEXT         NOT NULL,
+  sender          CHAR(36)     NOT NULL,
+  conversation    CHAR(36)     NOT NULL,
+  idempotency_key VARCHAR(255) DEFAULT NULL,
+  sequence        BIGINT       NOT NULL,
+  FOREIGN KEY (sender) REFERENCES conversant (id),
+  FOREIGN KEY (conversation) REFERENCES conversation (id),
+  CONSTRAINT chat_message_sender_idempotency_key UNIQUE (sender, idempotency_key),
+  CONSTRAINT chat_message_conversation_sequence UNIQUE (conversation, sequence)
+) ENGINE = InnoDB DEFAULT CHARSET = utf8mb4;
@@ -0,0 +1,5 @@
+ALTER TABLE conversant_conversation
+  DROP COLUMN last_read_sequence;
+
+ALTER TABLE conversation
+  DROP COLUMN last_activity;
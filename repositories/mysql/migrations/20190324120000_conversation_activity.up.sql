@@ -0,0 +1,9 @@
+ALTER TABLE conversation
+  ADD COLUMN last_activity DATETIME(6) NOT NULL DEFAULT CURRENT_TIMESTAMP(6);
+
+ALTER TABLE conversant_conversation
+  ADD COLUMN last_read_sequence BIGINT NOT NULL DEFAULT 0;
+
+UPDATE conversant_conversation cc
+  JOIN conversation c ON c.id = cc.conversation_id
+SET cc.last_read_sequence = c.last_sequence;
@@ -0,0 +1,17 @@
+ALTER TABLE conversant_conversation
+  ADD COLUMN role VARCHAR(16) NOT NULL DEFAULT 'member';
+
+-- groups created before roles don't record who started them, so the member with the lowest
+-- conversant ID, compared byte by byte, is made the owner and everyone else stays a member.
+-- It's arbitrary, but every backend picks the same owner, and every group gets one. MySQL
+-- can't read the table being updated in a subquery, so the lowest IDs are found in a grouped
+-- derived table, which it materializes
+UPDATE conversant_conversation cc
+  JOIN conversation c ON c.id = cc.conversation_id AND NOT c.direct
+  JOIN (
+    SELECT conversation_id, MIN(CAST(conversant_id AS BINARY)) AS conversant_id
+    FROM conversant_conversation
+    GROUP BY conversation_id
+  ) lowest ON lowest.conversation_id = cc.conversation_id
+SET cc.role = 'owner'
+WHERE CAST(cc.conversant_id AS BINARY) = lowest.conversant_id;
@@ -0,0 +1,8 @@
+CREATE TABLE conversant_block
+(
+  blocker_id CHAR(36) NOT NULL,
+  blocked_id CHAR(36) NOT NULL,
+  mute       BOOLEAN  NOT NULL DEFAULT FALSE,
+  PRIMARY KEY (blocker_id, blocked_id),
+  INDEX conversant_block_blocked_id (blocked_id)
+) ENGINE = InnoDB DEFAULT CHARSET = utf8mb4;
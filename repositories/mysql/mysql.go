@@ -0,0 +1,19 @@
+package mysql
+
+import (
+	driver "github.com/go-sql-driver/mysql"
+	"github.com/jmoiron/sqlx"
+)
+
+// Open opens a MySQL database. DATETIME columns are scanned into time.Time,
+// which the driver only does with parseTime, so it's turned on whatever the DSN says.
+// The schema isn't touched, so call Migrate before using a new database
+func Open(dataSourceName string) (*sqlx.DB, error) {
+	config, err := driver.ParseDSN(dataSourceName)
+	if err != nil {
+		return nil, err
+	}
+
+	config.ParseTime = true
+	return sqlx.Open("mysql", config.FormatDSN())
+}
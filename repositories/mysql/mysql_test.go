@@ -0,0 +1,106 @@
+package mysql
+
+import (
+	"os"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/ryan-berger/chatty/repositories/repotest"
+)
+
+// openTestDB connects to the database in MYSQL_TEST_DSN and migrates it from scratch.
+// Every chatty table in that database is dropped, so never point it at one you care about
+func openTestDB(t *testing.T) *sqlx.DB {
+	dsn := os.Getenv("MYSQL_TEST_DSN")
+	if dsn == "" {
+		t.Skip("MYSQL_TEST_DSN is not set")
+	}
+
+	db, err := Open(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	if err = db.Ping(); err != nil {
+		t.Skipf("mysql is unavailable: %s", err)
+	}
+
+	for _, table := range []string{"chatty_migrations", "conversant_block", "chat_message", "conversant_conversation", "conversant", "conversation"} {
+		if _, err = db.Exec("DROP TABLE IF EXISTS " + table); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err = Migrate(db, Up); err != nil {
+		t.Fatal(err)
+	}
+
+	return db
+}
+
+func TestConformance(t *testing.T) {
+	repotest.Run(t, func(t *testing.T) repotest.Repos {
+		db := openTestDB(t)
+		return repotest.Repos{
+			Messages:      NewMessageRepository(db),
+			Conversations: NewConversationRepository(db),
+			Conversants:   NewConversantRepository(db),
+			Blocks:        NewBlockRepository(db),
+		}
+	})
+}
+
+func TestMigrate(t *testing.T) {
+	db := openTestDB(t)
+
+	migrations, err := MigrationStatus(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, migration := range migrations {
+		if !migration.Applied {
+			t.Fatalf("expected %d_%s to be applied", migration.Version, migration.Name)
+		}
+	}
+
+	for range migrations {
+		if err = Migrate(db, Down); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	migrations, err = MigrationStatus(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, migration := range migrations {
+		if migration.Applied {
+			t.Fatalf("expected %d_%s to be rolled back", migration.Version, migration.Name)
+		}
+	}
+
+	if err = Migrate(db, Up); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadMigrations(t *testing.T) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(migrations) == 0 {
+		t.Fatal("expected embedded migrations")
+	}
+
+	for i := 1; i < len(migrations); i++ {
+		if migrations[i-1].Version >= migrations[i].Version {
+			t.Fatalf("expected migrations in version order, received %d before %d", migrations[i-1].Version, migrations[i].Version)
+		}
+	}
+}
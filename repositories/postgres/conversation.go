@@ -1,6 +1,10 @@
 package postgres
 
 import (
+	"database/sql"
+	"math"
+	"time"
+
 	"github.com/jmoiron/sqlx"
 	"github.com/pborman/uuid"
 	"github.com/pkg/errors"
@@ -12,13 +16,23 @@ INSERT INTO conversation(id, name, direct) VALUES (:id, :name, :direct)
 `
 
 const createConversantConversation = `
-INSERT INTO conversant_conversation(conversation_id, conversant_id) VALUES ($1, $2)
+INSERT INTO conversant_conversation(conversation_id, conversant_id, role) VALUES ($1, $2, $3)
+`
+
+const getConversation = `
+SELECT
+    c.id,
+    coalesce(c.name, '') AS name,
+    c.direct
+FROM conversation c
+WHERE c.id = $1
 `
 
 const getUsersFromConversation = `
 SELECT
     c.id,
-    c.display_name
+    c.display_name,
+    cc.role
 FROM conversant_conversation cc
 LEFT JOIN conversant c on cc.conversant_id = c.id
 WHERE conversation_id = $1
@@ -27,13 +41,168 @@ WHERE conversation_id = $1
 const getConversationMessages = `
 SELECT
 	m.id,
-    m.sender,
-    m.message
+    m.sender AS sender_id,
+    m.message,
+    m.conversation AS conversation_id,
+    m.sequence,
+    m.system_message
 FROM chat_message m
 WHERE m.conversation = $1
+ORDER BY m.sequence DESC
+LIMIT $2 OFFSET $3
+`
+
+// Pages by cursor are read straight off the (conversation, sequence) unique index,
+// so they stay fast and stable however many messages arrive after the first page
+const getConversationMessagesBefore = `
+SELECT
+	m.id,
+    m.sender AS sender_id,
+    m.message,
+    m.conversation AS conversation_id,
+    m.sequence,
+    m.system_message
+FROM chat_message m
+WHERE m.conversation = $1 AND m.sequence < $2
+ORDER BY m.sequence DESC
+LIMIT $3
+`
+
+const getConversationMessagesAfter = `
+SELECT * FROM (
+SELECT
+	m.id,
+    m.sender AS sender_id,
+    m.message,
+    m.conversation AS conversation_id,
+    m.sequence,
+    m.system_message
+FROM chat_message m
+WHERE m.conversation = $1 AND m.sequence > $2
+ORDER BY m.sequence
+LIMIT $3
+) page
+ORDER BY page.sequence DESC
+`
+
+// listConversations leaves out messages from conversants the reader blocked, other than mutes and
+// system messages, so the last message is the latest one they'd see and the unread count doesn't
+// include hidden ones. The newest messages are checked first, so this stops at the first shown one
+const listConversations = `
+SELECT
+    c.id,
+    coalesce(c.name, '') AS name,
+    c.direct,
+    c.last_activity,
+    c.last_sequence - cc.last_read_sequence - (
+        SELECT count(*)
+        FROM chat_message hidden
+        JOIN conversant_block b ON b.blocked_id = hidden.sender AND b.blocker_id = cc.conversant_id AND NOT b.mute
+        WHERE hidden.conversation = c.id AND hidden.sequence > cc.last_read_sequence AND NOT hidden.system_message
+    ) AS unread_count,
+    m.id AS message_id,
+    m.sender AS message_sender_id,
+    m.message,
+    m.sequence AS message_sequence,
+    m.system_message AS message_system
+FROM conversant_conversation cc
+JOIN conversation c ON c.id = cc.conversation_id
+LEFT JOIN chat_message m ON m.conversation = c.id AND m.sequence = (
+    SELECT shown.sequence
+    FROM chat_message shown
+    WHERE shown.conversation = c.id
+        AND (shown.system_message OR NOT EXISTS(
+            SELECT 1 FROM conversant_block b
+            WHERE b.blocker_id = cc.conversant_id AND b.blocked_id = shown.sender AND NOT b.mute
+        ))
+    ORDER BY shown.sequence DESC
+    LIMIT 1
+)
+WHERE cc.conversant_id = $1
+ORDER BY c.last_activity DESC, c.id
 LIMIT $2 OFFSET $3
 `
 
+const markRead = `
+UPDATE conversant_conversation SET last_read_sequence = greatest(last_read_sequence, $3)
+WHERE conversation_id = $1 AND conversant_id = $2
+`
+
+// new members start out having read everything already in the conversation
+const addConversant = `
+INSERT INTO conversant_conversation(conversation_id, conversant_id, last_read_sequence, role)
+SELECT $1, $2, c.last_sequence, $3 FROM conversation c WHERE c.id = $1
+ON CONFLICT DO NOTHING
+`
+
+const isConversant = `
+SELECT EXISTS(SELECT 1 FROM conversant_conversation WHERE conversation_id = $1 AND conversant_id = $2)
+`
+
+const removeConversant = `
+DELETE FROM conversant_conversation WHERE conversation_id = $1 AND conversant_id = $2
+`
+
+const setRole = `
+UPDATE conversant_conversation SET role = $1
+WHERE conversation_id = $2 AND conversant_id = $3
+`
+
+const renameConversation = `
+UPDATE conversation SET name = $1 WHERE id = $2
+`
+
+// a conversation's messages and memberships reference it, so they're deleted first
+const deleteConversationMessages = `
+DELETE FROM chat_message WHERE conversation = $1
+`
+
+const deleteConversationConversants = `
+DELETE FROM conversant_conversation WHERE conversation_id = $1
+`
+
+const deleteConversation = `
+DELETE FROM conversation WHERE id = $1
+`
+
+// conversationSummaryRow is a row of listConversations. The last message
+// columns are null when the conversation has no messages yet
+type conversationSummaryRow struct {
+	ID              string         `db:"id"`
+	Name            string         `db:"name"`
+	Direct          bool           `db:"direct"`
+	LastActivity    time.Time      `db:"last_activity"`
+	UnreadCount     int64          `db:"unread_count"`
+	MessageID       sql.NullString `db:"message_id"`
+	MessageSenderID sql.NullString `db:"message_sender_id"`
+	Message         sql.NullString `db:"message"`
+	MessageSequence sql.NullInt64  `db:"message_sequence"`
+	MessageSystem   sql.NullBool   `db:"message_system"`
+}
+
+func (row conversationSummaryRow) summary() repositories.ConversationSummary {
+	summary := repositories.ConversationSummary{
+		ID:           row.ID,
+		Name:         row.Name,
+		Direct:       row.Direct,
+		UnreadCount:  row.UnreadCount,
+		LastActivity: row.LastActivity,
+	}
+
+	if row.MessageID.Valid {
+		summary.LastMessage = &repositories.Message{
+			ID:             row.MessageID.String,
+			SenderID:       row.MessageSenderID.String,
+			Message:        row.Message.String,
+			ConversationID: row.ID,
+			Sequence:       row.MessageSequence.Int64,
+			System:         row.MessageSystem.Bool,
+		}
+	}
+
+	return summary
+}
+
 // ConversationRepository is an implementation of ConversationRepo
 // that uses Postgres as it's backend
 type ConversationRepository struct {
@@ -71,7 +240,7 @@ func (repo *ConversationRepository) CreateConversation(conversation repositories
 
 func addConversants(tx *sqlx.Tx, conversationID string, conversants []repositories.Conversant) error {
 	for _, conversant := range conversants {
-		_, err := tx.Exec(createConversantConversation, &conversationID, &conversant.ID)
+		_, err := tx.Exec(createConversantConversation, &conversationID, &conversant.ID, conversant.Role.OrMember())
 
 		if err != nil {
 			tx.Rollback()
@@ -83,10 +252,27 @@ func addConversants(tx *sqlx.Tx, conversationID string, conversants []repositori
 
 // RetrieveConversation grabs a conversation with the messages given a limit and offset
 func (repo *ConversationRepository) RetrieveConversation(conversationID string, limit, offset int) (*repositories.Conversation, error) {
-	var conversation repositories.Conversation
+	return repo.retrieveConversation(conversationID, getConversationMessages, &conversationID, &limit, &offset)
+}
+
+// RetrieveConversationPage grabs a conversation with up to limit messages on the given side of the cursor
+func (repo *ConversationRepository) RetrieveConversationPage(conversationID string, cursor repositories.Cursor, limit int) (*repositories.Conversation, error) {
+	if cursor.After > 0 {
+		return repo.retrieveConversation(conversationID, getConversationMessagesAfter, &conversationID, &cursor.After, &limit)
+	}
+
+	before := cursor.Before
+	if before == 0 {
+		before = math.MaxInt64
+	}
 
-	err := repo.db.Get(&conversation, createConversantConversation)
+	return repo.retrieveConversation(conversationID, getConversationMessagesBefore, &conversationID, &before, &limit)
+}
 
+func (repo *ConversationRepository) retrieveConversation(conversationID string, messagesQuery string, args ...interface{}) (*repositories.Conversation, error) {
+	var conversation repositories.Conversation
+
+	err := repo.db.Get(&conversation, getConversation, &conversationID)
 	if err != nil {
 		return nil, err
 	}
@@ -96,7 +282,7 @@ func (repo *ConversationRepository) RetrieveConversation(conversationID string,
 		return nil, err
 	}
 
-	err = repo.db.Get(&(conversation.Messages), getConversationMessages, &conversationID, &limit, &offset)
+	err = repo.db.Select(&(conversation.Messages), messagesQuery, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -121,3 +307,117 @@ func NewConversationRepository(db *sqlx.DB) *ConversationRepository {
 		db: db,
 	}
 }
+
+// ListConversations returns a page of the conversant's conversations, most recently active first
+func (repo *ConversationRepository) ListConversations(conversantID string, limit, offset int) ([]repositories.ConversationSummary, error) {
+	var rows []conversationSummaryRow
+	err := repo.db.Select(&rows, listConversations, &conversantID, &limit, &offset)
+	if err != nil {
+		return nil, err
+	}
+
+	summaries := make([]repositories.ConversationSummary, 0, len(rows))
+	for _, row := range rows {
+		summaries = append(summaries, row.summary())
+	}
+
+	return summaries, nil
+}
+
+// MarkRead moves the conversant's read position in the conversation forward to sequence
+func (repo *ConversationRepository) MarkRead(conversationID, conversantID string, sequence int64) error {
+	_, err := repo.db.Exec(markRead, &conversationID, &conversantID, &sequence)
+	return err
+}
+
+// AddConversants adds the conversants to the conversation in a transaction
+func (repo *ConversationRepository) AddConversants(conversationID string, conversants []repositories.Conversant) error {
+	tx, err := repo.db.Beginx()
+	if err != nil {
+		return err
+	}
+
+	for _, conversant := range conversants {
+		_, err = tx.Exec(addConversant, &conversationID, &conversant.ID, conversant.Role.OrMember())
+		if err != nil {
+			tx.Rollback()
+			return errors.Wrap(err, "err: Adding Conversants")
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return errors.Wrap(err, "commit: error comitting AddConversants")
+	}
+
+	return nil
+}
+
+// RemoveConversants removes the conversants from the conversation in a transaction
+func (repo *ConversationRepository) RemoveConversants(conversationID string, conversantIDs []string) error {
+	tx, err := repo.db.Beginx()
+	if err != nil {
+		return err
+	}
+
+	for _, conversantID := range conversantIDs {
+		_, err = tx.Exec(removeConversant, &conversationID, &conversantID)
+		if err != nil {
+			tx.Rollback()
+			return errors.Wrap(err, "err: Removing Conversants")
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return errors.Wrap(err, "commit: error comitting RemoveConversants")
+	}
+
+	return nil
+}
+
+// IsConversant reports whether the conversant is in the conversation
+func (repo *ConversationRepository) IsConversant(conversationID, conversantID string) (bool, error) {
+	var member bool
+	err := repo.db.Get(&member, isConversant, conversationID, conversantID)
+	if err != nil {
+		return false, err
+	}
+
+	return member, nil
+}
+
+// SetRole changes the conversant's role in the conversation
+func (repo *ConversationRepository) SetRole(conversationID, conversantID string, role repositories.Role) error {
+	_, err := repo.db.Exec(setRole, &role, &conversationID, &conversantID)
+	return err
+}
+
+// RenameConversation changes the conversation's name
+func (repo *ConversationRepository) RenameConversation(conversationID, name string) error {
+	_, err := repo.db.Exec(renameConversation, &name, &conversationID)
+	return err
+}
+
+// DeleteConversation deletes the conversation with its messages and memberships in a transaction
+func (repo *ConversationRepository) DeleteConversation(conversationID string) error {
+	tx, err := repo.db.Beginx()
+	if err != nil {
+		return err
+	}
+
+	for _, query := range []string{deleteConversationMessages, deleteConversationConversants, deleteConversation} {
+		_, err = tx.Exec(query, &conversationID)
+		if err != nil {
+			tx.Rollback()
+			return errors.Wrap(err, "err: Deleting Conversation")
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return errors.Wrap(err, "commit: error comitting DeleteConversation")
+	}
+
+	return nil
+}
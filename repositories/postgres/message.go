@@ -1,14 +1,53 @@
 package postgres
 
 import (
+	"database/sql"
+
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 	"github.com/pborman/uuid"
+	"github.com/pkg/errors"
 	"github.com/ryan-berger/chatty/repositories"
 )
 
+const idempotencyKeyConstraint = "chat_message_sender_idempotency_key"
+
+const nextSequence = `
+UPDATE conversation SET last_sequence = last_sequence + 1, last_activity = now()
+WHERE id = $1
+RETURNING last_sequence
+`
+
 const createMessage = `
-INSERT INTO  chat_message(id, message, sender, conversation) 
-VALUES (:id, :message, :sender_id, :conversation_id)
+INSERT INTO  chat_message(id, message, sender, conversation, idempotency_key, sequence, system_message)
+VALUES (:id, :message, :sender_id, :conversation_id, NULLIF(:idempotency_key, ''), :sequence, :system_message)
+`
+
+const getMessageByIdempotencyKey = `
+SELECT
+	m.id,
+	m.message,
+	m.sender AS sender_id,
+	m.conversation AS conversation_id,
+	m.idempotency_key,
+	m.sequence,
+	m.system_message
+FROM chat_message m
+WHERE m.sender = $1 AND m.idempotency_key = $2
+`
+
+const getMessagesAfter = `
+SELECT
+	m.id,
+	m.message,
+	m.sender AS sender_id,
+	m.conversation AS conversation_id,
+	m.sequence,
+	m.system_message
+FROM chat_message m
+WHERE m.conversation = $1 AND m.sequence > $2
+ORDER BY m.sequence
+LIMIT $3
 `
 
 // MessageRepository is a MessageRepo implementation that uses Postgres to store messages
@@ -16,18 +55,73 @@ type MessageRepository struct {
 	db *sqlx.DB
 }
 
-// CreateMessage stores a message in Postgres
+// CreateMessage stores a message in Postgres, giving it the next sequence number in its
+// conversation. Bumping the conversation's last_sequence locks the conversation row until
+// the transaction finishes, so concurrent messages are numbered one after another. When the
+// sender has already used the message's idempotency key, the original message is returned instead
 func (repo *MessageRepository) CreateMessage(message repositories.Message) (*repositories.Message, error) {
-	message.ID = uuid.New()
-	_, err := repo.db.NamedExec(createMessage, &message)
+	if message.ID == "" {
+		message.ID = uuid.New()
+	}
+
+	if message.IdempotencyKey != "" {
+		original, err := repo.getByIdempotencyKey(message.SenderID, message.IdempotencyKey)
+		if err == nil {
+			return original, nil
+		}
+		if err != sql.ErrNoRows {
+			return nil, err
+		}
+	}
 
+	tx, err := repo.db.Beginx()
 	if err != nil {
 		return nil, err
 	}
 
+	err = tx.Get(&message.Sequence, nextSequence, &message.ConversationID)
+	if err != nil {
+		tx.Rollback()
+		return nil, errors.Wrap(err, "err: getting next sequence")
+	}
+
+	_, err = tx.NamedExec(createMessage, &message)
+	if err != nil {
+		tx.Rollback()
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Constraint == idempotencyKeyConstraint {
+			return repo.getByIdempotencyKey(message.SenderID, message.IdempotencyKey)
+		}
+		return nil, errors.Wrap(err, "err: creating message")
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, errors.Wrap(err, "commit: error comitting CreateMessage")
+	}
+
 	return &message, nil
 }
 
+// GetMessagesAfter returns up to limit messages in the conversation after the given sequence
+func (repo *MessageRepository) GetMessagesAfter(conversationID string, sequence int64, limit int) ([]repositories.Message, error) {
+	var messages []repositories.Message
+	err := repo.db.Select(&messages, getMessagesAfter, &conversationID, &sequence, &limit)
+	if err != nil {
+		return nil, err
+	}
+
+	return messages, nil
+}
+
+func (repo *MessageRepository) getByIdempotencyKey(senderID, idempotencyKey string) (*repositories.Message, error) {
+	var original repositories.Message
+	err := repo.db.Get(&original, getMessageByIdempotencyKey, &senderID, &idempotencyKey)
+	if err != nil {
+		return nil, err
+	}
+	return &original, nil
+}
+
 // NewMessageRepository creates a new Postgres MessageRepository
 func NewMessageRepository(db *sqlx.DB) *MessageRepository {
 	return &MessageRepository{
@@ -0,0 +1,391 @@
+package postgres
+
+import (
+	"database/sql"
+	"embed"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// Direction is which way Migrate moves the schema
+type Direction int
+
+const (
+	// Up applies every migration that hasn't been applied yet
+	Up Direction = iota
+	// Down rolls back the most recently applied migration. Use Rollback for more than one
+	Down
+)
+
+// migrationLock is the advisory lock key held while migrating, so that
+// servers migrating on startup at the same time don't race each other
+const migrationLock = 7261656
+
+const createSchemaMigrations = `
+CREATE TABLE IF NOT EXISTS chatty_migrations
+(
+  version    BIGINT PRIMARY KEY,
+  name       TEXT        NOT NULL,
+  applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+)
+`
+
+const lockMigrations = `SELECT pg_advisory_xact_lock($1)`
+
+const getAppliedVersions = `SELECT version FROM chatty_migrations`
+
+const insertVersion = `INSERT INTO chatty_migrations(version, name) VALUES ($1, $2)`
+
+const deleteVersion = `DELETE FROM chatty_migrations WHERE version = $1`
+
+const tableExists = `
+SELECT EXISTS(SELECT 1 FROM information_schema.tables WHERE table_schema = current_schema() AND table_name = $1)
+`
+
+// getLegacyVersion reads the single row golang-migrate keeps in schema_migrations
+const getLegacyVersion = `SELECT version, dirty FROM schema_migrations LIMIT 1`
+
+// Migration is a single schema change, read from a pair of
+// <version>_<name>.up.sql and .down.sql files
+type Migration struct {
+	Version int64
+	Name    string
+	Applied bool
+	up      *string
+	down    *string
+}
+
+// Migrate moves the schema in the given direction. Everything runs in one transaction,
+// so a failed migration leaves the schema as it was
+func Migrate(db *sqlx.DB, direction Direction) error {
+	switch direction {
+	case Up:
+		return inMigration(db, up)
+	case Down:
+		return Rollback(db, 1)
+	default:
+		return errors.Errorf("unknown migration direction %d", direction)
+	}
+}
+
+// Rollback rolls back the given number of most recently applied migrations, stopping early
+// if it runs out. Like Migrate, it runs in one transaction
+func Rollback(db *sqlx.DB, steps int) error {
+	if steps < 1 {
+		return errors.Errorf("can't roll back %d migrations", steps)
+	}
+
+	return inMigration(db, func(tx *sqlx.Tx, migrations []Migration, applied map[int64]bool) error {
+		return down(tx, migrations, applied, steps)
+	})
+}
+
+// Baseline records every migration up to and including version as applied without running it.
+// It adopts a database whose schema was migrated by hand, so that Migrate only applies what's newer
+func Baseline(db *sqlx.DB, version int64) error {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return err
+	}
+
+	known := false
+	for _, migration := range migrations {
+		if migration.Version == version {
+			known = true
+			break
+		}
+	}
+	if !known {
+		return errors.Errorf("there is no migration with version %d", version)
+	}
+
+	tx, err := db.Beginx()
+	if err != nil {
+		return err
+	}
+
+	applied, err := appliedVersions(tx)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if len(applied) > 0 {
+		tx.Rollback()
+		return errors.New("err: the database already has applied migrations")
+	}
+
+	if err = record(tx, migrations, version); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return errors.Wrap(err, "commit: error comitting Baseline")
+	}
+
+	return nil
+}
+
+// MigrationStatus lists every known migration, oldest first, and whether it has been applied
+func MigrationStatus(db *sqlx.DB) ([]Migration, error) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := db.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	applied, err := appliedVersions(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = adopt(tx, migrations, applied); err != nil {
+		return nil, err
+	}
+
+	for i := range migrations {
+		migrations[i].Applied = applied[migrations[i].Version]
+	}
+
+	return migrations, nil
+}
+
+type migrateFunc func(tx *sqlx.Tx, migrations []Migration, applied map[int64]bool) error
+
+// inMigration runs fn in a transaction holding the migration lock, with the migrations already applied
+func inMigration(db *sqlx.DB, fn migrateFunc) error {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.Beginx()
+	if err != nil {
+		return err
+	}
+
+	applied, err := appliedVersions(tx)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err = adopt(tx, migrations, applied); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err = fn(tx, migrations, applied); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return errors.Wrap(err, "commit: error comitting Migrate")
+	}
+
+	return nil
+}
+
+func up(tx *sqlx.Tx, migrations []Migration, applied map[int64]bool) error {
+	for _, migration := range migrations {
+		if applied[migration.Version] {
+			continue
+		}
+
+		if _, err := tx.Exec(*migration.up); err != nil {
+			return errors.Wrapf(err, "err: applying migration %d_%s", migration.Version, migration.Name)
+		}
+
+		if _, err := tx.Exec(insertVersion, migration.Version, migration.Name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func down(tx *sqlx.Tx, migrations []Migration, applied map[int64]bool, steps int) error {
+	for i := len(migrations) - 1; i >= 0 && steps > 0; i-- {
+		migration := migrations[i]
+		if !applied[migration.Version] {
+			continue
+		}
+
+		if _, err := tx.Exec(*migration.down); err != nil {
+			return errors.Wrapf(err, "err: rolling back migration %d_%s", migration.Version, migration.Name)
+		}
+
+		if _, err := tx.Exec(deleteVersion, migration.Version); err != nil {
+			return err
+		}
+		steps--
+	}
+	return nil
+}
+
+// appliedVersions creates the schema table if needed, then locks it for the rest of the transaction
+func appliedVersions(tx *sqlx.Tx) (map[int64]bool, error) {
+	if _, err := tx.Exec(lockMigrations, migrationLock); err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.Exec(createSchemaMigrations); err != nil {
+		return nil, err
+	}
+
+	var versions []int64
+	if err := tx.Select(&versions, getAppliedVersions); err != nil {
+		return nil, err
+	}
+
+	applied := make(map[int64]bool, len(versions))
+	for _, version := range versions {
+		applied[version] = true
+	}
+	return applied, nil
+}
+
+// adopt fills in applied for a database migrated before chatty_migrations existed. Versions
+// golang-migrate recorded in schema_migrations are taken as applied. A schema that was
+// migrated by hand can't be dated, so it's refused until someone runs Baseline
+func adopt(tx *sqlx.Tx, migrations []Migration, applied map[int64]bool) error {
+	if len(applied) > 0 {
+		return nil
+	}
+
+	var exists bool
+	if err := tx.Get(&exists, tableExists, "schema_migrations"); err != nil {
+		return err
+	}
+
+	if exists {
+		var legacy struct {
+			Version int64 `db:"version"`
+			Dirty   bool  `db:"dirty"`
+		}
+
+		err := tx.Get(&legacy, getLegacyVersion)
+		switch {
+		case err == sql.ErrNoRows:
+		case err != nil:
+			return err
+		case legacy.Dirty:
+			return errors.Errorf("err: schema_migrations is dirty at version %d, fix the schema by hand first", legacy.Version)
+		default:
+			if err = record(tx, migrations, legacy.Version); err != nil {
+				return err
+			}
+			for _, migration := range migrations {
+				if migration.Version <= legacy.Version {
+					applied[migration.Version] = true
+				}
+			}
+			return nil
+		}
+	}
+
+	if err := tx.Get(&exists, tableExists, "conversation"); err != nil {
+		return err
+	}
+
+	if exists {
+		return errors.New("err: the database has a schema but no recorded migrations, run chatty migrate baseline <version> first")
+	}
+	return nil
+}
+
+// record marks every migration up to and including version as applied
+func record(tx *sqlx.Tx, migrations []Migration, version int64) error {
+	for _, migration := range migrations {
+		if migration.Version > version {
+			break
+		}
+
+		if _, err := tx.Exec(insertVersion, migration.Version, migration.Name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func loadMigrations() ([]Migration, error) {
+	files, err := fs.Glob(migrationFiles, "migrations/*.sql")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int64]*Migration)
+	for _, file := range files {
+		base := path.Base(file)
+
+		var up bool
+		switch {
+		case strings.HasSuffix(base, ".up.sql"):
+			up = true
+			base = strings.TrimSuffix(base, ".up.sql")
+		case strings.HasSuffix(base, ".down.sql"):
+			base = strings.TrimSuffix(base, ".down.sql")
+		default:
+			return nil, errors.Errorf("migration %s is neither up nor down", file)
+		}
+
+		parts := strings.SplitN(base, "_", 2)
+		if len(parts) != 2 {
+			return nil, errors.Errorf("migration %s is not named <version>_<name>", file)
+		}
+
+		version, err := strconv.ParseInt(parts[0], 10, 64)
+		if err != nil {
+			return nil, errors.Wrapf(err, "migration %s has a bad version", file)
+		}
+
+		contents, err := migrationFiles.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: parts[1]}
+			byVersion[version] = migration
+		}
+
+		sql := string(contents)
+		if up {
+			migration.up = &sql
+		} else {
+			migration.down = &sql
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.up == nil || migration.down == nil {
+			return nil, errors.Errorf("migration %d_%s needs both an up and a down file", migration.Version, migration.Name)
+		}
+		migrations = append(migrations, *migration)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
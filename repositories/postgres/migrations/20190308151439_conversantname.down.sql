@@ -0,0 +1,3 @@
+ALTER TABLE conversant
+  ADD COLUMN external_id UUID UNIQUE,
+  DROP COLUMN name;
\ No newline at end of file
@@ -0,0 +1,3 @@
+ALTER TABLE chat_message
+  DROP CONSTRAINT chat_message_sender_idempotency_key,
+  DROP COLUMN idempotency_key;
@@ -0,0 +1,3 @@
+ALTER TABLE chat_message
+  ADD COLUMN idempotency_key TEXT DEFAULT NULL,
+  ADD CONSTRAINT chat_message_sender_idempotency_key UNIQUE (sender, idempotency_key);
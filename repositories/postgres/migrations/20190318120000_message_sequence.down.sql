@@ -0,0 +1,6 @@
+ALTER TABLE chat_message
+  DROP CONSTRAINT chat_message_conversation_sequence,
+  DROP COLUMN sequence;
+
+ALTER TABLE conversation
+  DROP COLUMN last_sequence;
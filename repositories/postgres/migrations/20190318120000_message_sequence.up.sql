@@ -0,0 +1,24 @@
+ALTER TABLE conversation
+  ADD COLUMN last_sequence BIGINT NOT NULL DEFAULT 0;
+
+ALTER TABLE chat_message
+  ADD COLUMN sequence BIGINT;
+
+-- chat_message has never stored when a message was sent, so there's no way to recover the order
+-- existing messages were sent in. They're numbered by ID, which is a random UUID, so their order
+-- within each conversation is arbitrary, but stable. Only messages sent after this migration
+-- are numbered in the order they were sent
+UPDATE chat_message m
+SET sequence = numbered.sequence
+FROM (
+  SELECT id, row_number() OVER (PARTITION BY conversation ORDER BY id) AS sequence
+  FROM chat_message
+) numbered
+WHERE m.id = numbered.id;
+
+UPDATE conversation c
+SET last_sequence = (SELECT coalesce(max(m.sequence), 0) FROM chat_message m WHERE m.conversation = c.id);
+
+ALTER TABLE chat_message
+  ALTER COLUMN sequence SET NOT NULL,
+  ADD CONSTRAINT chat_message_conversation_sequence UNIQUE (conversation, sequence);
@@ -0,0 +1,7 @@
+DROP INDEX conversant_conversation_conversant_id;
+
+ALTER TABLE conversant_conversation
+  DROP COLUMN last_read_sequence;
+
+ALTER TABLE conversation
+  DROP COLUMN last_activity;
@@ -0,0 +1,12 @@
+ALTER TABLE conversation
+  ADD COLUMN last_activity TIMESTAMPTZ NOT NULL DEFAULT now();
+
+ALTER TABLE conversant_conversation
+  ADD COLUMN last_read_sequence BIGINT NOT NULL DEFAULT 0;
+
+UPDATE conversant_conversation cc
+SET last_read_sequence = c.last_sequence
+FROM conversation c
+WHERE c.id = cc.conversation_id;
+
+CREATE INDEX conversant_conversation_conversant_id ON conversant_conversation (conversant_id);
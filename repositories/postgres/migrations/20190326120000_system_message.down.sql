@@ -0,0 +1,2 @@
+ALTER TABLE chat_message
+  DROP COLUMN system_message;
@@ -0,0 +1,2 @@
+ALTER TABLE chat_message
+  ADD COLUMN system_message BOOLEAN NOT NULL DEFAULT FALSE;
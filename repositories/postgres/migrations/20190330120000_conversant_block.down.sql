@@ -0,0 +1 @@
+DROP TABLE conversant_block;
@@ -0,0 +1,191 @@
+package postgres
+
+import (
+	"os"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/lib/pq"
+
+	"github.com/ryan-berger/chatty/repositories/repotest"
+)
+
+// openTestDB connects to the database in POSTGRES_TEST_DSN and migrates a fresh public schema.
+// Everything in that database is dropped, so never point it at one you care about
+func openTestDB(t *testing.T) *sqlx.DB {
+	dsn := os.Getenv("POSTGRES_TEST_DSN")
+	if dsn == "" {
+		t.Skip("POSTGRES_TEST_DSN is not set")
+	}
+
+	db, err := sqlx.Open("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	if err = db.Ping(); err != nil {
+		t.Skipf("postgres is unavailable: %s", err)
+	}
+
+	if _, err = db.Exec("DROP SCHEMA public CASCADE; CREATE SCHEMA public"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = Migrate(db, Up); err != nil {
+		t.Fatal(err)
+	}
+
+	return db
+}
+
+func TestConformance(t *testing.T) {
+	repotest.Run(t, func(t *testing.T) repotest.Repos {
+		db := openTestDB(t)
+		return repotest.Repos{
+			Messages:      NewMessageRepository(db),
+			Conversations: NewConversationRepository(db),
+			Conversants:   NewConversantRepository(db),
+			Blocks:        NewBlockRepository(db),
+		}
+	})
+}
+
+func TestMigrate(t *testing.T) {
+	db := openTestDB(t)
+
+	migrations, err := MigrationStatus(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, migration := range migrations {
+		if !migration.Applied {
+			t.Fatalf("expected %d_%s to be applied", migration.Version, migration.Name)
+		}
+	}
+
+	if err = Migrate(db, Down); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = Rollback(db, len(migrations)-1); err != nil {
+		t.Fatal(err)
+	}
+
+	migrations, err = MigrationStatus(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, migration := range migrations {
+		if migration.Applied {
+			t.Fatalf("expected %d_%s to be rolled back", migration.Version, migration.Name)
+		}
+	}
+
+	if err = Migrate(db, Up); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBaseline(t *testing.T) {
+	db := openTestDB(t)
+
+	migrations, err := loadMigrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = Baseline(db, migrations[0].Version); err == nil {
+		t.Fatal("expected baselining a tracked database to fail")
+	}
+
+	// forget every recorded migration, leaving the schema behind as if it was migrated by hand
+	if _, err = db.Exec("DROP TABLE chatty_migrations"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = Migrate(db, Up); err == nil {
+		t.Fatal("expected migrating an untracked schema to fail")
+	}
+
+	if err = Baseline(db, 1); err == nil {
+		t.Fatal("expected baselining an unknown version to fail")
+	}
+
+	if err = Baseline(db, migrations[len(migrations)-1].Version); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = Migrate(db, Up); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAdoptSchemaMigrations(t *testing.T) {
+	db := openTestDB(t)
+
+	migrations, err := loadMigrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// roll back the newest migration, then hand the rest over to golang-migrate's table
+	if err = Migrate(db, Down); err != nil {
+		t.Fatal(err)
+	}
+
+	last := migrations[len(migrations)-2].Version
+	if _, err = db.Exec("DROP TABLE chatty_migrations"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = db.Exec("CREATE TABLE schema_migrations (version BIGINT PRIMARY KEY, dirty BOOLEAN NOT NULL)"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = db.Exec("INSERT INTO schema_migrations VALUES ($1, TRUE)", last); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = Migrate(db, Up); err == nil {
+		t.Fatal("expected a dirty schema_migrations to fail")
+	}
+
+	if _, err = db.Exec("UPDATE schema_migrations SET dirty = FALSE"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = Migrate(db, Up); err != nil {
+		t.Fatal(err)
+	}
+
+	status, err := MigrationStatus(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, migration := range status {
+		if !migration.Applied {
+			t.Fatalf("expected %d_%s to be applied", migration.Version, migration.Name)
+		}
+	}
+}
+
+func TestLoadMigrations(t *testing.T) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(migrations) == 0 {
+		t.Fatal("expected embedded migrations")
+	}
+
+	for i := 1; i < len(migrations); i++ {
+		if migrations[i-1].Version >= migrations[i].Version {
+			t.Fatalf("expected migrations in version order, received %d before %d", migrations[i-1].Version, migrations[i].Version)
+		}
+	}
+}
@@ -0,0 +1,912 @@
+// Package repotest is a conformance suite for repository backends. Every
+// backend should pass Run, so the connection manager behaves the same
+// no matter where its data is kept
+package repotest
+
+import (
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/pborman/uuid"
+
+	"github.com/ryan-berger/chatty/repositories"
+)
+
+// Repos is the set of repositories a backend provides
+type Repos struct {
+	Messages      repositories.MessageRepo
+	Conversations repositories.ConversationRepo
+	Conversants   repositories.ConversantRepo
+	Blocks        repositories.BlockRepo
+}
+
+// Factory creates repositories with nothing stored in them. It is called
+// once per test, and should use t to skip or clean up
+type Factory func(t *testing.T) Repos
+
+// Run runs every conformance test against the repositories made by factory
+func Run(t *testing.T, factory Factory) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, repos Repos)
+	}{
+		{"UpdateOrCreate", testUpdateOrCreate},
+		{"CreateConversation", testCreateConversation},
+		{"CreateConversationUnknownConversant", testCreateConversationUnknownConversant},
+		{"RetrieveConversation", testRetrieveConversation},
+		{"RetrieveConversationPagination", testRetrieveConversationPagination},
+		{"RetrieveConversationPage", testRetrieveConversationPage},
+		{"RetrieveConversationNotFound", testRetrieveConversationNotFound},
+		{"ListConversations", testListConversations},
+		{"ListConversationsBlocked", testListConversationsBlocked},
+		{"MarkRead", testMarkRead},
+		{"AddConversants", testAddConversants},
+		{"RemoveConversants", testRemoveConversants},
+		{"IsConversant", testIsConversant},
+		{"Roles", testRoles},
+		{"SetRole", testSetRole},
+		{"RenameConversation", testRenameConversation},
+		{"DeleteConversation", testDeleteConversation},
+		{"CreateMessageSequence", testCreateMessageSequence},
+		{"CreateMessageIdempotency", testCreateMessageIdempotency},
+		{"GetMessagesAfter", testGetMessagesAfter},
+		{"Block", testBlock},
+		{"GetBlockers", testGetBlockers},
+		{"GetBlocked", testGetBlocked},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			test.test(t, factory(t))
+		})
+	}
+}
+
+func createConversants(t *testing.T, repos Repos, names ...string) []repositories.Conversant {
+	var conversants []repositories.Conversant
+	for _, name := range names {
+		conversant, err := repos.Conversants.UpdateOrCreate(repositories.Conversant{ID: uuid.New(), DisplayName: name})
+		if err != nil {
+			t.Fatal(err)
+		}
+		conversants = append(conversants, *conversant)
+	}
+	return conversants
+}
+
+func createConversation(t *testing.T, repos Repos) (*repositories.Conversation, []repositories.Conversant) {
+	conversants := createConversants(t, repos, "a", "b")
+
+	conversation, err := repos.Conversations.CreateConversation(repositories.Conversation{
+		Name:        "test",
+		Direct:      true,
+		Conversants: conversants,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return conversation, conversants
+}
+
+func createMessages(t *testing.T, repos Repos, conversation *repositories.Conversation, sender string, count int) {
+	for i := 0; i < count; i++ {
+		_, err := repos.Messages.CreateMessage(repositories.Message{
+			SenderID:       sender,
+			ConversationID: conversation.ID,
+			Message:        "test",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func sortConversants(conversants []repositories.Conversant) []repositories.Conversant {
+	sorted := append([]repositories.Conversant(nil), conversants...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].ID < sorted[j].ID
+	})
+	return sorted
+}
+
+func checkConversants(t *testing.T, expected, received []repositories.Conversant) {
+	t.Helper()
+
+	expected = sortConversants(expected)
+	received = sortConversants(received)
+
+	if len(expected) != len(received) {
+		t.Fatalf("expected conversants %+v, received %+v", expected, received)
+	}
+
+	for i := range expected {
+		// conversants are members unless they were given another role
+		expected[i].Role = expected[i].Role.OrMember()
+		if expected[i] != received[i] {
+			t.Fatalf("expected conversants %+v, received %+v", expected, received)
+		}
+	}
+}
+
+func checkSequences(t *testing.T, messages []repositories.Message, sequences ...int64) {
+	t.Helper()
+
+	if len(messages) != len(sequences) {
+		t.Fatalf("expected sequences %v, received messages %+v", sequences, messages)
+	}
+
+	for i, sequence := range sequences {
+		if messages[i].Sequence != sequence {
+			t.Fatalf("expected sequences %v, received messages %+v", sequences, messages)
+		}
+	}
+}
+
+func testUpdateOrCreate(t *testing.T, repos Repos) {
+	conversation, conversants := createConversation(t, repos)
+
+	conversants[0].DisplayName = "renamed"
+	updated, err := repos.Conversants.UpdateOrCreate(conversants[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if *updated != conversants[0] {
+		t.Fatalf("expected %+v, received %+v", conversants[0], updated)
+	}
+
+	received, err := repos.Conversations.GetConversants(conversation.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkConversants(t, conversants, received)
+}
+
+func testCreateConversation(t *testing.T, repos Repos) {
+	first, conversants := createConversation(t, repos)
+	second, _ := createConversation(t, repos)
+
+	if first.ID == "" || first.ID == second.ID {
+		t.Fatalf("expected unique conversation IDs, received %q and %q", first.ID, second.ID)
+	}
+
+	if first.Name != "test" || !first.Direct {
+		t.Fatalf("conversation created incorrectly: %+v", first)
+	}
+
+	received, err := repos.Conversations.GetConversants(first.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkConversants(t, conversants, received)
+}
+
+func testCreateConversationUnknownConversant(t *testing.T, repos Repos) {
+	conversants := createConversants(t, repos, "a")
+	conversants = append(conversants, repositories.Conversant{ID: uuid.New(), DisplayName: "unknown"})
+
+	_, err := repos.Conversations.CreateConversation(repositories.Conversation{
+		Name:        "test",
+		Conversants: conversants,
+	})
+
+	if err == nil {
+		t.Fatal("expected an error creating a conversation with an unknown conversant")
+	}
+}
+
+func testRetrieveConversation(t *testing.T, repos Repos) {
+	conversation, conversants := createConversation(t, repos)
+	createMessages(t, repos, conversation, conversants[0].ID, 3)
+
+	retrieved, err := repos.Conversations.RetrieveConversation(conversation.ID, 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if retrieved.ID != conversation.ID || retrieved.Name != "test" || !retrieved.Direct {
+		t.Fatalf("conversation retrieved incorrectly: %+v", retrieved)
+	}
+
+	checkConversants(t, conversants, retrieved.Conversants)
+	checkSequences(t, retrieved.Messages, 3, 2, 1)
+
+	for _, message := range retrieved.Messages {
+		if message.ID == "" || message.SenderID != conversants[0].ID ||
+			message.ConversationID != conversation.ID || message.Message != "test" {
+			t.Fatalf("message retrieved incorrectly: %+v", message)
+		}
+	}
+}
+
+func testRetrieveConversationPagination(t *testing.T, repos Repos) {
+	conversation, conversants := createConversation(t, repos)
+	createMessages(t, repos, conversation, conversants[0].ID, 5)
+
+	pages := []struct {
+		limit, offset int
+		sequences     []int64
+	}{
+		{2, 0, []int64{5, 4}},
+		{2, 2, []int64{3, 2}},
+		{2, 4, []int64{1}},
+		{2, 5, nil},
+	}
+
+	for _, page := range pages {
+		retrieved, err := repos.Conversations.RetrieveConversation(conversation.ID, page.limit, page.offset)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		checkSequences(t, retrieved.Messages, page.sequences...)
+	}
+}
+
+func testRetrieveConversationPage(t *testing.T, repos Repos) {
+	conversation, conversants := createConversation(t, repos)
+	createMessages(t, repos, conversation, conversants[0].ID, 5)
+
+	pages := []struct {
+		cursor    repositories.Cursor
+		limit     int
+		sequences []int64
+	}{
+		{repositories.Cursor{}, 2, []int64{5, 4}},
+		{repositories.Cursor{Before: 4}, 2, []int64{3, 2}},
+		{repositories.Cursor{Before: 2}, 5, []int64{1}},
+		{repositories.Cursor{Before: 1}, 5, nil},
+		{repositories.Cursor{Before: 100}, 2, []int64{5, 4}},
+		{repositories.Cursor{After: 2}, 2, []int64{4, 3}},
+		{repositories.Cursor{After: 4}, 5, []int64{5}},
+		{repositories.Cursor{After: 5}, 5, nil},
+	}
+
+	for _, page := range pages {
+		retrieved, err := repos.Conversations.RetrieveConversationPage(conversation.ID, page.cursor, page.limit)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if retrieved.ID != conversation.ID || len(retrieved.Conversants) != 2 {
+			t.Fatalf("conversation retrieved incorrectly: %+v", retrieved)
+		}
+
+		checkSequences(t, retrieved.Messages, page.sequences...)
+	}
+
+	if _, err := repos.Conversations.RetrieveConversationPage(uuid.New(), repositories.Cursor{}, 10); err == nil {
+		t.Fatal("expected an error retrieving an unknown conversation")
+	}
+}
+
+func testRetrieveConversationNotFound(t *testing.T, repos Repos) {
+	_, err := repos.Conversations.RetrieveConversation(uuid.New(), 10, 0)
+	if err == nil {
+		t.Fatal("expected an error retrieving an unknown conversation")
+	}
+}
+
+// activityGap is long enough for every backend's clock to tell two activities apart
+const activityGap = 10 * time.Millisecond
+
+func createConversationWith(t *testing.T, repos Repos, conversants ...repositories.Conversant) *repositories.Conversation {
+	conversation, err := repos.Conversations.CreateConversation(repositories.Conversation{
+		Name:        "test",
+		Conversants: conversants,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return conversation
+}
+
+func checkSummaries(t *testing.T, summaries []repositories.ConversationSummary, conversations ...*repositories.Conversation) {
+	t.Helper()
+
+	if len(summaries) != len(conversations) {
+		t.Fatalf("expected %d conversations, received %+v", len(conversations), summaries)
+	}
+
+	for i, conversation := range conversations {
+		if summaries[i].ID != conversation.ID {
+			t.Fatalf("expected conversation %d to be %s, received %+v", i, conversation.ID, summaries)
+		}
+	}
+}
+
+func testListConversations(t *testing.T, repos Repos) {
+	conversants := createConversants(t, repos, "a", "b", "c")
+	a, b, c := conversants[0], conversants[1], conversants[2]
+
+	older := createConversationWith(t, repos, a, b)
+	newer := createConversationWith(t, repos, a, b)
+	createConversationWith(t, repos, b, c)
+
+	time.Sleep(activityGap)
+	createMessages(t, repos, older, b.ID, 2)
+	time.Sleep(activityGap)
+	createMessages(t, repos, newer, b.ID, 1)
+	time.Sleep(activityGap)
+	empty := createConversationWith(t, repos, a, c)
+
+	summaries, err := repos.Conversations.ListConversations(a.ID, 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkSummaries(t, summaries, empty, newer, older)
+
+	if summaries[0].LastMessage != nil || summaries[0].UnreadCount != 0 {
+		t.Fatalf("expected no messages in %+v", summaries[0])
+	}
+
+	if summaries[1].Name != "test" || summaries[1].UnreadCount != 1 || summaries[1].LastMessage == nil ||
+		summaries[1].LastMessage.Sequence != 1 || summaries[1].LastMessage.SenderID != b.ID {
+		t.Fatalf("conversation listed incorrectly: %+v", summaries[1])
+	}
+
+	if summaries[2].UnreadCount != 2 || summaries[2].LastMessage == nil || summaries[2].LastMessage.Sequence != 2 ||
+		summaries[2].LastMessage.ConversationID != older.ID || summaries[2].LastMessage.Message != "test" {
+		t.Fatalf("conversation listed incorrectly: %+v", summaries[2])
+	}
+
+	if !summaries[0].LastActivity.After(summaries[1].LastActivity) || !summaries[1].LastActivity.After(summaries[2].LastActivity) {
+		t.Fatalf("expected activity to be newest first, received %+v", summaries)
+	}
+
+	summaries, err = repos.Conversations.ListConversations(a.ID, 1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkSummaries(t, summaries, newer)
+
+	summaries, err = repos.Conversations.ListConversations(a.ID, 10, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkSummaries(t, summaries)
+
+	time.Sleep(activityGap)
+	createMessages(t, repos, older, a.ID, 1)
+
+	summaries, err = repos.Conversations.ListConversations(a.ID, 1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkSummaries(t, summaries, older)
+}
+
+func testListConversationsBlocked(t *testing.T, repos Repos) {
+	conversants := createConversants(t, repos, "a", "b", "c", "d")
+	a, b, c, d := conversants[0].ID, conversants[1].ID, conversants[2].ID, conversants[3].ID
+
+	group := createConversationWith(t, repos, conversants...)
+	for _, message := range []repositories.Message{
+		{SenderID: c, Message: "shown"},
+		{SenderID: b, Message: "blocked"},
+		{SenderID: b, Message: "added d", System: true},
+		{SenderID: d, Message: "muted"},
+		{SenderID: b, Message: "blocked"},
+	} {
+		message.ConversationID = group.ID
+		if _, err := repos.Messages.CreateMessage(message); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	time.Sleep(activityGap)
+	onlyBlocked := createConversationWith(t, repos, conversants[0], conversants[1])
+	createMessages(t, repos, onlyBlocked, b, 1)
+
+	for _, block := range []repositories.Block{{BlockerID: a, BlockedID: b}, {BlockerID: a, BlockedID: d, Mute: true}} {
+		if err := repos.Blocks.Block(block); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	summaries, err := repos.Conversations.ListConversations(a, 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkSummaries(t, summaries, onlyBlocked, group)
+
+	if summaries[0].LastMessage != nil || summaries[0].UnreadCount != 0 {
+		t.Fatalf("expected blocked messages to be hidden, received %+v", summaries[0])
+	}
+
+	// mutes and system messages are still shown
+	if summaries[1].LastMessage == nil || summaries[1].LastMessage.Sequence != 4 || summaries[1].UnreadCount != 3 {
+		t.Fatalf("expected last message 4 and 3 unread, received %+v", summaries[1])
+	}
+
+	if err := repos.Conversations.MarkRead(group.ID, a, 4); err != nil {
+		t.Fatal(err)
+	}
+
+	summaries, err = repos.Conversations.ListConversations(a, 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if summaries[1].LastMessage == nil || summaries[1].LastMessage.Sequence != 4 || summaries[1].UnreadCount != 0 {
+		t.Fatalf("expected last message 4 and nothing unread, received %+v", summaries[1])
+	}
+
+	// blocks only hide messages from whoever made them
+	summaries, err = repos.Conversations.ListConversations(c, 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkSummaries(t, summaries, group)
+
+	if summaries[0].LastMessage == nil || summaries[0].LastMessage.Sequence != 5 || summaries[0].UnreadCount != 5 {
+		t.Fatalf("expected last message 5 and 5 unread, received %+v", summaries[0])
+	}
+}
+
+func testMarkRead(t *testing.T, repos Repos) {
+	conversation, conversants := createConversation(t, repos)
+	createMessages(t, repos, conversation, conversants[1].ID, 3)
+
+	unread := func(conversant repositories.Conversant) int64 {
+		summaries, err := repos.Conversations.ListConversations(conversant.ID, 10, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkSummaries(t, summaries, conversation)
+		return summaries[0].UnreadCount
+	}
+
+	if err := repos.Conversations.MarkRead(conversation.ID, conversants[0].ID, 2); err != nil {
+		t.Fatal(err)
+	}
+
+	if count := unread(conversants[0]); count != 1 {
+		t.Fatalf("expected 1 unread message, received %d", count)
+	}
+
+	if err := repos.Conversations.MarkRead(conversation.ID, conversants[0].ID, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	if count := unread(conversants[0]); count != 1 {
+		t.Fatalf("expected the read position not to move back, received %d unread", count)
+	}
+
+	if count := unread(conversants[1]); count != 3 {
+		t.Fatalf("expected read positions to be per conversant, received %d unread", count)
+	}
+}
+
+func testAddConversants(t *testing.T, repos Repos) {
+	conversation, conversants := createConversation(t, repos)
+	createMessages(t, repos, conversation, conversants[0].ID, 2)
+
+	added := createConversants(t, repos, "c")[0]
+	err := repos.Conversations.AddConversants(conversation.ID, []repositories.Conversant{added, conversants[1]})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	received, err := repos.Conversations.GetConversants(conversation.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkConversants(t, append(conversants, added), received)
+
+	summaries, err := repos.Conversations.ListConversations(added.ID, 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkSummaries(t, summaries, conversation)
+
+	if summaries[0].UnreadCount != 0 {
+		t.Fatalf("expected new members to start with nothing unread, received %d", summaries[0].UnreadCount)
+	}
+
+	unknown := repositories.Conversant{ID: uuid.New()}
+	if err = repos.Conversations.AddConversants(conversation.ID, []repositories.Conversant{unknown}); err == nil {
+		t.Fatal("expected an error adding an unknown conversant")
+	}
+}
+
+func testRemoveConversants(t *testing.T, repos Repos) {
+	conversation, conversants := createConversation(t, repos)
+
+	err := repos.Conversations.RemoveConversants(conversation.ID, []string{conversants[1].ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	received, err := repos.Conversations.GetConversants(conversation.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkConversants(t, conversants[:1], received)
+
+	summaries, err := repos.Conversations.ListConversations(conversants[1].ID, 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkSummaries(t, summaries)
+
+	createMessages(t, repos, conversation, conversants[0].ID, 1)
+	if err = repos.Conversations.MarkRead(conversation.ID, conversants[1].ID, 1); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func testIsConversant(t *testing.T, repos Repos) {
+	conversation, conversants := createConversation(t, repos)
+	outsider := createConversants(t, repos, "c")[0]
+
+	check := func(conversationID, conversantID string, expected bool) {
+		t.Helper()
+		member, err := repos.Conversations.IsConversant(conversationID, conversantID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if member != expected {
+			t.Fatalf("expected IsConversant to be %v for %s in %s", expected, conversantID, conversationID)
+		}
+	}
+
+	check(conversation.ID, conversants[0].ID, true)
+	check(conversation.ID, outsider.ID, false)
+	check(uuid.New(), conversants[0].ID, false)
+
+	if err := repos.Conversations.AddConversants(conversation.ID, []repositories.Conversant{outsider}); err != nil {
+		t.Fatal(err)
+	}
+	check(conversation.ID, outsider.ID, true)
+
+	if err := repos.Conversations.RemoveConversants(conversation.ID, []string{conversants[0].ID}); err != nil {
+		t.Fatal(err)
+	}
+	check(conversation.ID, conversants[0].ID, false)
+}
+
+func testRoles(t *testing.T, repos Repos) {
+	conversants := createConversants(t, repos, "a", "b", "c")
+	conversants[0].Role = repositories.RoleOwner
+
+	conversation, err := repos.Conversations.CreateConversation(repositories.Conversation{
+		Name:        "test",
+		Conversants: conversants[:2],
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conversants[2].Role = repositories.RoleReadOnly
+	if err = repos.Conversations.AddConversants(conversation.ID, conversants[2:]); err != nil {
+		t.Fatal(err)
+	}
+
+	received, err := repos.Conversations.RetrieveConversation(conversation.ID, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkConversants(t, conversants, received.Conversants)
+}
+
+func testSetRole(t *testing.T, repos Repos) {
+	conversation, conversants := createConversation(t, repos)
+	outsider := createConversants(t, repos, "c")[0]
+
+	err := repos.Conversations.SetRole(conversation.ID, conversants[1].ID, repositories.RoleAdmin)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = repos.Conversations.SetRole(conversation.ID, outsider.ID, repositories.RoleAdmin); err != nil {
+		t.Fatal(err)
+	}
+
+	received, err := repos.Conversations.GetConversants(conversation.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conversants[1].Role = repositories.RoleAdmin
+	checkConversants(t, conversants, received)
+}
+
+func testRenameConversation(t *testing.T, repos Repos) {
+	conversation, _ := createConversation(t, repos)
+
+	if err := repos.Conversations.RenameConversation(conversation.ID, "renamed"); err != nil {
+		t.Fatal(err)
+	}
+
+	received, err := repos.Conversations.RetrieveConversation(conversation.ID, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if received.Name != "renamed" {
+		t.Fatalf("expected name renamed, received %s", received.Name)
+	}
+}
+
+func testDeleteConversation(t *testing.T, repos Repos) {
+	conversation, conversants := createConversation(t, repos)
+	other, _ := createConversation(t, repos)
+	createMessages(t, repos, other, other.Conversants[0].ID, 1)
+
+	_, err := repos.Messages.CreateMessage(repositories.Message{
+		SenderID:       conversants[0].ID,
+		ConversationID: conversation.ID,
+		Message:        "test",
+		IdempotencyKey: "key",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = repos.Conversations.DeleteConversation(conversation.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = repos.Conversations.RetrieveConversation(conversation.ID, 0, 0); err == nil {
+		t.Fatal("expected an error retrieving a deleted conversation")
+	}
+
+	member, err := repos.Conversations.IsConversant(conversation.ID, conversants[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if member {
+		t.Fatal("expected the conversation's memberships to be deleted")
+	}
+
+	summaries, err := repos.Conversations.ListConversations(conversants[0].ID, 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkSummaries(t, summaries)
+
+	received, err := repos.Conversations.RetrieveConversation(other.ID, 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkSequences(t, received.Messages, 1)
+}
+
+func testCreateMessageSequence(t *testing.T, repos Repos) {
+	first, conversants := createConversation(t, repos)
+	second, _ := createConversation(t, repos)
+
+	for i := int64(1); i <= 3; i++ {
+		for _, conversation := range []*repositories.Conversation{first, second} {
+			message, err := repos.Messages.CreateMessage(repositories.Message{
+				SenderID:       conversants[i%2].ID,
+				ConversationID: conversation.ID,
+				Message:        "test",
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if message.Sequence != i {
+				t.Fatalf("expected sequence %d, received %d", i, message.Sequence)
+			}
+		}
+	}
+}
+
+func testCreateMessageIdempotency(t *testing.T, repos Repos) {
+	conversation, conversants := createConversation(t, repos)
+
+	original, err := repos.Messages.CreateMessage(repositories.Message{
+		SenderID:       conversants[0].ID,
+		ConversationID: conversation.ID,
+		Message:        "original",
+		IdempotencyKey: "key",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	duplicate, err := repos.Messages.CreateMessage(repositories.Message{
+		ID:             uuid.New(),
+		SenderID:       conversants[0].ID,
+		ConversationID: conversation.ID,
+		Message:        "duplicate",
+		IdempotencyKey: "key",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if duplicate.ID != original.ID || duplicate.Sequence != original.Sequence || duplicate.Message != "original" {
+		t.Fatalf("expected original message %+v, received %+v", original, duplicate)
+	}
+
+	other, err := repos.Messages.CreateMessage(repositories.Message{
+		SenderID:       conversants[1].ID,
+		ConversationID: conversation.ID,
+		Message:        "other",
+		IdempotencyKey: "key",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if other.ID == original.ID || other.Sequence != 2 {
+		t.Fatalf("expected idempotency keys to be scoped to the sender, received %+v", other)
+	}
+}
+
+func testGetMessagesAfter(t *testing.T, repos Repos) {
+	conversation, conversants := createConversation(t, repos)
+	createMessages(t, repos, conversation, conversants[0].ID, 4)
+
+	_, err := repos.Messages.CreateMessage(repositories.Message{
+		SenderID:       conversants[0].ID,
+		ConversationID: conversation.ID,
+		Message:        "system",
+		System:         true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	messages, err := repos.Messages.GetMessagesAfter(conversation.ID, 0, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkSequences(t, messages, 1, 2)
+
+	messages, err = repos.Messages.GetMessagesAfter(conversation.ID, 3, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkSequences(t, messages, 4, 5)
+
+	if messages[0].System || !messages[1].System {
+		t.Fatalf("expected only the last message to be a system message, received %+v", messages)
+	}
+
+	summaries, err := repos.Conversations.ListConversations(conversants[0].ID, 1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if summaries[0].LastMessage == nil || !summaries[0].LastMessage.System {
+		t.Fatalf("expected the last message to be a system message, received %+v", summaries[0].LastMessage)
+	}
+
+	messages, err = repos.Messages.GetMessagesAfter(conversation.ID, 5, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkSequences(t, messages)
+}
+
+func testBlock(t *testing.T, repos Repos) {
+	conversants := createConversants(t, repos, "a", "b", "c")
+	a, b, c := conversants[0].ID, conversants[1].ID, conversants[2].ID
+
+	check := func(conversantID, otherID string, expected bool) {
+		t.Helper()
+		blocked, err := repos.Blocks.IsBlocked(conversantID, otherID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if blocked != expected {
+			t.Fatalf("expected IsBlocked to be %v for %s and %s", expected, conversantID, otherID)
+		}
+	}
+
+	check(a, b, false)
+
+	if err := repos.Blocks.Block(repositories.Block{BlockerID: a, BlockedID: b}); err != nil {
+		t.Fatal(err)
+	}
+	check(a, b, true)
+	check(b, a, true)
+	check(a, c, false)
+
+	// blocking again with a mute replaces the block, and mutes aren't blocks
+	if err := repos.Blocks.Block(repositories.Block{BlockerID: a, BlockedID: b, Mute: true}); err != nil {
+		t.Fatal(err)
+	}
+	check(a, b, false)
+
+	if err := repos.Blocks.Block(repositories.Block{BlockerID: a, BlockedID: b}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := repos.Blocks.Unblock(a, b); err != nil {
+		t.Fatal(err)
+	}
+	check(a, b, false)
+
+	if err := repos.Blocks.Unblock(a, b); err != nil {
+		t.Fatalf("expected unblocking twice not to fail, received %v", err)
+	}
+}
+
+func testGetBlockers(t *testing.T, repos Repos) {
+	conversants := createConversants(t, repos, "a", "b", "c")
+	a, b, c := conversants[0].ID, conversants[1].ID, conversants[2].ID
+
+	blocks := []repositories.Block{
+		{BlockerID: a, BlockedID: c},
+		{BlockerID: b, BlockedID: c, Mute: true},
+		{BlockerID: c, BlockedID: a},
+	}
+	for _, block := range blocks {
+		if err := repos.Blocks.Block(block); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	received, err := repos.Blocks.GetBlockers(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// blocks come back in any order, so put the block before the mute
+	sort.Slice(received, func(i, j int) bool {
+		return !received[i].Mute && received[j].Mute
+	})
+
+	if len(received) != 2 || received[0] != blocks[0] || received[1] != blocks[1] {
+		t.Fatalf("expected blocks %+v, received %+v", blocks[:2], received)
+	}
+
+	received, err = repos.Blocks.GetBlockers(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(received) != 0 {
+		t.Fatalf("expected no blocks, received %+v", received)
+	}
+}
+
+func testGetBlocked(t *testing.T, repos Repos) {
+	conversants := createConversants(t, repos, "a", "b", "c")
+	a, b, c := conversants[0].ID, conversants[1].ID, conversants[2].ID
+
+	blocks := []repositories.Block{
+		{BlockerID: a, BlockedID: b},
+		{BlockerID: a, BlockedID: c, Mute: true},
+		{BlockerID: c, BlockedID: a},
+	}
+	for _, block := range blocks {
+		if err := repos.Blocks.Block(block); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	received, err := repos.Blocks.GetBlocked(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sort.Slice(received, func(i, j int) bool {
+		return !received[i].Mute && received[j].Mute
+	})
+
+	if len(received) != 2 || received[0] != blocks[0] || received[1] != blocks[1] {
+		t.Fatalf("expected blocks %+v, received %+v", blocks[:2], received)
+	}
+
+	received, err = repos.Blocks.GetBlocked(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(received) != 0 {
+		t.Fatalf("expected no blocks, received %+v", received)
+	}
+}
@@ -0,0 +1,88 @@
+package sqlite
+
+import (
+	"github.com/jmoiron/sqlx"
+	"github.com/ryan-berger/chatty/repositories"
+)
+
+const blockConversant = `
+INSERT INTO conversant_block(blocker_id, blocked_id, mute) VALUES (?, ?, ?)
+ON CONFLICT (blocker_id, blocked_id) DO UPDATE SET mute = excluded.mute
+`
+
+const unblockConversant = `
+DELETE FROM conversant_block WHERE blocker_id = ? AND blocked_id = ?
+`
+
+// placeholders can't be reused, so the pair is passed both ways round
+const isBlocked = `
+SELECT EXISTS(
+  SELECT 1 FROM conversant_block
+  WHERE NOT mute AND ((blocker_id = ? AND blocked_id = ?) OR (blocker_id = ? AND blocked_id = ?))
+)
+`
+
+const getBlockers = `
+SELECT blocker_id, blocked_id, mute FROM conversant_block WHERE blocked_id = ?
+`
+
+const getBlocked = `
+SELECT blocker_id, blocked_id, mute FROM conversant_block WHERE blocker_id = ?
+`
+
+// BlockRepository is a BlockRepo implementation that uses SQLite to store blocks
+type BlockRepository struct {
+	db *sqlx.DB
+}
+
+// NewBlockRepository creates a new SQLite BlockRepository
+func NewBlockRepository(db *sqlx.DB) *BlockRepository {
+	return &BlockRepository{
+		db: db,
+	}
+}
+
+// Block stores the block, replacing any the blocker already has on the same conversant
+func (repo *BlockRepository) Block(block repositories.Block) error {
+	_, err := repo.db.Exec(blockConversant, block.BlockerID, block.BlockedID, block.Mute)
+	return err
+}
+
+// Unblock removes the blocker's block on the conversant, if there is one
+func (repo *BlockRepository) Unblock(blockerID, blockedID string) error {
+	_, err := repo.db.Exec(unblockConversant, blockerID, blockedID)
+	return err
+}
+
+// IsBlocked reports whether either conversant has blocked the other
+func (repo *BlockRepository) IsBlocked(conversantID, otherID string) (bool, error) {
+	var blocked bool
+	err := repo.db.Get(&blocked, isBlocked, conversantID, otherID, otherID, conversantID)
+	if err != nil {
+		return false, err
+	}
+
+	return blocked, nil
+}
+
+// GetBlockers returns every block on the conversant
+func (repo *BlockRepository) GetBlockers(blockedID string) ([]repositories.Block, error) {
+	var blocks []repositories.Block
+	err := repo.db.Select(&blocks, getBlockers, blockedID)
+	if err != nil {
+		return nil, err
+	}
+
+	return blocks, nil
+}
+
+// GetBlocked returns every block the conversant has made
+func (repo *BlockRepository) GetBlocked(blockerID string) ([]repositories.Block, error) {
+	var blocks []repositories.Block
+	err := repo.db.Select(&blocks, getBlocked, blockerID)
+	if err != nil {
+		return nil, err
+	}
+
+	return blocks, nil
+}
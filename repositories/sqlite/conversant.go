@@ -0,0 +1,35 @@
+package sqlite
+
+import (
+	"github.com/jmoiron/sqlx"
+	"github.com/ryan-berger/chatty/repositories"
+)
+
+const updateOrCreateConversant = `
+INSERT INTO conversant (id, display_name) VALUES (:id, :display_name)
+ON CONFLICT (id) DO
+  UPDATE SET display_name = excluded.display_name
+`
+
+// ConversantRepository is a ConversantRepo implementation that uses SQLite to store conversants
+type ConversantRepository struct {
+	db *sqlx.DB
+}
+
+// NewConversantRepository creates a new SQLite ConversantRepository
+func NewConversantRepository(db *sqlx.DB) *ConversantRepository {
+	return &ConversantRepository{
+		db: db,
+	}
+}
+
+// UpdateOrCreate stores the conversant, updating the display name if it already exists
+func (repo *ConversantRepository) UpdateOrCreate(conversant repositories.Conversant) (*repositories.Conversant, error) {
+	_, err := repo.db.NamedExec(updateOrCreateConversant, &conversant)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &conversant, nil
+}
@@ -0,0 +1,128 @@
+package sqlite
+
+import (
+	"database/sql"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/mattn/go-sqlite3"
+	"github.com/pborman/uuid"
+	"github.com/pkg/errors"
+	"github.com/ryan-berger/chatty/repositories"
+)
+
+const nextSequence = `
+UPDATE conversation SET last_sequence = last_sequence + 1, last_activity = strftime('%Y-%m-%d %H:%M:%f', 'now')
+WHERE id = ?
+RETURNING last_sequence
+`
+
+const createMessage = `
+INSERT INTO chat_message(id, message, sender, conversation, idempotency_key, sequence, system_message)
+VALUES (:id, :message, :sender_id, :conversation_id, NULLIF(:idempotency_key, ''), :sequence, :system_message)
+`
+
+const getMessageByIdempotencyKey = `
+SELECT
+	m.id,
+	m.message,
+	m.sender AS sender_id,
+	m.conversation AS conversation_id,
+	m.idempotency_key,
+	m.sequence,
+	m.system_message
+FROM chat_message m
+WHERE m.sender = ? AND m.idempotency_key = ?
+`
+
+const getMessagesAfter = `
+SELECT
+	m.id,
+	m.message,
+	m.sender AS sender_id,
+	m.conversation AS conversation_id,
+	m.sequence,
+	m.system_message
+FROM chat_message m
+WHERE m.conversation = ? AND m.sequence > ?
+ORDER BY m.sequence
+LIMIT ?
+`
+
+// MessageRepository is a MessageRepo implementation that uses SQLite to store messages
+type MessageRepository struct {
+	db *sqlx.DB
+}
+
+// NewMessageRepository creates a new SQLite MessageRepository
+func NewMessageRepository(db *sqlx.DB) *MessageRepository {
+	return &MessageRepository{
+		db: db,
+	}
+}
+
+// CreateMessage stores a message in SQLite, giving it the next sequence number in its
+// conversation. SQLite serializes write transactions, so concurrent messages are numbered
+// one after another. When the sender has already used the message's idempotency key, the
+// original message is returned instead
+func (repo *MessageRepository) CreateMessage(message repositories.Message) (*repositories.Message, error) {
+	if message.ID == "" {
+		message.ID = uuid.New()
+	}
+
+	if message.IdempotencyKey != "" {
+		original, err := repo.getByIdempotencyKey(message.SenderID, message.IdempotencyKey)
+		if err == nil {
+			return original, nil
+		}
+		if err != sql.ErrNoRows {
+			return nil, err
+		}
+	}
+
+	tx, err := repo.db.Beginx()
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Get(&message.Sequence, nextSequence, message.ConversationID)
+	if err != nil {
+		tx.Rollback()
+		return nil, errors.Wrap(err, "err: getting next sequence")
+	}
+
+	_, err = tx.NamedExec(createMessage, &message)
+	if err != nil {
+		tx.Rollback()
+		if sqliteErr, ok := err.(sqlite3.Error); ok && sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique && message.IdempotencyKey != "" {
+			return repo.getByIdempotencyKey(message.SenderID, message.IdempotencyKey)
+		}
+		return nil, errors.Wrap(err, "err: creating message")
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, errors.Wrap(err, "commit: error comitting CreateMessage")
+	}
+
+	return &message, nil
+}
+
+// GetMessagesAfter returns up to limit messages in the conversation after the given sequence
+func (repo *MessageRepository) GetMessagesAfter(conversationID string, sequence int64, limit int) ([]repositories.Message, error) {
+	var messages []repositories.Message
+	err := repo.db.Select(&messages, getMessagesAfter, conversationID, sequence, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	return messages, nil
+}
+
+func (repo *MessageRepository) getByIdempotencyKey(senderID, idempotencyKey string) (*repositories.Message, error) {
+	var original repositories.Message
+	err := repo.db.Get(&original, getMessageByIdempotencyKey, senderID, idempotencyKey)
+	if err != nil {
+		return nil, err
+	}
+	return &original, nil
+}
@@ -0,0 +1,227 @@
+package sqlite
+
+import (
+	"embed"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// Direction is which way Migrate moves the schema
+type Direction int
+
+const (
+	// Up applies every migration that hasn't been applied yet
+	Up Direction = iota
+	// Down rolls back the most recently applied migration
+	Down
+)
+
+const createSchemaMigrations = `
+CREATE TABLE IF NOT EXISTS chatty_migrations
+(
+  version    INTEGER PRIMARY KEY,
+  name       TEXT NOT NULL,
+  applied_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP
+)
+`
+
+const getAppliedVersions = `SELECT version FROM chatty_migrations`
+
+const insertVersion = `INSERT INTO chatty_migrations(version, name) VALUES (?, ?)`
+
+const deleteVersion = `DELETE FROM chatty_migrations WHERE version = ?`
+
+// Migration is a single schema change, read from a pair of
+// <version>_<name>.up.sql and .down.sql files
+type Migration struct {
+	Version int64
+	Name    string
+	Applied bool
+	up      *string
+	down    *string
+}
+
+// Migrate moves the schema in the given direction. Everything runs in one transaction,
+// so a failed migration leaves the schema as it was
+func Migrate(db *sqlx.DB, direction Direction) error {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.Beginx()
+	if err != nil {
+		return err
+	}
+
+	applied, err := appliedVersions(tx)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	switch direction {
+	case Up:
+		for _, migration := range migrations {
+			if applied[migration.Version] {
+				continue
+			}
+
+			if _, err = tx.Exec(*migration.up); err != nil {
+				tx.Rollback()
+				return errors.Wrapf(err, "err: applying migration %d_%s", migration.Version, migration.Name)
+			}
+
+			if _, err = tx.Exec(insertVersion, migration.Version, migration.Name); err != nil {
+				tx.Rollback()
+				return err
+			}
+		}
+	case Down:
+		for i := len(migrations) - 1; i >= 0; i-- {
+			migration := migrations[i]
+			if !applied[migration.Version] {
+				continue
+			}
+
+			if _, err = tx.Exec(*migration.down); err != nil {
+				tx.Rollback()
+				return errors.Wrapf(err, "err: rolling back migration %d_%s", migration.Version, migration.Name)
+			}
+
+			if _, err = tx.Exec(deleteVersion, migration.Version); err != nil {
+				tx.Rollback()
+				return err
+			}
+			break
+		}
+	default:
+		tx.Rollback()
+		return errors.Errorf("unknown migration direction %d", direction)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return errors.Wrap(err, "commit: error comitting Migrate")
+	}
+
+	return nil
+}
+
+// MigrationStatus lists every known migration, oldest first, and whether it has been applied
+func MigrationStatus(db *sqlx.DB) ([]Migration, error) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := db.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	applied, err := appliedVersions(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range migrations {
+		migrations[i].Applied = applied[migrations[i].Version]
+	}
+
+	return migrations, nil
+}
+
+// appliedVersions creates the schema table if needed. SQLite only has one writer,
+// so unlike postgres there's no lock to take
+func appliedVersions(tx *sqlx.Tx) (map[int64]bool, error) {
+	if _, err := tx.Exec(createSchemaMigrations); err != nil {
+		return nil, err
+	}
+
+	var versions []int64
+	if err := tx.Select(&versions, getAppliedVersions); err != nil {
+		return nil, err
+	}
+
+	applied := make(map[int64]bool, len(versions))
+	for _, version := range versions {
+		applied[version] = true
+	}
+	return applied, nil
+}
+
+func loadMigrations() ([]Migration, error) {
+	files, err := fs.Glob(migrationFiles, "migrations/*.sql")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int64]*Migration)
+	for _, file := range files {
+		base := path.Base(file)
+
+		var up bool
+		switch {
+		case strings.HasSuffix(base, ".up.sql"):
+			up = true
+			base = strings.TrimSuffix(base, ".up.sql")
+		case strings.HasSuffix(base, ".down.sql"):
+			base = strings.TrimSuffix(base, ".down.sql")
+		default:
+			return nil, errors.Errorf("migration %s is neither up nor down", file)
+		}
+
+		parts := strings.SplitN(base, "_", 2)
+		if len(parts) != 2 {
+			return nil, errors.Errorf("migration %s is not named <version>_<name>", file)
+		}
+
+		version, err := strconv.ParseInt(parts[0], 10, 64)
+		if err != nil {
+			return nil, errors.Wrapf(err, "migration %s has a bad version", file)
+		}
+
+		contents, err := migrationFiles.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: parts[1]}
+			byVersion[version] = migration
+		}
+
+		sql := string(contents)
+		if up {
+			migration.up = &sql
+		} else {
+			migration.down = &sql
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.up == nil || migration.down == nil {
+			return nil, errors.Errorf("migration %d_%s needs both an up and a down file", migration.Version, migration.Name)
+		}
+		migrations = append(migrations, *migration)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
@@ -0,0 +1,32 @@
+CREATE TABLE conversation
+(
+  id            TEXT PRIMARY KEY,
+  name          TEXT             DEFAULT NULL,
+  direct        BOOLEAN NOT NULL DEFAULT TRUE,
+  last_sequence INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE TABLE conversant
+(
+  id           TEXT PRIMARY KEY,
+  display_name TEXT NOT NULL DEFAULT ''
+);
+
+CREATE TABLE conversant_conversation
+(
+  conversation_id TEXT REFERENCES conversation NOT NULL,
+  conversant_id   TEXT REFERENCES conversant   NOT NULL,
+  PRIMARY KEY (conversation_id, conversant_id)
+);
+
+CREATE TABLE chat_message
+(
+  id              TEXT PRIMARY KEY,
+  message         TEXT                         NOT NULL,
+  sender          TEXT REFERENCES conversant   NOT NULL,
+  conversation    TEXT REFERENCES conversation NOT NULL,
+  idempotency_key TEXT                         DEFAULT NULL,
+  sequence        INTEGER                      NOT NULL,
+  UNIQUE (sender, idempotency_key),
+  UNIQUE (conversation, sequence)
+);
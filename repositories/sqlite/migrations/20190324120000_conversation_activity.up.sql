@@ -0,0 +1,13 @@
+ALTER TABLE conversation
+  ADD COLUMN last_activity TIMESTAMP NOT NULL DEFAULT '1970-01-01 00:00:00';
+
+UPDATE conversation
+SET last_activity = strftime('%Y-%m-%d %H:%M:%f', 'now');
+
+ALTER TABLE conversant_conversation
+  ADD COLUMN last_read_sequence INTEGER NOT NULL DEFAULT 0;
+
+UPDATE conversant_conversation
+SET last_read_sequence = (SELECT c.last_sequence FROM conversation c WHERE c.id = conversation_id);
+
+CREATE INDEX conversant_conversation_conversant_id ON conversant_conversation (conversant_id);
@@ -0,0 +1,2 @@
+ALTER TABLE conversant_conversation
+  DROP COLUMN role;
@@ -0,0 +1,16 @@
+ALTER TABLE conversant_conversation
+  ADD COLUMN role TEXT NOT NULL DEFAULT 'member';
+
+-- groups created before roles don't record who started them, so the member with the lowest
+-- conversant ID, compared byte by byte, is made the owner and everyone else stays a member.
+-- It's arbitrary, but every backend picks the same owner, and every group gets one
+UPDATE conversant_conversation
+SET role = 'owner'
+WHERE conversation_id IN (SELECT id FROM conversation WHERE NOT direct)
+  AND conversant_id = (
+    SELECT members.conversant_id
+    FROM conversant_conversation members
+    WHERE members.conversation_id = conversant_conversation.conversation_id
+    ORDER BY members.conversant_id
+    LIMIT 1
+  );
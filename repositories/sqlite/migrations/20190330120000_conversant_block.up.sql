@@ -0,0 +1,9 @@
+CREATE TABLE conversant_block
+(
+  blocker_id TEXT    NOT NULL,
+  blocked_id TEXT    NOT NULL,
+  mute       BOOLEAN NOT NULL DEFAULT FALSE,
+  PRIMARY KEY (blocker_id, blocked_id)
+);
+
+CREATE INDEX conversant_block_blocked_id ON conversant_block (blocked_id);
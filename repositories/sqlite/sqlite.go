@@ -0,0 +1,27 @@
+package sqlite
+
+import (
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// Open opens a SQLite database with foreign keys turned on. SQLite only allows one
+// writer at a time, and every connection to ":memory:" is its own database, so
+// the pool is limited to a single connection. Like the other SQL backends, the
+// schema isn't touched, so call Migrate before using a new database
+func Open(dataSourceName string) (*sqlx.DB, error) {
+	db, err := sqlx.Open("sqlite3", dataSourceName)
+	if err != nil {
+		return nil, err
+	}
+
+	db.SetMaxOpenConns(1)
+
+	_, err = db.Exec("PRAGMA foreign_keys = ON")
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return db, nil
+}
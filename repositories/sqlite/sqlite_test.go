@@ -0,0 +1,300 @@
+package sqlite
+
+import (
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/pborman/uuid"
+
+	"github.com/ryan-berger/chatty/repositories"
+	"github.com/ryan-berger/chatty/repositories/repotest"
+)
+
+func openTestDB(t *testing.T) *sqlx.DB {
+	db, err := Open(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	if err = Migrate(db, Up); err != nil {
+		t.Fatal(err)
+	}
+
+	return db
+}
+
+func createTestConversation(t *testing.T, db *sqlx.DB) (*repositories.Conversation, []repositories.Conversant) {
+	conversantRepo := NewConversantRepository(db)
+	conversants := []repositories.Conversant{
+		{ID: uuid.New(), DisplayName: "a"},
+		{ID: uuid.New(), DisplayName: "b"},
+	}
+
+	for _, conversant := range conversants {
+		if _, err := conversantRepo.UpdateOrCreate(conversant); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	conversation, err := NewConversationRepository(db).CreateConversation(repositories.Conversation{
+		Name:        "test",
+		Direct:      true,
+		Conversants: conversants,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return conversation, conversants
+}
+
+func TestConversantRepository_UpdateOrCreate(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewConversantRepository(db)
+
+	conversant := repositories.Conversant{ID: uuid.New(), DisplayName: "before"}
+	if _, err := repo.UpdateOrCreate(conversant); err != nil {
+		t.Fatal(err)
+	}
+
+	conversant.DisplayName = "after"
+	if _, err := repo.UpdateOrCreate(conversant); err != nil {
+		t.Fatal(err)
+	}
+
+	var name string
+	if err := db.Get(&name, "SELECT display_name FROM conversant WHERE id = ?", conversant.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	if name != "after" {
+		t.Fatalf("expected display name after, received %s", name)
+	}
+}
+
+func TestConversationRepository_RetrieveConversation(t *testing.T) {
+	db := openTestDB(t)
+	conversation, conversants := createTestConversation(t, db)
+
+	messageRepo := NewMessageRepository(db)
+	for i := 0; i < 5; i++ {
+		_, err := messageRepo.CreateMessage(repositories.Message{
+			SenderID:       conversants[0].ID,
+			ConversationID: conversation.ID,
+			Message:        "test",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	retrieved, err := NewConversationRepository(db).RetrieveConversation(conversation.ID, 2, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if retrieved.Name != "test" || !retrieved.Direct {
+		t.Fatalf("conversation retrieved incorrectly: %+v", retrieved)
+	}
+
+	if len(retrieved.Conversants) != 2 {
+		t.Fatalf("expected 2 conversants, received %d", len(retrieved.Conversants))
+	}
+
+	if len(retrieved.Messages) != 2 || retrieved.Messages[0].Sequence != 4 || retrieved.Messages[1].Sequence != 3 {
+		t.Fatalf("expected messages 4 and 3, received %+v", retrieved.Messages)
+	}
+}
+
+func TestMessageRepository_CreateMessage(t *testing.T) {
+	db := openTestDB(t)
+	conversation, conversants := createTestConversation(t, db)
+	repo := NewMessageRepository(db)
+
+	for i := int64(1); i <= 3; i++ {
+		message, err := repo.CreateMessage(repositories.Message{
+			SenderID:       conversants[i%2].ID,
+			ConversationID: conversation.ID,
+			Message:        "test",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if message.Sequence != i {
+			t.Fatalf("expected sequence %d, received %d", i, message.Sequence)
+		}
+	}
+
+	original, err := repo.CreateMessage(repositories.Message{
+		SenderID:       conversants[0].ID,
+		ConversationID: conversation.ID,
+		Message:        "test",
+		IdempotencyKey: "key",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	duplicate, err := repo.CreateMessage(repositories.Message{
+		ID:             uuid.New(),
+		SenderID:       conversants[0].ID,
+		ConversationID: conversation.ID,
+		Message:        "test",
+		IdempotencyKey: "key",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if duplicate.ID != original.ID || duplicate.Sequence != original.Sequence {
+		t.Fatalf("expected original message %+v, received %+v", original, duplicate)
+	}
+
+	messages, err := repo.GetMessagesAfter(conversation.ID, 2, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(messages) != 2 || messages[0].Sequence != 3 || messages[1].Sequence != 4 {
+		t.Fatalf("expected messages 3 and 4, received %+v", messages)
+	}
+}
+
+func TestConformance(t *testing.T) {
+	repotest.Run(t, func(t *testing.T) repotest.Repos {
+		db := openTestDB(t)
+		return repotest.Repos{
+			Messages:      NewMessageRepository(db),
+			Conversations: NewConversationRepository(db),
+			Conversants:   NewConversantRepository(db),
+			Blocks:        NewBlockRepository(db),
+		}
+	})
+}
+
+func TestOpen_NotMigrated(t *testing.T) {
+	db, err := Open(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	migrations, err := MigrationStatus(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, migration := range migrations {
+		if migration.Applied {
+			t.Fatalf("expected Open to leave %d_%s for Migrate", migration.Version, migration.Name)
+		}
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	db := openTestDB(t)
+
+	migrations, err := MigrationStatus(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, migration := range migrations {
+		if !migration.Applied {
+			t.Fatalf("expected %d_%s to be applied", migration.Version, migration.Name)
+		}
+	}
+
+	for range migrations {
+		if err = Migrate(db, Down); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	migrations, err = MigrationStatus(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, migration := range migrations {
+		if migration.Applied {
+			t.Fatalf("expected %d_%s to be rolled back", migration.Version, migration.Name)
+		}
+	}
+
+	if err = Migrate(db, Up); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestConversationRepository_NullName(t *testing.T) {
+	db := openTestDB(t)
+	conversation, conversants := createTestConversation(t, db)
+
+	// conversations created before names were required have a NULL name
+	if _, err := db.Exec("UPDATE conversation SET name = NULL WHERE id = ?", conversation.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	repo := NewConversationRepository(db)
+	retrieved, err := repo.RetrieveConversation(conversation.ID, 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if retrieved.Name != "" {
+		t.Fatalf("expected an empty name, received %s", retrieved.Name)
+	}
+
+	summaries, err := repo.ListConversations(conversants[0].ID, 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(summaries) != 1 || summaries[0].Name != "" {
+		t.Fatalf("expected one conversation with an empty name, received %+v", summaries)
+	}
+}
+
+func TestMigrate_BackfillRoles(t *testing.T) {
+	db := openTestDB(t)
+
+	// roll back to before roles, conversant_block then conversation_roles
+	for i := 0; i < 2; i++ {
+		if err := Migrate(db, Down); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ids := []string{"c", "a", "b"}
+	db.MustExec("INSERT INTO conversation(id, name, direct) VALUES ('group', 'group', FALSE)")
+	for _, id := range ids {
+		db.MustExec("INSERT INTO conversant(id) VALUES (?)", id)
+		db.MustExec("INSERT INTO conversant_conversation(conversation_id, conversant_id) VALUES ('group', ?)", id)
+	}
+
+	// c sending first shouldn't make them the owner
+	db.MustExec("INSERT INTO chat_message(id, message, sender, conversation, sequence) VALUES ('m', 'test', 'c', 'group', 1)")
+
+	if err := Migrate(db, Up); err != nil {
+		t.Fatal(err)
+	}
+
+	conversants, err := NewConversationRepository(db).GetConversants("group")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, conversant := range conversants {
+		expected := repositories.RoleMember
+		if conversant.ID == "a" {
+			expected = repositories.RoleOwner
+		}
+
+		if conversant.Role != expected {
+			t.Fatalf("expected %s to be %s, received %+v", conversant.ID, expected, conversants)
+		}
+	}
+}